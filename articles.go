@@ -0,0 +1,294 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/charset"
+	"gorm.io/gorm"
+)
+
+// fullArticleBatchSize is the most articles downloaded per fetch of a feed; the rest follow on later fetches
+const fullArticleBatchSize = 10
+
+// fullArticleBudget caps the total time article downloads take per fetch of a feed, so together with
+// the feed request they stay well within a fetch job lease; the remaining items follow on later fetches
+const fullArticleBudget = 90 * time.Second
+
+// maxArticleBytes caps the size of a downloaded article page
+const maxArticleBytes = 5 << 20
+
+// minArticleTextLength is the least text an extracted article must have to replace the feed's teaser
+const minArticleTextLength = 250
+
+var (
+	// articleNoiseTags never contain article text
+	articleNoiseTags = "script, style, noscript, template, iframe, object, embed, form, button, input, select, textarea, nav, header, footer, aside, svg, canvas"
+	// articleNegativePattern matches class names and IDs of page chrome around an article
+	articleNegativePattern = regexp.MustCompile(`(?i)comment|sidebar|footer|masthead|nav|menu|promo|sponsor|advert|\bads?\b|share|social|related|recommend|newsletter|subscribe|signup|cookie|consent|popup|modal|breadcrumb|byline|author-bio|tags`)
+	// articlePositivePattern matches class names and IDs of article bodies
+	articlePositivePattern = regexp.MustCompile(`(?i)article|body|content|entry|main|page|post|story|text`)
+	// articleMaybePattern keeps page chrome matches that may still wrap the article, e.g. "main-nav-content"
+	articleMaybePattern = regexp.MustCompile(`(?i)article|body|column|content|main`)
+)
+
+// fetchFullArticles downloads the pages of up to fullArticleBatchSize items of a feed that have
+// not been tried yet, within fullArticleBudget, and stores the extracted article as their FullContent.
+// Failures are recorded on the item so it is not retried on every fetch. Returns the number of articles stored
+func (f *FeedFetcher) fetchFullArticles(ctx context.Context, feed *Feed) int {
+	ctx, cancel := context.WithTimeout(ctx, fullArticleBudget)
+	defer cancel()
+
+	var items []Item
+	err := f.DB.Select("id", "link").
+		Where("feed_id = ? AND link <> '' AND full_content_fetched_at IS NULL", feed.ID).
+		Order("published_at DESC, id DESC").Limit(fullArticleBatchSize).Find(&items).Error
+	if err != nil {
+		log.Printf("Error loading items for full articles of feed %s: %v", feed.URL, err)
+		return 0
+	}
+
+	stored := 0
+	for _, item := range items {
+		if ctx.Err() != nil {
+			break
+		}
+		content, err := f.fetchArticle(ctx, item.Link)
+		if err != nil && ctx.Err() != nil {
+			// Shutting down or out of time: try the item again next time
+			break
+		}
+		now := f.Now()
+		columns := map[string]interface{}{"full_content_fetched_at": now, "full_content": content, "full_content_error": ""}
+		if err != nil {
+			log.Printf("Error extracting full article %s: %v", item.Link, err)
+			columns["full_content"] = ""
+			columns["full_content_error"] = err.Error()
+		} else {
+			stored++
+		}
+		if err := f.DB.Model(&item).UpdateColumns(columns).Error; err != nil {
+			log.Printf("Error saving full article %s: %v", item.Link, err)
+		}
+	}
+	return stored
+}
+
+// fetchArticle downloads an article page with f.ArticleClient and returns its sanitized main content
+// The request waits for the per-host limits of f.Hosts and is bounded by f.Timeout like feed requests.
+// The feed's HTTP options are not applied, since article links usually point at other hosts
+func (f *FeedFetcher) fetchArticle(ctx context.Context, pageURL string) (string, error) {
+	u, err := url.Parse(pageURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return "", fmt.Errorf("unsupported article link %q", pageURL)
+	}
+	if f.Hosts != nil {
+		host := feedHost(pageURL)
+		if err := f.Hosts.Acquire(ctx, host); err != nil {
+			return "", err
+		}
+		defer f.Hosts.Release(host)
+	}
+	if f.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, f.Timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pageURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", "Gofeed/1.0")
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+	client := f.ArticleClient
+	if client == nil {
+		client = f.Client
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", fmt.Errorf("http error: %s", resp.Status)
+	}
+	contentType := resp.Header.Get("Content-Type")
+	if contentType != "" && !strings.Contains(contentType, "html") {
+		return "", fmt.Errorf("article is %s, not HTML", contentType)
+	}
+
+	body, err := charset.NewReader(io.LimitReader(resp.Body, maxArticleBytes), contentType)
+	if err != nil {
+		return "", err
+	}
+	return extractArticle(body, resp.Request.URL)
+}
+
+// errPrivateAddress is returned for article links that resolve to a non-public address
+var errPrivateAddress = errors.New("article link points to a loopback, private or link-local address")
+
+// newPublicHTTPClient returns an HTTP client that only connects to public addresses. The check runs
+// on the resolved address of every connection, redirects included, so feeds can't make the fetcher
+// reach the local network through DNS names or redirects. It connects directly, without a proxy
+func newPublicHTTPClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !isPublicIP(ip) {
+				return errPrivateAddress
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Transport: transport}
+}
+
+// isPublicIP reports whether ip is a public unicast address
+func isPublicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast())
+}
+
+// extractArticle finds the main content of an HTML page in the style of Readability: page chrome
+// is removed, paragraphs score their parent and grandparent by length and commas, class names and
+// IDs adjust the scores, and the best container wins. Relative links and images are resolved
+// against pageURL and the result is sanitized with SanitizeHTML
+func extractArticle(page io.Reader, pageURL *url.URL) (string, error) {
+	doc, err := goquery.NewDocumentFromReader(page)
+	if err != nil {
+		return "", err
+	}
+	base := pageURL
+	if href, ok := doc.Find("base[href]").First().Attr("href"); ok {
+		if resolved, err := pageURL.Parse(href); err == nil {
+			base = resolved
+		}
+	}
+
+	doc.Find(articleNoiseTags).Remove()
+	doc.Find("[class], [id]").Each(func(_ int, s *goquery.Selection) {
+		if s.Is("html, body, article, main") {
+			return
+		}
+		names := s.AttrOr("class", "") + " " + s.AttrOr("id", "")
+		if articleNegativePattern.MatchString(names) && !articleMaybePattern.MatchString(names) {
+			s.Remove()
+		}
+	})
+
+	scores := map[*html.Node]float64{}
+	var candidates []*goquery.Selection
+	doc.Find("p, pre, td, blockquote").Each(func(_ int, p *goquery.Selection) {
+		text := strings.TrimSpace(p.Text())
+		if len(text) < 25 {
+			return
+		}
+		score := 1 + float64(strings.Count(text, ",")) + math.Min(float64(len(text))/100, 3)
+		for depth, ancestor := range []*goquery.Selection{p.Parent(), p.Parent().Parent()} {
+			if ancestor.Length() == 0 || ancestor.Is("html") {
+				continue
+			}
+			node := ancestor.Get(0)
+			if _, ok := scores[node]; !ok {
+				scores[node] = classWeight(ancestor)
+				candidates = append(candidates, ancestor)
+			}
+			scores[node] += score / float64(depth+1)
+		}
+	})
+
+	var best *goquery.Selection
+	bestScore := 0.0
+	for _, candidate := range candidates {
+		// Favor containers whose text is prose rather than links
+		score := scores[candidate.Get(0)] * (1 - linkDensity(candidate))
+		if best == nil || score > bestScore {
+			best, bestScore = candidate, score
+		}
+	}
+	if best == nil {
+		best = doc.Find("article").First()
+	}
+	if best.Length() == 0 || len(strings.TrimSpace(best.Text())) < minArticleTextLength {
+		return "", errors.New("no article content found")
+	}
+
+	best.Find("a[href]").Each(func(_ int, a *goquery.Selection) {
+		if resolved, err := base.Parse(a.AttrOr("href", "")); err == nil {
+			a.SetAttr("href", resolved.String())
+		}
+	})
+	best.Find("img[src]").Each(func(_ int, img *goquery.Selection) {
+		if resolved, err := base.Parse(img.AttrOr("src", "")); err == nil {
+			img.SetAttr("src", resolved.String())
+		}
+	})
+
+	content, err := best.Html()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(SanitizeHTML(content)), nil
+}
+
+// classWeight scores a container by its class name and ID, as Readability does
+func classWeight(s *goquery.Selection) float64 {
+	weight := 0.0
+	for _, name := range []string{s.AttrOr("class", ""), s.AttrOr("id", "")} {
+		if name == "" {
+			continue
+		}
+		if articleNegativePattern.MatchString(name) {
+			weight -= 25
+		}
+		if articlePositivePattern.MatchString(name) {
+			weight += 25
+		}
+	}
+	if s.Is("article, main") {
+		weight += 25
+	}
+	return weight
+}
+
+// linkDensity returns the share of a container's text that is inside links
+func linkDensity(s *goquery.Selection) float64 {
+	total := len(strings.TrimSpace(s.Text()))
+	if total == 0 {
+		return 0
+	}
+	linked := 0
+	s.Find("a").Each(func(_ int, a *goquery.Selection) {
+		linked += len(strings.TrimSpace(a.Text()))
+	})
+	return float64(linked) / float64(total)
+}
+
+// markFullArticlesForRetry clears the attempts of a feed's items without an article, so the next
+// fetches try them again
+func markFullArticlesForRetry(db *gorm.DB, feedID uint) error {
+	return db.Model(&Item{}).Where("feed_id = ? AND full_content = ''", feedID).
+		UpdateColumns(map[string]interface{}{"full_content_fetched_at": nil, "full_content_error": ""}).Error
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testArticlePage = `<!DOCTYPE html>
+<html><head><title>Story</title><script>var tracking = true;</script></head>
+<body>
+<header class="site-header"><a href="/">Home</a> <a href="/world">World</a></header>
+<nav class="main-nav"><ul><li><a href="/a">Section A</a></li><li><a href="/b">Section B</a></li></ul></nav>
+<div class="layout">
+  <div class="story-body" id="article">
+    <h1>Big news</h1>
+    <p>The first paragraph of the story explains, in some detail, what happened today and why it matters to readers.</p>
+    <p>A second paragraph adds context, quotes a source, and links to <a href="/background">the background piece</a> for more.</p>
+    <p><img src="images/photo.jpg" alt="Photo"></p>
+    <p>The third paragraph wraps up, noting that more updates are expected later, and that officials declined to comment.</p>
+  </div>
+  <div class="sidebar related-links">
+    <p>Related: another story with a long enough headline to be scored, which should not be chosen.</p>
+  </div>
+  <div class="comments">
+    <p>Reader comment that is long enough to look like a paragraph, with commas, commas and more commas.</p>
+  </div>
+</div>
+<footer>Copyright, all rights reserved, by the publisher of this fine website.</footer>
+</body></html>`
+
+func TestExtractArticle(t *testing.T) {
+	pageURL, _ := url.Parse("http://news.example.com/2024/01/story.html")
+	content, err := extractArticle(strings.NewReader(testArticlePage), pageURL)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Contains(t, content, "The first paragraph of the story")
+	assert.Contains(t, content, "officials declined to comment")
+	assert.Contains(t, content, `href="http://news.example.com/background"`, "Should resolve relative links")
+	assert.Contains(t, content, `src="http://news.example.com/2024/01/images/photo.jpg"`, "Should resolve relative images")
+	assert.NotContains(t, content, "Reader comment")
+	assert.NotContains(t, content, "Related:")
+	assert.NotContains(t, content, "Section A")
+	assert.NotContains(t, content, "tracking")
+}
+
+func TestExtractArticle_NoContent(t *testing.T) {
+	pageURL, _ := url.Parse("http://example.com/")
+	_, err := extractArticle(strings.NewReader(`<html><body><nav><a href="/">Home</a></nav><p>Too short.</p></body></html>`), pageURL)
+	assert.EqualError(t, err, "no article content found")
+}
+
+func TestFeedFetcher_FetchFullArticles(t *testing.T) {
+	fetcher, _ := newTestFetcher(t)
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/feed.xml":
+			w.Header().Set("Content-Type", "application/rss+xml")
+			w.Write([]byte(`<?xml version="1.0"?><rss version="2.0"><channel><title>News</title>
+<item><title>Story</title><guid>story</guid><link>` + server.URL + `/story.html</link><description>One-line teaser.</description></item>
+<item><title>Gone</title><guid>gone</guid><link>` + server.URL + `/gone.html</link><description>Another teaser.</description></item>
+</channel></rss>`))
+		case "/story.html":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte(testArticlePage))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	// Without the option, item links are not downloaded
+	feed := Feed{URL: server.URL + "/feed.xml"}
+	fetcher.DB.Create(&feed)
+	_, err := fetcher.Fetch(context.Background(), &feed)
+	assert.NoError(t, err)
+	var story Item
+	fetcher.DB.Where("guid = ?", "story").First(&story)
+	assert.Empty(t, story.FullContent)
+	assert.Nil(t, story.FullContentFetchedAt)
+
+	feed.FetchFullArticle = true
+	feed.ETag, feed.LastModified = "", ""
+	result, err := fetcher.Fetch(context.Background(), &feed)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, result.Articles)
+
+	fetcher.DB.First(&story, story.ID)
+	assert.Contains(t, story.FullContent, "The first paragraph of the story")
+	assert.Equal(t, "One-line teaser.", story.Content, "Should keep the feed's own content")
+	assert.NotNil(t, story.FullContentFetchedAt)
+
+	var gone Item
+	fetcher.DB.Where("guid = ?", "gone").First(&gone)
+	assert.Empty(t, gone.FullContent)
+	assert.Contains(t, gone.FullContentError, "404")
+
+	var attempt FetchAttempt
+	fetcher.DB.Order("id DESC").First(&attempt)
+	assert.Contains(t, attempt.Message, "1 full articles extracted")
+
+	// Tried items are not downloaded again, until a retry is requested
+	result, err = fetcher.Fetch(context.Background(), &feed)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, result.Articles)
+
+	assert.NoError(t, markFullArticlesForRetry(fetcher.DB, feed.ID))
+	var retried Item
+	fetcher.DB.First(&retried, gone.ID)
+	assert.Nil(t, retried.FullContentFetchedAt)
+	assert.Empty(t, retried.FullContentError)
+	fetcher.DB.First(&story, story.ID)
+	assert.NotNil(t, story.FullContentFetchedAt, "Stored articles should not be retried")
+}
+
+func TestFeedFetcher_RefetchesArticleWhenLinkChanges(t *testing.T) {
+	fetcher, _ := newTestFetcher(t)
+	link := "/story.html"
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/feed.xml":
+			w.Header().Set("Content-Type", "application/rss+xml")
+			w.Write([]byte(`<?xml version="1.0"?><rss version="2.0"><channel><title>News</title>
+<item><title>Story</title><guid>story</guid><link>` + server.URL + link + `</link><description>Teaser.</description></item>
+</channel></rss>`))
+		case "/story.html":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte(testArticlePage))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	feed := Feed{URL: server.URL + "/feed.xml", FetchFullArticle: true}
+	fetcher.DB.Create(&feed)
+	_, err := fetcher.Fetch(context.Background(), &feed)
+	assert.NoError(t, err)
+	var story Item
+	fetcher.DB.Where("guid = ?", "story").First(&story)
+	assert.Contains(t, story.FullContent, "The first paragraph of the story")
+
+	link = "/moved.html"
+	feed.ETag, feed.LastModified = "", ""
+	_, err = fetcher.Fetch(context.Background(), &feed)
+	assert.NoError(t, err)
+	var moved Item
+	fetcher.DB.First(&moved, story.ID)
+	assert.Empty(t, moved.FullContent, "Should drop the article of the old link")
+	assert.Contains(t, moved.FullContentError, "404", "Should extract the article of the new link")
+}
+
+func TestFeedFetcher_FetchArticleRefusesPrivateAddresses(t *testing.T) {
+	fetcher, _ := newTestFetcher(t)
+	fetcher.ArticleClient = newPublicHTTPClient()
+	requested := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = true
+		w.Write([]byte(testArticlePage))
+	}))
+	defer server.Close()
+
+	_, err := fetcher.fetchArticle(context.Background(), server.URL+"/story.html")
+	assert.ErrorIs(t, err, errPrivateAddress)
+	assert.False(t, requested)
+}
+
+func TestIsPublicIP(t *testing.T) {
+	tests := map[string]bool{
+		"93.184.216.34":   true,
+		"2606:4700::6810": true,
+		"127.0.0.1":       false,
+		"::1":             false,
+		"10.1.2.3":        false,
+		"172.16.0.1":      false,
+		"192.168.1.1":     false,
+		"169.254.169.254": false,
+		"fe80::1":         false,
+		"fd00::1":         false,
+		"0.0.0.0":         false,
+	}
+	for ip, expected := range tests {
+		assert.Equal(t, expected, isPublicIP(net.ParseIP(ip)), "IP %s", ip)
+	}
+}
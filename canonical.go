@@ -0,0 +1,122 @@
+package main
+
+import (
+	"log"
+	"net/url"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// firstCopyCondition selects items that have no earlier copy (same canonical URL, lower ID) in any feed
+const firstCopyCondition = "(items.canonical_url = '' OR NOT EXISTS (SELECT 1 FROM items AS copies WHERE copies.canonical_url = items.canonical_url AND copies.id < items.id AND copies.deleted_at IS NULL))"
+
+// trackingParams are query parameters that identify a campaign or referrer, not the page
+var trackingParams = map[string]bool{
+	"fbclid": true, "gclid": true, "dclid": true, "msclkid": true, "yclid": true, "igshid": true,
+	"mc_cid": true, "mc_eid": true, "_ga": true, "_hsenc": true, "_hsmi": true,
+	"cmp": true, "cmpid": true, "ocid": true, "smid": true, "s_cid": true, "ito": true,
+	"at_medium": true, "at_campaign": true, "at_custom1": true, "at_custom2": true,
+	"ref": true, "ref_src": true, "xtor": true,
+}
+
+// canonicalizeURL normalizes an item link so copies of a story in different feeds compare equal:
+// the scheme and host are lower-cased, default ports, fragments and tracking parameters
+// (utm_* and those in trackingParams) are removed and the remaining parameters are sorted.
+// Returns "" for anything but an absolute http(s) URL
+func canonicalizeURL(rawURL string) string {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return ""
+	}
+
+	host, port := strings.ToLower(u.Hostname()), u.Port()
+	if (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		port = ""
+	}
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	if port != "" {
+		host += ":" + port
+	}
+	u.Host = host
+	u.User = nil
+	u.Fragment, u.RawFragment = "", ""
+	if u.Path == "" {
+		u.Path = "/"
+	}
+
+	query := u.Query()
+	for key := range query {
+		lower := strings.ToLower(key)
+		if strings.HasPrefix(lower, "utm_") || trackingParams[lower] {
+			query.Del(key)
+		}
+	}
+	u.RawQuery = query.Encode()
+	u.ForceQuery = false
+	return u.String()
+}
+
+// backfillCanonicalURLs computes the canonical URL of items stored before it existed
+// The column is NULL only on those rows, since new items always store a value
+func backfillCanonicalURLs(db *gorm.DB) error {
+	if !db.Migrator().HasColumn(&Item{}, "canonical_url") {
+		return nil
+	}
+	var items []Item
+	filled := 0
+	result := db.Unscoped().Select("id", "link").Where("canonical_url IS NULL").
+		FindInBatches(&items, 500, func(tx *gorm.DB, batch int) error {
+			for _, item := range items {
+				err := db.Unscoped().Model(&Item{}).Where("id = ?", item.ID).
+					UpdateColumn("canonical_url", canonicalizeURL(item.Link)).Error
+				if err != nil {
+					return err
+				}
+			}
+			filled += len(items)
+			return nil
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if filled > 0 {
+		log.Printf("Computed canonical URLs of %d items", filled)
+	}
+	return nil
+}
+
+// duplicateCounts returns, for each canonical URL of items, how many other items share it
+// URLs without copies are left out
+func duplicateCounts(db *gorm.DB, items []Item) (map[string]int64, error) {
+	var urls []string
+	for _, item := range items {
+		if item.CanonicalURL != "" {
+			urls = append(urls, item.CanonicalURL)
+		}
+	}
+	counts := map[string]int64{}
+	if len(urls) == 0 {
+		return counts, nil
+	}
+	var rows []struct {
+		CanonicalURL string
+		Copies       int64
+	}
+	err := db.Model(&Item{}).Select("canonical_url, COUNT(*) AS copies").
+		Where("canonical_url IN ?", urls).Group("canonical_url").Having("COUNT(*) > 1").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		counts[row.CanonicalURL] = row.Copies - 1
+	}
+	return counts, nil
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/mmcdole/gofeed"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// itemCategory is a row of the item_categories join table between Item and Category
+type itemCategory struct {
+	ItemID     uint
+	CategoryID uint
+}
+
+// CategoryCount is a category with the number of items filed under it
+type CategoryCount struct {
+	ID        uint
+	Name      string
+	Key       string
+	ItemCount int64
+}
+
+// categoryCondition selects items filed under the category with the given key
+const categoryCondition = "EXISTS (SELECT 1 FROM item_categories JOIN categories ON categories.id = item_categories.category_id WHERE item_categories.item_id = items.id AND categories.key = ?)"
+
+// normalizeCategory collapses whitespace in a category name and returns it with its lookup key
+// (the lower-cased name); both are "" for a blank name
+func normalizeCategory(name string) (string, string) {
+	name = strings.Join(strings.Fields(name), " ")
+	return name, strings.ToLower(name)
+}
+
+// buildCategories returns the distinct categories of a parsed item, in feed order
+func buildCategories(item *gofeed.Item) []Category {
+	var categories []Category
+	seen := map[string]bool{}
+	for _, raw := range item.Categories {
+		name, key := normalizeCategory(raw)
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		categories = append(categories, Category{Name: name, Key: key})
+	}
+	return categories
+}
+
+// storedItemIDs maps the GUIDs of rows to the IDs of the matching items of a feed
+// Rows that were not stored (e.g. too old to keep) are missing from the map
+func storedItemIDs(tx *gorm.DB, feedID uint, rows []Item) (map[string]uint, []uint, error) {
+	guids := make([]string, len(rows))
+	for i, row := range rows {
+		guids[i] = row.GUID
+	}
+	var stored []Item
+	if err := tx.Select("id", "guid").Where("feed_id = ? AND guid IN ?", feedID, guids).Find(&stored).Error; err != nil {
+		return nil, nil, err
+	}
+	idByGUID := make(map[string]uint, len(stored))
+	ids := make([]uint, len(stored))
+	for i, item := range stored {
+		idByGUID[item.GUID] = item.ID
+		ids[i] = item.ID
+	}
+	return idByGUID, ids, nil
+}
+
+// syncCategories files the stored items of rows under their categories, creating missing
+// categories and replacing the links of items whose categories changed
+func syncCategories(tx *gorm.DB, feedID uint, rows []Item) error {
+	idByGUID, ids, err := storedItemIDs(tx, feedID, rows)
+	if err != nil || len(ids) == 0 {
+		return err
+	}
+
+	var keys []string
+	names := map[string]string{}
+	for _, row := range rows {
+		for _, category := range row.Categories {
+			if _, ok := names[category.Key]; !ok {
+				keys = append(keys, category.Key)
+				names[category.Key] = category.Name
+			}
+		}
+	}
+	categoryIDs := map[string]uint{}
+	if len(keys) > 0 {
+		created := make([]Category, len(keys))
+		for i, key := range keys {
+			created[i] = Category{Name: names[key], Key: key}
+		}
+		// The first spelling seen is kept as the display name
+		if err := tx.Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "key"}}, DoNothing: true}).Create(&created).Error; err != nil {
+			return err
+		}
+		var categories []Category
+		if err := tx.Where("key IN ?", keys).Find(&categories).Error; err != nil {
+			return err
+		}
+		for _, category := range categories {
+			categoryIDs[category.Key] = category.ID
+		}
+	}
+
+	var existing []itemCategory
+	if err := tx.Table("item_categories").Where("item_id IN ?", ids).Find(&existing).Error; err != nil {
+		return err
+	}
+	existingByItem := map[uint]map[uint]bool{}
+	for _, link := range existing {
+		if existingByItem[link.ItemID] == nil {
+			existingByItem[link.ItemID] = map[uint]bool{}
+		}
+		existingByItem[link.ItemID][link.CategoryID] = true
+	}
+
+	var replaced []uint
+	var created []itemCategory
+	for _, row := range rows {
+		id, ok := idByGUID[row.GUID]
+		if !ok {
+			continue
+		}
+		wanted := map[uint]bool{}
+		for _, category := range row.Categories {
+			wanted[categoryIDs[category.Key]] = true
+		}
+		if sameCategoryIDs(existingByItem[id], wanted) {
+			continue
+		}
+		replaced = append(replaced, id)
+		for categoryID := range wanted {
+			created = append(created, itemCategory{ItemID: id, CategoryID: categoryID})
+		}
+	}
+
+	if len(replaced) > 0 {
+		if err := tx.Table("item_categories").Where("item_id IN ?", replaced).Delete(&itemCategory{}).Error; err != nil {
+			return err
+		}
+	}
+	if len(created) > 0 {
+		if err := tx.Table("item_categories").CreateInBatches(&created, 100).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sameCategoryIDs reports whether two sets of category IDs are equal
+func sameCategoryIDs(a, b map[uint]bool) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for id := range a {
+		if !b[id] {
+			return false
+		}
+	}
+	return true
+}
+
+// categoryCounts returns the categories that have items, with their item counts, most used first
+func categoryCounts(db *gorm.DB) ([]CategoryCount, error) {
+	var counts []CategoryCount
+	err := db.Model(&Category{}).
+		Select("categories.id, categories.name, categories.key, COUNT(items.id) AS item_count").
+		Joins("JOIN item_categories ON item_categories.category_id = categories.id").
+		Joins("JOIN items ON items.id = item_categories.item_id AND items.deleted_at IS NULL").
+		Group("categories.id, categories.name, categories.key").
+		Order("item_count DESC, categories.name").
+		Scan(&counts).Error
+	return counts, err
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mmcdole/gofeed"
+	"github.com/stretchr/testify/assert"
+)
+
+const testCategoriesRSS = `<?xml version="1.0"?>
+<rss version="2.0"><channel><title>News</title>
+<item><title>Election</title><guid>election</guid><category>Politics</category><category>World  News</category><category>politics</category></item>
+<item><title>Match</title><guid>match</guid><category>Sport</category></item>
+<item><title>Summit</title><guid>summit</guid><category>world news</category></item>
+<item><title>Weather</title><guid>weather</guid></item>
+</channel></rss>`
+
+func TestBuildCategories(t *testing.T) {
+	item := &gofeed.Item{Categories: []string{" Politics ", "World\n News", "POLITICS", "", "  "}}
+	assert.Equal(t, []Category{
+		{Name: "Politics", Key: "politics"},
+		{Name: "World News", Key: "world news"},
+	}, buildCategories(item), "Should collapse whitespace and drop blank and case-insensitive duplicates")
+}
+
+func TestFeedFetcher_FetchStoresCategories(t *testing.T) {
+	fetcher, _ := newTestFetcher(t)
+	body := testCategoriesRSS
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/rss+xml")
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	feed := Feed{URL: server.URL}
+	fetcher.DB.Create(&feed)
+	_, err := fetcher.Fetch(context.Background(), &feed)
+	assert.NoError(t, err)
+
+	var categories []Category
+	fetcher.DB.Order("id").Find(&categories)
+	assert.Equal(t, []Category{
+		{ID: 1, Name: "Politics", Key: "politics"},
+		{ID: 2, Name: "World News", Key: "world news"},
+		{ID: 3, Name: "Sport", Key: "sport"},
+	}, categories, "Categories should be shared between items regardless of case")
+
+	var election Item
+	fetcher.DB.Preload("Categories").Where("guid = ?", "election").First(&election)
+	assert.Len(t, election.Categories, 2)
+
+	// Filtering by several categories keeps the items filed under all of them
+	var inWorldNews, inBoth []Item
+	fetcher.DB.Where(categoryCondition, "world news").Order("id").Find(&inWorldNews)
+	fetcher.DB.Where(categoryCondition, "world news").Where(categoryCondition, "politics").Find(&inBoth)
+	if assert.Len(t, inWorldNews, 2) {
+		assert.Equal(t, "election", inWorldNews[0].GUID)
+		assert.Equal(t, "summit", inWorldNews[1].GUID)
+	}
+	if assert.Len(t, inBoth, 1) {
+		assert.Equal(t, "election", inBoth[0].GUID)
+	}
+
+	counts, err := categoryCounts(fetcher.DB)
+	assert.NoError(t, err)
+	if assert.Len(t, counts, 3) {
+		assert.Equal(t, "World News", counts[0].Name)
+		assert.Equal(t, int64(2), counts[0].ItemCount)
+		assert.Equal(t, "Politics", counts[1].Name, "Ties should be sorted by name")
+		assert.Equal(t, int64(1), counts[1].ItemCount)
+	}
+
+	// A recategorized item is relinked without counting as an edit
+	body = strings.Replace(testCategoriesRSS, "<category>Sport</category>", "<category>Football</category>", 1)
+	feed.ETag, feed.LastModified = "", ""
+	result, err := fetcher.Fetch(context.Background(), &feed)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, result.Updated)
+
+	var match Item
+	fetcher.DB.Preload("Categories").Where("guid = ?", "match").First(&match)
+	if assert.Len(t, match.Categories, 1) {
+		assert.Equal(t, "Football", match.Categories[0].Name)
+	}
+
+	counts, err = categoryCounts(fetcher.DB)
+	assert.NoError(t, err)
+	for _, count := range counts {
+		assert.NotEqual(t, "Sport", count.Name, "Categories without items should not be listed")
+	}
+}
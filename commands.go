@@ -2,10 +2,17 @@ package main
 
 import (
 	"bufio"
+	"context"
+	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"os/signal"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
@@ -120,9 +127,9 @@ func SeedFeedsWithURLs(feedURLs []string) SeedFeedsResult {
 	result := SeedFeedsResult{}
 
 	for _, feedURL := range feedURLs {
-		var feed Feed
-		dbResult := DB.Where("url = ?", feedURL).First(&feed)
-		if dbResult.Error == gorm.ErrRecordNotFound {
+		// Feeds that moved away from a default URL still count as existing
+		_, err := findFeedByURL(DB, feedURL, 0)
+		if err == gorm.ErrRecordNotFound {
 			feed := Feed{URL: feedURL}
 			if err := DB.Create(&feed).Error; err != nil {
 				log.Printf("Failed to create feed %s: %v", feedURL, err)
@@ -131,8 +138,8 @@ func SeedFeedsWithURLs(feedURLs []string) SeedFeedsResult {
 				log.Printf("Feed created: %s", feedURL)
 				result.Created++
 			}
-		} else if dbResult.Error != nil {
-			log.Printf("Failed to check for existing feed %s: %v", feedURL, dbResult.Error)
+		} else if err != nil {
+			log.Printf("Failed to check for existing feed %s: %v", feedURL, err)
 			result.Errors++
 		} else {
 			log.Printf("Feed already exists: %s", feedURL)
@@ -153,7 +160,7 @@ func CommandMigrate() {
 	}
 
 	// Run AutoMigrate for all models
-	err = db.AutoMigrate(&User{}, &Feed{}, &Item{})
+	err = AutoMigrateAll(db)
 	if err != nil {
 		log.Fatalf("Failed to migrate database: %v", err)
 	}
@@ -245,11 +252,76 @@ func CommandCreateDB() {
 func CommandFetchFeeds() {
 	ConnectDatabase()
 
+	// Cancel in-flight requests on Ctrl+C instead of leaving half-processed feeds
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	log.Println("Starting feed fetch...")
-	itemsCreated, itemsUpdated, errors := processAllFeeds()
+	itemsCreated, itemsUpdated, errors := processAllFeeds(ctx)
 	log.Printf("Feed fetch completed: %d items created, %d items updated, %d errors", itemsCreated, itemsUpdated, errors)
 }
 
+// CommandPruneItems deletes items according to the retention rules
+// With --dry-run it only reports what would be deleted
+func CommandPruneItems() {
+	flags := flag.NewFlagSet("prune-items", flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", false, "report what would be deleted without deleting anything")
+	flags.Parse(os.Args[2:])
+
+	ConnectDatabase()
+
+	report, err := pruneItems(DB, time.Now(), *dryRun)
+	if err != nil {
+		log.Fatalf("Failed to prune items: %v", err)
+	}
+	printPruneReport(os.Stdout, report, *dryRun)
+}
+
+// printPruneReport writes a per-feed summary of an item retention run
+func printPruneReport(w io.Writer, report ItemPruneReport, dryRun bool) {
+	verb := "Deleted"
+	if dryRun {
+		verb = "Would delete"
+	}
+	for _, feed := range report.Feeds {
+		fmt.Fprintf(w, "%s %d items from feed %d (%s): %d older than max age, %d over the per-feed limit\n",
+			verb, feed.Expired+feed.OverLimit, feed.FeedID, feed.FeedURL, feed.Expired, feed.OverLimit)
+	}
+	fmt.Fprintf(w, "%s %d items in total\n", verb, report.Total)
+}
+
+// CommandDiagnoseFeed downloads a feed, given its ID or URL, and prints the problems found in it
+// Exits with status 1 if any finding is an error
+func CommandDiagnoseFeed() {
+	if len(os.Args) < 3 {
+		log.Fatal("Usage: diagnose-feed <id|url>")
+	}
+	arg := os.Args[2]
+
+	ConnectDatabase()
+
+	// Unknown URLs are diagnosed without HTTP options, so feeds can be checked before adding them
+	feed := Feed{URL: arg}
+	if id, err := strconv.ParseUint(arg, 10, 64); err == nil {
+		if err := DB.First(&feed, id).Error; err != nil {
+			log.Fatalf("Feed %d not found: %v", id, err)
+		}
+	} else if existing, err := findFeedByURL(DB, arg, 0); err == nil {
+		feed = *existing
+	} else if err := ValidateStruct(FeedInput{URL: arg}); err != nil {
+		log.Fatalf("Invalid feed URL: %s", FormatValidationErrors(err))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	report := NewFeedFetcher(DB).Diagnose(ctx, feed)
+	printDiagnostics(os.Stdout, report)
+	if report.Count(SeverityError) > 0 {
+		os.Exit(1)
+	}
+}
+
 // CommandExecuteSQL executes a SQL query from command line
 func CommandExecuteSQL() {
 	ConnectDatabase()
@@ -70,19 +70,177 @@ func GetBackgroundFetchEnabled() bool {
 	return value == "true" || value == "1" || value == "yes" || value == "on"
 }
 
-// GetBackgroundFetchInterval returns the background fetch interval in seconds
-// Returns 60 by default if the variable is not set or invalid
-func GetBackgroundFetchInterval() int {
-	value := os.Getenv("BACKGROUND_FETCH_INTERVAL")
+// getPositiveIntEnv returns the value of an environment variable parsed as a positive integer
+// Returns defaultValue if the variable is not set or invalid
+func getPositiveIntEnv(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	parsed, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || parsed <= 0 {
+		log.Printf("Warning: Invalid %s value '%s', using default %d", key, value, defaultValue)
+		return defaultValue
+	}
+	return parsed
+}
+
+// getNonNegativeIntEnv returns the value of an environment variable parsed as a non-negative integer
+// Returns defaultValue if the variable is not set or invalid
+func getNonNegativeIntEnv(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	parsed, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || parsed < 0 {
+		log.Printf("Warning: Invalid %s value '%s', using default %d", key, value, defaultValue)
+		return defaultValue
+	}
+	return parsed
+}
+
+// getBoolEnv returns the value of an environment variable parsed as a boolean
+// Returns defaultValue if the variable is not set or empty
+func getBoolEnv(key string, defaultValue bool) bool {
+	value := os.Getenv(key)
 	if value == "" {
-		return 60
+		return defaultValue
 	}
-	interval, err := strconv.Atoi(strings.TrimSpace(value))
-	if err != nil || interval <= 0 {
-		log.Printf("Warning: Invalid BACKGROUND_FETCH_INTERVAL value '%s', using default 60 seconds", value)
-		return 60
+	value = strings.ToLower(strings.TrimSpace(value))
+	return value == "true" || value == "1" || value == "yes" || value == "on"
+}
+
+// GetBackgroundFetchInterval returns the default per-feed fetch interval in seconds
+// Returns 60 by default if the variable is not set or invalid
+func GetBackgroundFetchInterval() int {
+	return getPositiveIntEnv("BACKGROUND_FETCH_INTERVAL", 60)
+}
+
+// GetSchedulerTick returns how often (in seconds) the scheduler checks for due feeds
+// Returns 30 by default if the variable is not set or invalid
+func GetSchedulerTick() int {
+	return getPositiveIntEnv("FETCH_SCHEDULER_TICK", 30)
+}
+
+// GetAdaptiveFetchEnabled returns whether per-feed fetch intervals adapt to how often new items appear
+// Returns true by default if the variable is not set or empty
+func GetAdaptiveFetchEnabled() bool {
+	return getBoolEnv("FETCH_ADAPTIVE_ENABLED", true)
+}
+
+// GetFetchIntervalBounds returns the minimum and maximum adaptive fetch intervals in seconds
+// Defaults to 300 (5 minutes) and 86400 (1 day)
+func GetFetchIntervalBounds() (minInterval, maxInterval int) {
+	minInterval = getPositiveIntEnv("FETCH_INTERVAL_MIN", 300)
+	maxInterval = getPositiveIntEnv("FETCH_INTERVAL_MAX", 86400)
+	if maxInterval < minInterval {
+		log.Printf("Warning: FETCH_INTERVAL_MAX (%d) is less than FETCH_INTERVAL_MIN (%d), using FETCH_INTERVAL_MIN", maxInterval, minInterval)
+		maxInterval = minInterval
 	}
-	return interval
+	return minInterval, maxInterval
+}
+
+// GetFailurePauseThreshold returns the number of consecutive failed fetches after which a feed is paused
+// Returns 10 by default if the variable is not set or invalid
+func GetFailurePauseThreshold() int {
+	return getPositiveIntEnv("FETCH_FAILURE_PAUSE_THRESHOLD", 10)
+}
+
+// GetMaxBackoff returns the maximum retry delay in seconds for failing feeds
+// Returns 86400 (1 day) by default if the variable is not set or invalid
+func GetMaxBackoff() int {
+	return getPositiveIntEnv("FETCH_BACKOFF_MAX", 86400)
+}
+
+// GetFetchAttemptRetentionDays returns how many days of fetch attempts are kept
+// Returns 30 by default if the variable is not set or invalid
+func GetFetchAttemptRetentionDays() int {
+	return getPositiveIntEnv("FETCH_ATTEMPT_RETENTION_DAYS", 30)
+}
+
+// GetFetchWorkers returns the number of feeds fetched concurrently
+// Returns 10 by default if the variable is not set or invalid
+func GetFetchWorkers() int {
+	return getPositiveIntEnv("FETCH_WORKERS", 10)
+}
+
+// GetHostConcurrency returns the maximum number of concurrent requests to a single host
+// Returns 2 by default if the variable is not set or invalid
+func GetHostConcurrency() int {
+	return getPositiveIntEnv("FETCH_HOST_CONCURRENCY", 2)
+}
+
+// GetHostMinDelay returns the minimum delay in milliseconds between the starts of two requests to a single host
+// Returns 1000 by default if the variable is not set or invalid; 0 disables the delay
+func GetHostMinDelay() int {
+	return getNonNegativeIntEnv("FETCH_HOST_MIN_DELAY_MS", 1000)
+}
+
+// GetFetchTimeout returns the timeout in seconds for a single feed request, including reading the body
+// Returns 30 by default if the variable is not set or invalid
+func GetFetchTimeout() int {
+	return getPositiveIntEnv("FETCH_TIMEOUT", 30)
+}
+
+// GetFetchJobLease returns how long in seconds a worker leases a fetch job before other workers may reclaim it
+// Returns 300 by default if the variable is not set or invalid
+func GetFetchJobLease() int {
+	return getPositiveIntEnv("FETCH_JOB_LEASE", 300)
+}
+
+// GetRedirectThreshold returns after how many consecutive permanently redirected fetches a feed's URL is updated
+// Returns 3 by default if the variable is not set or invalid
+func GetRedirectThreshold() int {
+	return getPositiveIntEnv("FETCH_REDIRECT_THRESHOLD", 3)
+}
+
+// GetWorkerHealthAddr returns the address the worker process serves its /healthz endpoint on
+// Returns ":8083" by default if the variable is not set
+func GetWorkerHealthAddr() string {
+	return getEnvOrDefault("WORKER_HEALTH_ADDR", ":8083")
+}
+
+// GetShutdownTimeout returns how long (in seconds) the server and background fetcher may take to drain on shutdown
+// Returns 30 by default if the variable is not set or invalid
+func GetShutdownTimeout() int {
+	return getPositiveIntEnv("SHUTDOWN_TIMEOUT", 30)
+}
+
+// GetItemMaxAgeDays returns how many days items are kept, based on their publication date
+// Returns 0 (keep forever) by default if the variable is not set or invalid
+func GetItemMaxAgeDays() int {
+	return getNonNegativeIntEnv("ITEM_MAX_AGE_DAYS", 0)
+}
+
+// GetStoryClusterDistance returns how many of the 64 fingerprint bits two items from different feeds may differ in to count as the same story
+// Returns 6 by default if the variable is not set or invalid; 0 disables story clustering
+func GetStoryClusterDistance() int {
+	return getNonNegativeIntEnv("STORY_CLUSTER_DISTANCE", 6)
+}
+
+// GetItemKeepPerFeed returns how many of the newest items are kept per feed, unless the feed overrides it
+// Returns 0 (no limit) by default if the variable is not set or invalid
+func GetItemKeepPerFeed() int {
+	return getNonNegativeIntEnv("ITEM_KEEP_PER_FEED", 0)
+}
+
+// GetWebSubCallbackBaseURL returns the public base URL hubs use to reach the WebSub callback
+// Returns "" (WebSub disabled) by default
+func GetWebSubCallbackBaseURL() string {
+	return strings.TrimRight(strings.TrimSpace(os.Getenv("WEBSUB_CALLBACK_BASE_URL")), "/")
+}
+
+// GetWebSubLeaseSeconds returns the lease length requested from WebSub hubs in seconds
+// Returns 864000 (10 days) by default if the variable is not set or invalid
+func GetWebSubLeaseSeconds() int {
+	return getPositiveIntEnv("WEBSUB_LEASE_SECONDS", 864000)
+}
+
+// GetSecretsKey returns the key feed credentials are encrypted with at rest
+// Returns "" by default; feed credentials can't be stored until it is set
+func GetSecretsKey() string {
+	return os.Getenv("FEED_SECRETS_KEY")
 }
 
 // IsCypressMode returns whether the application is running in Cypress mode
@@ -30,3 +30,42 @@ func ConnectDatabase() {
 	})
 }
 
+// AutoMigrateAll creates or updates tables for all models
+func AutoMigrateAll(db *gorm.DB) error {
+	if err := removeDuplicateItems(db); err != nil {
+		return err
+	}
+	if err := db.AutoMigrate(&User{}, &Feed{}, &Item{}, &ItemRevision{}, &Enclosure{}, &Category{}, &StoryCluster{}, &FetchAttempt{}, &WebSubSubscription{}, &FeedURLHistory{}, &FeedHTTPOptions{}, &FetchJob{}, &FetchWorkerHeartbeat{}); err != nil {
+		return err
+	}
+	if err := encryptWebSubSecrets(db); err != nil {
+		return err
+	}
+	if err := createStoryClusterIndex(db); err != nil {
+		return err
+	}
+	if err := backfillCanonicalURLs(db); err != nil {
+		return err
+	}
+	if err := backfillSourceGUIDs(db); err != nil {
+		return err
+	}
+	return repairEmptyGUIDs(db)
+}
+
+// removeDuplicateItems deletes items sharing a (feed_id, guid) pair, keeping the newest one,
+// so the unique index idx_items_feed_guid can be created on databases that predate it
+func removeDuplicateItems(db *gorm.DB) error {
+	migrator := db.Migrator()
+	if !migrator.HasTable(&Item{}) || migrator.HasIndex(&Item{}, "idx_items_feed_guid") {
+		return nil
+	}
+	result := db.Exec("DELETE FROM items WHERE id NOT IN (SELECT MAX(id) FROM items GROUP BY feed_id, guid)")
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("Removed %d duplicate items before adding the unique (feed_id, guid) index", result.RowsAffected)
+	}
+	return nil
+}
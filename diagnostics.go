@@ -0,0 +1,361 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mmcdole/gofeed"
+	"golang.org/x/net/html/charset"
+)
+
+// DiagnosticSeverity ranks a diagnostics finding
+type DiagnosticSeverity string
+
+const (
+	SeverityError   DiagnosticSeverity = "error"   // Items are lost or the feed cannot be read
+	SeverityWarning DiagnosticSeverity = "warning" // Items are stored, but not as the publisher intended
+	SeverityInfo    DiagnosticSeverity = "info"    // Worth knowing, nothing is wrong
+)
+
+const (
+	// diagnosticMaxFeedBytes is the feed size above which the download is reported as oversized
+	diagnosticMaxFeedBytes = 2 << 20
+	// diagnosticMaxItemBytes is the description plus content size above which an item is reported as oversized
+	diagnosticMaxItemBytes = 100 << 10
+	// diagnosticFutureTolerance allows for clock skew before a date counts as in the future
+	diagnosticFutureTolerance = time.Hour
+	// diagnosticStripWarnRatio is the share of an item's HTML removed by SanitizeHTML above which it is reported
+	diagnosticStripWarnRatio = 0.5
+	// diagnosticMaxExamples is how many affected items a finding lists
+	diagnosticMaxExamples = 3
+)
+
+// xmlEncodingPattern matches the encoding of an XML declaration
+var xmlEncodingPattern = regexp.MustCompile(`^<\?xml[^>]*\sencoding\s*=\s*["']([^"']+)["']`)
+
+// DiagnosticFinding is a single problem found in a feed
+type DiagnosticFinding struct {
+	Severity DiagnosticSeverity
+	Check    string   // Short name of the check, e.g. "duplicate-guid"
+	Message  string   // What was found and what it means for stored items
+	Examples []string // Some of the affected items, if the finding concerns items
+}
+
+// FeedDiagnostics is the report of diagnosing a feed
+type FeedDiagnostics struct {
+	URL           string
+	CheckedAt     time.Time
+	HTTPStatus    int
+	ContentType   string
+	Bytes         int64
+	RedirectChain string
+	FeedType      string
+	Title         string
+	ItemCount     int
+	Findings      []DiagnosticFinding // Errors first, then warnings, then info
+}
+
+// Count returns how many findings have the given severity
+func (d *FeedDiagnostics) Count(severity DiagnosticSeverity) int {
+	count := 0
+	for _, finding := range d.Findings {
+		if finding.Severity == severity {
+			count++
+		}
+	}
+	return count
+}
+
+// add records a finding; examples are trimmed to diagnosticMaxExamples
+func (d *FeedDiagnostics) add(severity DiagnosticSeverity, check, message string, examples []string) {
+	if len(examples) > diagnosticMaxExamples {
+		examples = examples[:diagnosticMaxExamples]
+	}
+	d.Findings = append(d.Findings, DiagnosticFinding{Severity: severity, Check: check, Message: message, Examples: examples})
+}
+
+// Diagnose downloads a feed with its HTTP options, ignoring the conditional request headers,
+// and reports problems in the response, its encoding and its items. Nothing is saved, and
+// download and parse failures are reported as findings rather than returned
+func (f *FeedFetcher) Diagnose(ctx context.Context, feed Feed) *FeedDiagnostics {
+	report := &FeedDiagnostics{URL: feed.URL, CheckedAt: f.Now()}
+
+	feed.ETag, feed.LastModified = "", ""
+	var attempt FetchAttempt
+	body, header, _, err := f.downloadBody(ctx, &feed, &attempt)
+	report.HTTPStatus = attempt.HTTPStatus
+	report.Bytes = attempt.Bytes
+	report.RedirectChain = attempt.RedirectChain
+	if header != nil {
+		report.ContentType = header.Get("Content-Type")
+	}
+	if err != nil {
+		report.add(SeverityError, "fetch", fmt.Sprintf("The feed could not be downloaded: %v", err), nil)
+		return report
+	}
+	if attempt.PermanentRedirect != "" {
+		report.add(SeverityInfo, "redirect", fmt.Sprintf("The feed permanently redirects to %s", attempt.PermanentRedirect), nil)
+	}
+	if len(body) > diagnosticMaxFeedBytes {
+		report.add(SeverityWarning, "feed-size", fmt.Sprintf("The feed is %d KB; every fetch downloads it in full", len(body)>>10), nil)
+	}
+
+	diagnoseCharset(report, header, body)
+
+	parsedFeed, err := gofeed.NewParser().Parse(bytes.NewReader(body))
+	if err != nil {
+		report.add(SeverityError, "parse", fmt.Sprintf("The feed could not be parsed: %v", err), nil)
+		report.sortFindings()
+		return report
+	}
+	report.FeedType = strings.TrimSpace(parsedFeed.FeedType + " " + parsedFeed.FeedVersion)
+	report.Title = parsedFeed.Title
+	report.ItemCount = len(parsedFeed.Items)
+	if parsedFeed.Title == "" {
+		report.add(SeverityWarning, "feed-title", "The feed has no title; it is listed by its URL", nil)
+	}
+	if len(parsedFeed.Items) == 0 {
+		report.add(SeverityInfo, "no-items", "The feed has no items", nil)
+	}
+
+	diagnoseItems(report, &feed, parsedFeed.Items, f.Now())
+	report.sortFindings()
+	return report
+}
+
+// diagnoseCharset checks the byte order mark, the declared encodings and, for UTF-8, that the body is valid
+// The XML declaration decides how the feed is decoded; the Content-Type charset is ignored by the parser
+func diagnoseCharset(report *FeedDiagnostics, header http.Header, body []byte) {
+	if bytes.HasPrefix(body, []byte("\xef\xbb\xbf")) {
+		report.add(SeverityInfo, "charset", "The feed starts with a UTF-8 byte order mark", nil)
+		body = body[3:]
+	}
+
+	headerCharset := ""
+	if header != nil {
+		if _, params, err := mime.ParseMediaType(header.Get("Content-Type")); err == nil {
+			headerCharset = params["charset"]
+		}
+	}
+	xmlEncoding := ""
+	if match := xmlEncodingPattern.FindSubmatch(bytes.TrimLeft(body, " \t\r\n")); match != nil {
+		xmlEncoding = string(match[1])
+	}
+
+	for _, label := range []string{xmlEncoding, headerCharset} {
+		if label != "" && canonicalCharset(label) == "" {
+			report.add(SeverityError, "charset", fmt.Sprintf("Unknown charset %q", label), nil)
+			return
+		}
+	}
+	if xmlEncoding != "" && headerCharset != "" && canonicalCharset(xmlEncoding) != canonicalCharset(headerCharset) {
+		report.add(SeverityWarning, "charset", fmt.Sprintf(
+			"The Content-Type charset %q differs from the XML declaration's encoding %q; the feed is decoded as %s",
+			headerCharset, xmlEncoding, xmlEncoding), nil)
+	}
+
+	effective := "utf-8"
+	if xmlEncoding != "" {
+		effective = canonicalCharset(xmlEncoding)
+	} else if headerCharset != "" && canonicalCharset(headerCharset) != "utf-8" {
+		report.add(SeverityWarning, "charset", fmt.Sprintf(
+			"The Content-Type declares %q but the feed has no XML encoding declaration; it is decoded as UTF-8", headerCharset), nil)
+	}
+
+	if effective != "utf-8" {
+		report.add(SeverityInfo, "charset", fmt.Sprintf("The feed is encoded as %s and converted to UTF-8 when parsed", effective), nil)
+		return
+	}
+	if !utf8.Valid(body) {
+		invalid := 0
+		for rest := body; len(rest) > 0; {
+			r, size := utf8.DecodeRune(rest)
+			if r == utf8.RuneError && size == 1 {
+				invalid++
+			}
+			rest = rest[size:]
+		}
+		report.add(SeverityError, "charset", fmt.Sprintf(
+			"The feed is decoded as UTF-8 but contains %d invalid bytes; declare its real encoding in the XML declaration", invalid), nil)
+	}
+}
+
+// canonicalCharset returns the canonical name of a charset label, or "" if it is unknown
+func canonicalCharset(label string) string {
+	_, name := charset.Lookup(label)
+	return name
+}
+
+// diagnoseItems checks item identifiers under the feed's identity strategy, links, dates, content size
+// and how much HTML SanitizeHTML removes
+func diagnoseItems(report *FeedDiagnostics, feed *Feed, items []*gofeed.Item, now time.Time) {
+	var noGUID, hashed, noLink, badDates, futureDates, undated, oversized, stripped, garbled []string
+	guidCounts := map[string]int{}
+	var duplicates []string
+	rawBytes, sanitizedBytes := 0, 0
+	strategy := feed.IdentityStrategy()
+
+	for i, item := range items {
+		name := diagnosticItemName(i, item)
+
+		hasGUID, hasLink := strings.TrimSpace(item.GUID) != "", strings.TrimSpace(item.Link) != ""
+		switch {
+		case strategy == ItemIdentityHash:
+		case strategy == ItemIdentityLink && !hasLink, strategy == ItemIdentityGUID && !hasGUID && !hasLink:
+			hashed = append(hashed, name)
+		case strategy == ItemIdentityGUID && !hasGUID:
+			noGUID = append(noGUID, name)
+		}
+		guid := parsedItemIdentity(feed, item)
+		guidCounts[guid]++
+		if guidCounts[guid] == 2 {
+			duplicates = append(duplicates, guid)
+		}
+		if item.Link == "" {
+			noLink = append(noLink, name)
+		}
+
+		if (item.Published != "" && item.PublishedParsed == nil) || (item.Updated != "" && item.UpdatedParsed == nil) {
+			badDates = append(badDates, fmt.Sprintf("%s (%q)", name, firstNonEmpty(item.Published, item.Updated)))
+		}
+		for _, date := range []*time.Time{item.PublishedParsed, item.UpdatedParsed} {
+			if date != nil && date.After(now.Add(diagnosticFutureTolerance)) {
+				futureDates = append(futureDates, fmt.Sprintf("%s (%s)", name, date.Format(time.RFC3339)))
+				break
+			}
+		}
+		if item.Published == "" && item.Updated == "" {
+			undated = append(undated, name)
+		}
+
+		raw := len(item.Description) + len(getItemContent(item))
+		if raw > diagnosticMaxItemBytes {
+			oversized = append(oversized, fmt.Sprintf("%s (%d KB)", name, raw>>10))
+		}
+		sanitized := len(SanitizeHTML(item.Description)) + len(SanitizeHTML(getItemContent(item)))
+		rawBytes += raw
+		sanitizedBytes += min(sanitized, raw)
+		if raw > 0 && float64(raw-min(sanitized, raw))/float64(raw) > diagnosticStripWarnRatio {
+			stripped = append(stripped, name)
+		}
+
+		if strings.ContainsRune(item.Title+item.Description+getItemContent(item), utf8.RuneError) {
+			garbled = append(garbled, name)
+		}
+	}
+
+	if len(hashed) > 0 {
+		missing := "neither a GUID nor a link"
+		if strategy == ItemIdentityLink {
+			missing = "no link"
+		}
+		report.add(SeverityWarning, "missing-guid", fmt.Sprintf(
+			"%d items have %s; they are identified by a hash of their title, date and content, so an edited item is stored as a new one", len(hashed), missing), hashed)
+	}
+	if len(duplicates) > 0 {
+		report.add(SeverityError, "duplicate-guid", fmt.Sprintf(
+			"%d identifiers (%s) are used by more than one item; only the last item with each is kept", len(duplicates), strategy), duplicates)
+	}
+	if len(noGUID) > 0 {
+		report.add(SeverityWarning, "missing-guid", fmt.Sprintf(
+			"%d items have no GUID; their link is used instead, so a changed link creates a new item", len(noGUID)), noGUID)
+	}
+	if len(noLink) > 0 {
+		report.add(SeverityWarning, "missing-link", fmt.Sprintf("%d items have no link", len(noLink)), noLink)
+	}
+	if len(badDates) > 0 {
+		report.add(SeverityWarning, "unparseable-date", fmt.Sprintf(
+			"%d items have dates that could not be parsed; they are stored without a date", len(badDates)), badDates)
+	}
+	if len(futureDates) > 0 {
+		report.add(SeverityWarning, "future-date", fmt.Sprintf(
+			"%d items are dated in the future; they stay at the top of the item list", len(futureDates)), futureDates)
+	}
+	if len(undated) > 0 {
+		report.add(SeverityInfo, "missing-date", fmt.Sprintf("%d items have no date", len(undated)), undated)
+	}
+	if len(oversized) > 0 {
+		report.add(SeverityWarning, "item-size", fmt.Sprintf(
+			"%d items have more than %d KB of description and content", len(oversized), diagnosticMaxItemBytes>>10), oversized)
+	}
+	if len(garbled) > 0 {
+		report.add(SeverityWarning, "charset", fmt.Sprintf(
+			"%d items contain replacement characters (�), which usually means the text was encoded incorrectly", len(garbled)), garbled)
+	}
+	if rawBytes > 0 && sanitizedBytes < rawBytes {
+		removed := rawBytes - sanitizedBytes
+		report.add(SeverityInfo, "sanitized", fmt.Sprintf(
+			"SanitizeHTML removed %d of %d bytes of item HTML (%.0f%%)", removed, rawBytes, 100*float64(removed)/float64(rawBytes)), nil)
+	}
+	if len(stripped) > 0 {
+		report.add(SeverityWarning, "sanitized", fmt.Sprintf(
+			"SanitizeHTML removed more than %.0f%% of the HTML of %d items; their stored content may look incomplete",
+			100*diagnosticStripWarnRatio, len(stripped)), stripped)
+	}
+}
+
+// diagnosticItemName identifies an item in findings by its title, GUID or position
+func diagnosticItemName(index int, item *gofeed.Item) string {
+	if item.Title != "" {
+		return fmt.Sprintf("%q", item.Title)
+	}
+	if item.GUID != "" {
+		return item.GUID
+	}
+	return fmt.Sprintf("item #%d", index+1)
+}
+
+// firstNonEmpty returns the first non-empty string of values
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// sortFindings orders findings by severity, keeping the order of checks within a severity
+func (d *FeedDiagnostics) sortFindings() {
+	rank := map[DiagnosticSeverity]int{SeverityError: 0, SeverityWarning: 1, SeverityInfo: 2}
+	sort.SliceStable(d.Findings, func(i, j int) bool {
+		return rank[d.Findings[i].Severity] < rank[d.Findings[j].Severity]
+	})
+}
+
+// printDiagnostics writes a diagnostics report as plain text
+func printDiagnostics(w io.Writer, report *FeedDiagnostics) {
+	fmt.Fprintf(w, "Diagnostics for %s (checked %s)\n", report.URL, report.CheckedAt.Format("2006-01-02 15:04:05"))
+	if report.HTTPStatus != 0 {
+		fmt.Fprintf(w, "HTTP %d, %d bytes, Content-Type %q\n", report.HTTPStatus, report.Bytes, report.ContentType)
+	}
+	if report.RedirectChain != "" {
+		fmt.Fprintf(w, "Redirects:\n  %s\n", strings.ReplaceAll(report.RedirectChain, "\n", "\n  "))
+	}
+	if report.FeedType != "" {
+		fmt.Fprintf(w, "Feed: %s, %q, %d items\n", report.FeedType, report.Title, report.ItemCount)
+	}
+	fmt.Fprintln(w)
+
+	if len(report.Findings) == 0 {
+		fmt.Fprintln(w, "No problems found")
+		return
+	}
+	for _, finding := range report.Findings {
+		fmt.Fprintf(w, "[%s] %s: %s\n", strings.ToUpper(string(finding.Severity)), finding.Check, finding.Message)
+		for _, example := range finding.Examples {
+			fmt.Fprintf(w, "    - %s\n", example)
+		}
+	}
+	fmt.Fprintf(w, "\n%d errors, %d warnings, %d info\n",
+		report.Count(SeverityError), report.Count(SeverityWarning), report.Count(SeverityInfo))
+}
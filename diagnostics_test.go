@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// findingsByCheck groups the severities of a report's findings by check
+func findingsByCheck(report *FeedDiagnostics) map[string][]DiagnosticSeverity {
+	found := map[string][]DiagnosticSeverity{}
+	for _, finding := range report.Findings {
+		found[finding.Check] = append(found[finding.Check], finding.Severity)
+	}
+	return found
+}
+
+func TestFeedFetcher_Diagnose(t *testing.T) {
+	fetcher, now := newTestFetcher(t)
+	const body = `<?xml version="1.0" encoding="UTF-8"?><rss version="2.0"><channel><title>Broken</title>` +
+		`<item><title>First</title><link>http://example.com/1</link><guid>same</guid><pubDate>Mon, 01 Jan 2024 10:00:00 GMT</pubDate></item>` +
+		`<item><title>Second</title><link>http://example.com/2</link><guid>same</guid><pubDate>yesterday-ish</pubDate></item>` +
+		`<item><title>No GUID</title><link>http://example.com/3</link><pubDate>Mon, 01 Jan 2030 10:00:00 GMT</pubDate></item>` +
+		`<item><title>Nothing</title><description>&lt;script&gt;alert("a long script that is removed entirely")&lt;/script&gt;ok</description></item>` +
+		`</channel></rss>`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/rss+xml; charset=iso-8859-1")
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	report := fetcher.Diagnose(context.Background(), Feed{URL: server.URL, ETag: `"v1"`})
+	assert.Equal(t, http.StatusOK, report.HTTPStatus, "Should not send conditional headers")
+	assert.Equal(t, "rss 2.0", report.FeedType)
+	assert.Equal(t, 4, report.ItemCount)
+	assert.Equal(t, now, report.CheckedAt)
+
+	found := findingsByCheck(report)
+	assert.Equal(t, []DiagnosticSeverity{SeverityError}, found["duplicate-guid"])
+	assert.Equal(t, []DiagnosticSeverity{SeverityWarning, SeverityWarning}, found["missing-guid"])
+	assert.Equal(t, []DiagnosticSeverity{SeverityWarning}, found["missing-link"])
+	assert.Equal(t, []DiagnosticSeverity{SeverityWarning}, found["unparseable-date"])
+	assert.Equal(t, []DiagnosticSeverity{SeverityWarning}, found["future-date"])
+	assert.Equal(t, []DiagnosticSeverity{SeverityWarning}, found["charset"], "Should report the Content-Type charset mismatch")
+	assert.Equal(t, []DiagnosticSeverity{SeverityWarning, SeverityInfo}, found["sanitized"])
+	assert.Equal(t, 1, report.Count(SeverityError))
+
+	// Errors come first
+	assert.Equal(t, SeverityError, report.Findings[0].Severity)
+	assert.Equal(t, SeverityInfo, report.Findings[len(report.Findings)-1].Severity)
+
+	var stored int64
+	fetcher.DB.Model(&FetchAttempt{}).Count(&stored)
+	assert.Equal(t, int64(0), stored, "Should not log a fetch attempt")
+}
+
+func TestFeedFetcher_DiagnoseUsesIdentityStrategy(t *testing.T) {
+	fetcher, _ := newTestFetcher(t)
+	const body = `<?xml version="1.0"?><rss version="2.0"><channel><title>Rotating</title>` +
+		`<item><title>First</title><link>http://example.com/1</link><guid>same</guid></item>` +
+		`<item><title>Second</title><link>http://example.com/2</link><guid>same</guid></item>` +
+		`<item><title>Third</title><link>http://example.com/3</link></item>` +
+		`<item><title>Copy</title><link>http://example.com/3</link><guid>copy</guid></item>` +
+		`<item><title>Note</title><guid>note</guid></item>` +
+		`</channel></rss>`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	found := findingsByCheck(fetcher.Diagnose(context.Background(), Feed{URL: server.URL, ItemIdentity: ItemIdentityLink}))
+	assert.Equal(t, []DiagnosticSeverity{SeverityError}, found["duplicate-guid"], "Should only flag the shared link, not the shared GUID")
+	assert.Equal(t, []DiagnosticSeverity{SeverityWarning}, found["missing-guid"], "Should only flag the item without a link")
+
+	found = findingsByCheck(fetcher.Diagnose(context.Background(), Feed{URL: server.URL, ItemIdentity: ItemIdentityHash}))
+	assert.Empty(t, found["duplicate-guid"])
+	assert.Empty(t, found["missing-guid"])
+}
+
+func TestFeedFetcher_DiagnoseFailures(t *testing.T) {
+	fetcher, _ := newTestFetcher(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/missing":
+			http.NotFound(w, r)
+		case "/latin1":
+			w.Write([]byte("<?xml version=\"1.0\"?><rss version=\"2.0\"><channel><title>Caf\xe9</title></channel></rss>"))
+		default:
+			w.Write([]byte("not a feed"))
+		}
+	}))
+	defer server.Close()
+
+	report := fetcher.Diagnose(context.Background(), Feed{URL: server.URL + "/missing"})
+	assert.Equal(t, map[string][]DiagnosticSeverity{"fetch": {SeverityError}}, findingsByCheck(report))
+	assert.Equal(t, http.StatusNotFound, report.HTTPStatus)
+
+	report = fetcher.Diagnose(context.Background(), Feed{URL: server.URL + "/garbage"})
+	assert.Equal(t, []DiagnosticSeverity{SeverityError}, findingsByCheck(report)["parse"])
+
+	report = fetcher.Diagnose(context.Background(), Feed{URL: server.URL + "/latin1"})
+	found := findingsByCheck(report)
+	assert.Contains(t, found["charset"], SeverityError, "Should report invalid UTF-8")
+	assert.Equal(t, []DiagnosticSeverity{SeverityError}, found["parse"], "Should explain why the feed doesn't parse")
+}
+
+func TestDiagnoseCharset(t *testing.T) {
+	header := http.Header{"Content-Type": {"text/xml; charset=windows-1252"}}
+	report := &FeedDiagnostics{}
+	diagnoseCharset(report, header, []byte("\xef\xbb\xbf<?xml version=\"1.0\" encoding=\"windows-1252\"?><rss/>"))
+	if assert.Len(t, report.Findings, 2) {
+		assert.Contains(t, report.Findings[0].Message, "byte order mark")
+		assert.Contains(t, report.Findings[1].Message, "windows-1252")
+		assert.Equal(t, SeverityInfo, report.Findings[1].Severity)
+	}
+
+	report = &FeedDiagnostics{}
+	diagnoseCharset(report, nil, []byte(`<?xml version="1.0" encoding="klingon"?><rss/>`))
+	if assert.Len(t, report.Findings, 1) {
+		assert.Equal(t, SeverityError, report.Findings[0].Severity)
+	}
+
+	report = &FeedDiagnostics{}
+	diagnoseCharset(report, http.Header{"Content-Type": {"application/xml; charset=utf8"}}, []byte(`<?xml version="1.0" encoding="UTF-8"?><rss/>`))
+	assert.Empty(t, report.Findings, "Should treat charset aliases as the same encoding")
+}
+
+func TestPrintDiagnostics(t *testing.T) {
+	report := &FeedDiagnostics{URL: "http://example.com/feed", HTTPStatus: 200, Bytes: 10, FeedType: "rss 2.0", Title: "Feed", ItemCount: 2}
+	report.add(SeverityError, "duplicate-guid", "1 GUIDs are used by more than one item", []string{"a", "b", "c", "d"})
+
+	var out bytes.Buffer
+	printDiagnostics(&out, report)
+	text := out.String()
+	assert.Contains(t, text, "[ERROR] duplicate-guid: 1 GUIDs are used by more than one item")
+	assert.Equal(t, diagnosticMaxExamples, strings.Count(text, "    - "), "Should list at most diagnosticMaxExamples examples")
+	assert.Contains(t, text, "1 errors, 0 warnings, 0 info")
+
+	out.Reset()
+	printDiagnostics(&out, &FeedDiagnostics{URL: "http://example.com/feed"})
+	assert.Contains(t, out.String(), "No problems found")
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/mmcdole/gofeed"
+)
+
+// maxDiscoveryBytes limits how much of a page or probed path is read during autodiscovery
+const maxDiscoveryBytes = 5 << 20
+
+// feedLinkTypes are the <link rel="alternate"> types that point to feeds
+var feedLinkTypes = map[string]bool{
+	"application/rss+xml":   true,
+	"application/atom+xml":  true,
+	"application/feed+json": true,
+}
+
+// commonFeedPaths are probed on the page's site when it does not link to any feed
+var commonFeedPaths = []string{"/feed", "/rss", "/feed.xml", "/rss.xml", "/atom.xml", "/index.xml", "/feed.json"}
+
+// FeedCandidate is a feed found by autodiscovery
+type FeedCandidate struct {
+	URL   string
+	Title string
+	Type  string // MIME type of the link element, or the parsed feed type for probed paths
+}
+
+// Discovery is the outcome of autodiscovery for a URL
+type Discovery struct {
+	IsFeed     bool            // The URL itself is a feed
+	Title      string          // Feed title, or the page title for HTML pages
+	Candidates []FeedCandidate // Feeds linked from the page, or found at common paths of its site
+}
+
+// Discover checks whether pageURL is a feed and, if it is an HTML page instead, collects the feeds
+// it advertises with <link rel="alternate">. Pages that advertise none are probed at commonFeedPaths
+// Nothing is stored; the caller decides which URL becomes a Feed
+func (f *FeedFetcher) Discover(ctx context.Context, pageURL string) (Discovery, error) {
+	if f.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, f.Timeout)
+		defer cancel()
+	}
+
+	body, finalURL, err := f.get(ctx, pageURL)
+	if err != nil {
+		return Discovery{}, err
+	}
+	if parsed, err := gofeed.NewParser().Parse(bytes.NewReader(body)); err == nil {
+		return Discovery{IsFeed: true, Title: parsed.Title}, nil
+	}
+
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		return Discovery{}, err
+	}
+	discovery := Discovery{
+		Title:      strings.TrimSpace(doc.Find("title").First().Text()),
+		Candidates: feedLinks(doc, finalURL),
+	}
+	if len(discovery.Candidates) == 0 {
+		discovery.Candidates = f.probeCommonPaths(ctx, finalURL)
+	}
+	return discovery, nil
+}
+
+// feedLinks returns the feeds an HTML document links to, resolved against its <base> or page URL
+func feedLinks(doc *goquery.Document, pageURL *url.URL) []FeedCandidate {
+	base := pageURL
+	if href, ok := doc.Find("base[href]").First().Attr("href"); ok {
+		if resolved, err := pageURL.Parse(href); err == nil {
+			base = resolved
+		}
+	}
+
+	var candidates []FeedCandidate
+	seen := make(map[string]bool)
+	doc.Find("link[rel][href]").Each(func(_ int, link *goquery.Selection) {
+		rel, _ := link.Attr("rel")
+		if !containsField(rel, "alternate") {
+			return
+		}
+		linkType, _, _ := mime.ParseMediaType(link.AttrOr("type", ""))
+		if !feedLinkTypes[linkType] {
+			return
+		}
+		target, err := base.Parse(strings.TrimSpace(link.AttrOr("href", "")))
+		if err != nil || (target.Scheme != "http" && target.Scheme != "https") || seen[target.String()] {
+			return
+		}
+		seen[target.String()] = true
+		candidates = append(candidates, FeedCandidate{
+			URL:   target.String(),
+			Title: strings.TrimSpace(link.AttrOr("title", "")),
+			Type:  linkType,
+		})
+	})
+	return candidates
+}
+
+// probeCommonPaths requests commonFeedPaths on the site of pageURL concurrently and returns those that parse as feeds
+// The probes bypass the per-host limiter: they are a one-off request made while an admin waits for the page
+func (f *FeedFetcher) probeCommonPaths(ctx context.Context, pageURL *url.URL) []FeedCandidate {
+	found := make([]*FeedCandidate, len(commonFeedPaths))
+	var wg sync.WaitGroup
+	for i, path := range commonFeedPaths {
+		target := (&url.URL{Scheme: pageURL.Scheme, Host: pageURL.Host, Path: path}).String()
+		wg.Add(1)
+		go func(i int, target string) {
+			defer wg.Done()
+			body, _, err := f.get(ctx, target)
+			if err != nil {
+				return
+			}
+			parsed, err := gofeed.NewParser().Parse(bytes.NewReader(body))
+			if err != nil {
+				return
+			}
+			found[i] = &FeedCandidate{URL: target, Title: parsed.Title, Type: parsed.FeedType}
+		}(i, target)
+	}
+	wg.Wait()
+
+	var candidates []FeedCandidate
+	for _, candidate := range found {
+		if candidate != nil {
+			candidates = append(candidates, *candidate)
+		}
+	}
+	return candidates
+}
+
+// get downloads rawURL for autodiscovery and returns the body and the URL after redirects
+func (f *FeedFetcher) get(ctx context.Context, rawURL string) ([]byte, *url.URL, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("User-Agent", "Gofeed/1.0")
+	resp, err := f.Client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, nil, fmt.Errorf("server responded %s", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxDiscoveryBytes))
+	if err != nil {
+		return nil, nil, err
+	}
+	return body, resp.Request.URL, nil
+}
+
+// containsField reports whether the space-separated list s contains value, ignoring case
+func containsField(s, value string) bool {
+	for _, field := range strings.Fields(s) {
+		if strings.EqualFold(field, value) {
+			return true
+		}
+	}
+	return false
+}
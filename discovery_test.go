@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFeedFetcher_Discover(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/feed.xml", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(testRSS))
+	})
+	mux.HandleFunc("/blog/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<html><head><title>My Blog</title><base href="/blog/">` +
+			`<link rel="alternate" type="application/rss+xml" title="Posts" href="posts.rss">` +
+			`<link rel="alternate" type="application/atom+xml; charset=utf-8" href="https://other.example.com/atom">` +
+			`<link rel="alternate" type="text/html" href="/fr/">` +
+			`<link rel="stylesheet" type="application/rss+xml" href="/style.css">` +
+			`<link rel="alternate" type="application/rss+xml" href="posts.rss">` +
+			`</head><body></body></html>`))
+	})
+	mux.HandleFunc("/plain", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<html><head><title>No links</title></head></html>`))
+	})
+	mux.HandleFunc("/missing", func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	fetcher := NewFeedFetcher(nil)
+	fetcher.Hosts = nil
+
+	// A feed URL is recognised as such
+	discovery, err := fetcher.Discover(context.Background(), server.URL+"/feed.xml")
+	assert.NoError(t, err)
+	assert.True(t, discovery.IsFeed)
+	assert.Equal(t, "Test Feed", discovery.Title)
+
+	// A page lists its alternate feed links, resolved against <base>, without duplicates
+	discovery, err = fetcher.Discover(context.Background(), server.URL+"/blog/")
+	assert.NoError(t, err)
+	assert.False(t, discovery.IsFeed)
+	assert.Equal(t, "My Blog", discovery.Title)
+	assert.Equal(t, []FeedCandidate{
+		{URL: server.URL + "/blog/posts.rss", Title: "Posts", Type: "application/rss+xml"},
+		{URL: "https://other.example.com/atom", Type: "application/atom+xml"},
+	}, discovery.Candidates)
+
+	// A page without feed links falls back to probing common paths of the site
+	discovery, err = fetcher.Discover(context.Background(), server.URL+"/plain")
+	assert.NoError(t, err)
+	assert.False(t, discovery.IsFeed)
+	assert.Equal(t, []FeedCandidate{{URL: server.URL + "/feed.xml", Title: "Test Feed", Type: "rss"}}, discovery.Candidates)
+
+	// HTTP errors are reported
+	_, err = fetcher.Discover(context.Background(), server.URL+"/missing")
+	assert.Error(t, err)
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"mime"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/mmcdole/gofeed"
+	ext "github.com/mmcdole/gofeed/extensions"
+	"gorm.io/gorm"
+)
+
+// hasMediaCondition selects items with at least one audio or video enclosure
+const hasMediaCondition = "EXISTS (SELECT 1 FROM enclosures WHERE enclosures.item_id = items.id AND (enclosures.type LIKE 'audio/%' OR enclosures.type LIKE 'video/%'))"
+
+// mediaTypesByExtension covers the podcast and video formats Go's MIME table doesn't know everywhere
+var mediaTypesByExtension = map[string]string{
+	".mp3":  "audio/mpeg",
+	".m4a":  "audio/mp4",
+	".aac":  "audio/aac",
+	".ogg":  "audio/ogg",
+	".oga":  "audio/ogg",
+	".opus": "audio/opus",
+	".wav":  "audio/wav",
+	".flac": "audio/flac",
+	".mp4":  "video/mp4",
+	".m4v":  "video/x-m4v",
+	".mov":  "video/quicktime",
+	".webm": "video/webm",
+	".ogv":  "video/ogg",
+}
+
+// Kind returns "audio", "video" or "image" based on the MIME type, or "" for anything else
+func (e Enclosure) Kind() string {
+	kind, _, _ := strings.Cut(e.Type, "/")
+	switch kind {
+	case "audio", "video", "image":
+		return kind
+	}
+	return ""
+}
+
+// FormattedDuration returns the duration as H:MM:SS or M:SS, or "" if it is unknown
+func (e Enclosure) FormattedDuration() string {
+	if e.Duration <= 0 {
+		return ""
+	}
+	hours, minutes, seconds := e.Duration/3600, e.Duration/60%60, e.Duration%60
+	if hours > 0 {
+		return strconv.Itoa(hours) + ":" + twoDigits(minutes) + ":" + twoDigits(seconds)
+	}
+	return strconv.Itoa(minutes) + ":" + twoDigits(seconds)
+}
+
+// FormattedLength returns the size in KB, MB or GB, or "" if it is unknown
+func (e Enclosure) FormattedLength() string {
+	switch {
+	case e.Length <= 0:
+		return ""
+	case e.Length < 1<<20:
+		return strconv.FormatFloat(float64(e.Length)/(1<<10), 'f', 1, 64) + " KB"
+	case e.Length < 1<<30:
+		return strconv.FormatFloat(float64(e.Length)/(1<<20), 'f', 1, 64) + " MB"
+	}
+	return strconv.FormatFloat(float64(e.Length)/(1<<30), 'f', 1, 64) + " GB"
+}
+
+// twoDigits formats n with a leading zero below 10
+func twoDigits(n int) string {
+	if n < 10 {
+		return "0" + strconv.Itoa(n)
+	}
+	return strconv.Itoa(n)
+}
+
+// buildEnclosures collects the media files of a parsed item from its enclosures (RSS <enclosure>
+// and Atom rel="enclosure" links) and Media RSS content, merged by URL. The iTunes duration
+// applies to the item's first audio or video file
+func buildEnclosures(item *gofeed.Item) []Enclosure {
+	var enclosures []Enclosure
+	index := map[string]int{}
+	add := func(e Enclosure) {
+		e.URL = strings.TrimSpace(e.URL)
+		if e.URL == "" {
+			return
+		}
+		e.Type = normalizeMediaType(e.Type, e.URL)
+		if i, ok := index[e.URL]; ok {
+			// Fill in what the earlier source left out
+			existing := &enclosures[i]
+			if existing.Type == "" {
+				existing.Type = e.Type
+			}
+			if existing.Length == 0 {
+				existing.Length = e.Length
+			}
+			if existing.Duration == 0 {
+				existing.Duration = e.Duration
+			}
+			return
+		}
+		e.Position = len(enclosures)
+		index[e.URL] = len(enclosures)
+		enclosures = append(enclosures, e)
+	}
+
+	for _, enclosure := range item.Enclosures {
+		if enclosure == nil {
+			continue
+		}
+		add(Enclosure{URL: enclosure.URL, Type: enclosure.Type, Length: parseNonNegativeInt64(enclosure.Length)})
+	}
+	for _, content := range mediaRSSContents(item.Extensions) {
+		add(Enclosure{
+			URL:      content.Attrs["url"],
+			Type:     content.Attrs["type"],
+			Length:   parseNonNegativeInt64(content.Attrs["fileSize"]),
+			Duration: int(parseNonNegativeInt64(content.Attrs["duration"])),
+		})
+	}
+
+	if item.ITunesExt != nil {
+		if duration := parseITunesDuration(item.ITunesExt.Duration); duration > 0 {
+			for i := range enclosures {
+				if kind := enclosures[i].Kind(); kind == "audio" || kind == "video" {
+					if enclosures[i].Duration == 0 {
+						enclosures[i].Duration = duration
+					}
+					break
+				}
+			}
+		}
+	}
+	return enclosures
+}
+
+// mediaRSSContents returns the media:content elements of an item, including those in media:group
+func mediaRSSContents(extensions ext.Extensions) []ext.Extension {
+	media, ok := extensions["media"]
+	if !ok {
+		return nil
+	}
+	contents := append([]ext.Extension{}, media["content"]...)
+	for _, group := range media["group"] {
+		contents = append(contents, group.Children["content"]...)
+	}
+	return contents
+}
+
+// normalizeMediaType returns the MIME type without parameters, guessed from the URL's file
+// extension when the feed doesn't provide one
+func normalizeMediaType(mediaType, rawURL string) string {
+	if mediaType != "" {
+		if parsed, _, err := mime.ParseMediaType(mediaType); err == nil {
+			return parsed
+		}
+		return strings.ToLower(strings.TrimSpace(mediaType))
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	extension := strings.ToLower(path.Ext(u.Path))
+	if guessed, ok := mediaTypesByExtension[extension]; ok {
+		return guessed
+	}
+	if guessed, _, err := mime.ParseMediaType(mime.TypeByExtension(extension)); err == nil {
+		return guessed
+	}
+	return ""
+}
+
+// parseITunesDuration parses an itunes:duration of seconds, MM:SS or HH:MM:SS; returns 0 if invalid
+func parseITunesDuration(value string) int {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	parts := strings.Split(value, ":")
+	if len(parts) > 3 {
+		return 0
+	}
+	total := 0
+	for _, part := range parts {
+		// Fractional seconds ("12.5") are truncated
+		whole, _, _ := strings.Cut(part, ".")
+		n, err := strconv.Atoi(whole)
+		if err != nil || n < 0 {
+			return 0
+		}
+		total = total*60 + n
+	}
+	return total
+}
+
+// parseNonNegativeInt64 parses a size or duration attribute; returns 0 if it is missing or invalid
+func parseNonNegativeInt64(value string) int64 {
+	n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+// sameEnclosures reports whether two lists describe the same media files in the same order
+func sameEnclosures(a, b []Enclosure) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].URL != b[i].URL || a[i].Type != b[i].Type || a[i].Length != b[i].Length || a[i].Duration != b[i].Duration {
+			return false
+		}
+	}
+	return true
+}
+
+// syncEnclosures stores the enclosures built for rows, replacing those of items whose media changed
+// rows are matched to stored items by GUID; rows that were not stored (e.g. too old to keep) are skipped
+func syncEnclosures(tx *gorm.DB, feedID uint, rows []Item) error {
+	idByGUID, ids, err := storedItemIDs(tx, feedID, rows)
+	if err != nil || len(ids) == 0 {
+		return err
+	}
+
+	var existing []Enclosure
+	if err := tx.Where("item_id IN ?", ids).Order("item_id, position").Find(&existing).Error; err != nil {
+		return err
+	}
+	existingByItem := map[uint][]Enclosure{}
+	for _, enclosure := range existing {
+		existingByItem[enclosure.ItemID] = append(existingByItem[enclosure.ItemID], enclosure)
+	}
+
+	var replaced []uint
+	var created []Enclosure
+	for _, row := range rows {
+		id, ok := idByGUID[row.GUID]
+		if !ok || sameEnclosures(existingByItem[id], row.Enclosures) {
+			continue
+		}
+		replaced = append(replaced, id)
+		for _, enclosure := range row.Enclosures {
+			enclosure.ItemID = id
+			created = append(created, enclosure)
+		}
+	}
+
+	if len(replaced) > 0 {
+		if err := tx.Where("item_id IN ?", replaced).Delete(&Enclosure{}).Error; err != nil {
+			return err
+		}
+	}
+	if len(created) > 0 {
+		if err := tx.CreateInBatches(&created, 100).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mmcdole/gofeed"
+	"github.com/stretchr/testify/assert"
+)
+
+const testPodcastRSS = `<?xml version="1.0"?>
+<rss version="2.0" xmlns:itunes="http://www.itunes.com/dtds/podcast-1.0.dtd" xmlns:media="http://search.yahoo.com/mrss/">
+<channel><title>Podcast</title>
+<item><title>Episode 1</title><guid>ep1</guid>
+  <enclosure url="http://example.com/ep1.mp3" length="12345678" type="audio/mpeg"/>
+  <itunes:duration>1:02:03</itunes:duration>
+  <media:content url="http://example.com/ep1.mp3" fileSize="1" duration="3723"/>
+  <media:content url="http://example.com/cover.jpg" medium="image"/>
+</item>
+<item><title>Video</title><guid>video</guid>
+  <media:group>
+    <media:content url="http://example.com/clip.webm" duration="90"/>
+    <media:content url="http://example.com/clip.mp4" type="video/mp4; codecs=avc1" fileSize="2048"/>
+  </media:group>
+</item>
+<item><title>Text</title><guid>text</guid><description>No media</description></item>
+</channel></rss>`
+
+func TestBuildEnclosures(t *testing.T) {
+	parsed, err := gofeed.NewParser().ParseString(testPodcastRSS)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	episode := buildEnclosures(parsed.Items[0])
+	if assert.Len(t, episode, 2, "Should merge the enclosure and Media RSS content with the same URL") {
+		assert.Equal(t, Enclosure{URL: "http://example.com/ep1.mp3", Type: "audio/mpeg", Length: 12345678, Duration: 3723, Position: 0}, episode[0])
+		assert.Equal(t, "http://example.com/cover.jpg", episode[1].URL)
+		assert.Equal(t, "image/jpeg", episode[1].Type, "Should guess the type from the extension")
+		assert.Equal(t, 1, episode[1].Position)
+	}
+
+	video := buildEnclosures(parsed.Items[1])
+	if assert.Len(t, video, 2) {
+		assert.Equal(t, "video/webm", video[0].Type)
+		assert.Equal(t, 90, video[0].Duration)
+		assert.Equal(t, "video/mp4", video[1].Type, "Should drop MIME type parameters")
+		assert.Equal(t, int64(2048), video[1].Length)
+	}
+
+	assert.Empty(t, buildEnclosures(parsed.Items[2]))
+}
+
+func TestBuildEnclosures_ITunesDuration(t *testing.T) {
+	parsed, err := gofeed.NewParser().ParseString(`<?xml version="1.0"?>
+<rss version="2.0" xmlns:itunes="http://www.itunes.com/dtds/podcast-1.0.dtd"><channel><title>Podcast</title>
+<item><title>Episode</title><guid>ep</guid><enclosure url="http://example.com/ep.m4a" length="0" type=""/><itunes:duration>59:30</itunes:duration></item>
+</channel></rss>`)
+	if !assert.NoError(t, err) {
+		return
+	}
+	enclosures := buildEnclosures(parsed.Items[0])
+	if assert.Len(t, enclosures, 1) {
+		assert.Equal(t, "audio/mp4", enclosures[0].Type)
+		assert.Equal(t, 3570, enclosures[0].Duration)
+		assert.Equal(t, "59:30", enclosures[0].FormattedDuration())
+	}
+}
+
+func TestParseITunesDuration(t *testing.T) {
+	tests := map[string]int{
+		"":         0,
+		"90":       90,
+		"1:30":     90,
+		"01:02:03": 3723,
+		"12.5":     12,
+		"abc":      0,
+		"1:2:3:4":  0,
+		"-5":       0,
+	}
+	for value, expected := range tests {
+		assert.Equal(t, expected, parseITunesDuration(value), "itunes:duration %q", value)
+	}
+}
+
+func TestEnclosureFormatting(t *testing.T) {
+	assert.Equal(t, "audio", Enclosure{Type: "audio/mpeg"}.Kind())
+	assert.Equal(t, "", Enclosure{Type: "application/pdf"}.Kind())
+	assert.Equal(t, "1:02:03", Enclosure{Duration: 3723}.FormattedDuration())
+	assert.Equal(t, "", Enclosure{}.FormattedDuration())
+	assert.Equal(t, "11.8 MB", Enclosure{Length: 12345678}.FormattedLength())
+	assert.Equal(t, "2.0 KB", Enclosure{Length: 2048}.FormattedLength())
+	assert.Equal(t, "", Enclosure{}.FormattedLength())
+}
+
+func TestFeedFetcher_FetchStoresEnclosures(t *testing.T) {
+	fetcher, _ := newTestFetcher(t)
+	body := testPodcastRSS
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/rss+xml")
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	feed := Feed{URL: server.URL}
+	fetcher.DB.Create(&feed)
+	_, err := fetcher.Fetch(context.Background(), &feed)
+	assert.NoError(t, err)
+
+	var episode Item
+	fetcher.DB.Preload("Enclosures").Where("guid = ?", "ep1").First(&episode)
+	assert.Len(t, episode.Enclosures, 2)
+
+	var withMedia []Item
+	fetcher.DB.Where(hasMediaCondition).Order("id").Find(&withMedia)
+	if assert.Len(t, withMedia, 2, "Should find items with audio or video") {
+		assert.Equal(t, "ep1", withMedia[0].GUID)
+		assert.Equal(t, "video", withMedia[1].GUID)
+	}
+
+	// A replaced media file replaces the stored enclosures without touching other items
+	var before []Enclosure
+	fetcher.DB.Order("id").Find(&before)
+	body = strings.Replace(testPodcastRSS, `<enclosure url="http://example.com/ep1.mp3" length="12345678" type="audio/mpeg"/>`,
+		`<enclosure url="http://example.com/ep1-fixed.mp3" length="12345678" type="audio/mpeg"/>`, 1)
+	feed.ETag, feed.LastModified = "", ""
+	result, err := fetcher.Fetch(context.Background(), &feed)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, result.Updated, "Media changes should not count as content edits")
+
+	var after []Enclosure
+	fetcher.DB.Order("item_id, position").Find(&after)
+	urls := []string{}
+	for _, enclosure := range after {
+		urls = append(urls, enclosure.URL)
+	}
+	assert.Equal(t, []string{
+		"http://example.com/ep1-fixed.mp3", "http://example.com/ep1.mp3", "http://example.com/cover.jpg",
+		"http://example.com/clip.webm", "http://example.com/clip.mp4",
+	}, urls)
+	assert.Equal(t, before[len(before)-1].ID, after[len(after)-1].ID, "Should keep the enclosures of unchanged items")
+}
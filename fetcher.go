@@ -0,0 +1,654 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// FeedFetcher is the single ingestion pipeline for feeds: it downloads a feed,
+// parses it, upserts its items and records the outcome on the Feed.
+// Both the manual fetch handlers and the background scheduler go through it.
+type FeedFetcher struct {
+	Client *http.Client     // HTTP client used for feed requests (swap the transport in tests)
+	DB     *gorm.DB         // Store for feeds and items
+	Now    func() time.Time // Clock used for fetch timestamps and scheduling
+
+	Workers int           // Number of feeds fetched concurrently by FetchAll
+	Hosts   *HostLimiter  // Per-host politeness limits (nil disables them)
+	Timeout time.Duration // Timeout for a single feed request, including reading the body (0 disables it)
+	WebSub  *WebSubClient // Subscribes feeds that advertise a hub (nil disables WebSub)
+
+	// ArticleClient downloads full articles. Article links come from the feed, so it refuses
+	// loopback, private and link-local addresses (nil falls back to Client)
+	ArticleClient *http.Client
+}
+
+// NewFeedFetcher creates a FeedFetcher with the default HTTP client, the real clock,
+// FETCH_WORKERS workers, the shared per-host limiter, FETCH_TIMEOUT, WebSub if configured
+// and an article client limited to public addresses
+func NewFeedFetcher(db *gorm.DB) *FeedFetcher {
+	return &FeedFetcher{
+		Client:        http.DefaultClient,
+		ArticleClient: newPublicHTTPClient(),
+		DB:            db,
+		Now:           time.Now,
+		Workers:       GetFetchWorkers(),
+		Hosts:         getSharedHostLimiter(),
+		Timeout:       time.Duration(GetFetchTimeout()) * time.Second,
+		WebSub:        NewWebSubClient(db),
+	}
+}
+
+// FetchResult contains the outcome of fetching a single feed
+type FetchResult struct {
+	Created     int
+	Updated     int
+	Errors      int // Items that failed to save
+	Articles    int // Full articles extracted for feeds with FetchFullArticle
+	NotModified bool
+}
+
+// Fetch fetches a single feed, ingests its items and records a FetchAttempt
+// The returned error is the fetch/parse error; it has already been recorded on the feed
+// If ctx is cancelled before the download completes, nothing is recorded and ctx's error is returned
+func (f *FeedFetcher) Fetch(ctx context.Context, feed *Feed) (FetchResult, error) {
+	var result FetchResult
+	attempt := FetchAttempt{
+		FeedID:    feed.ID,
+		FeedURL:   feed.URL,
+		StartedAt: f.Now(),
+	}
+
+	parsedFeed, notModified, err := f.download(ctx, feed, &attempt)
+	if err != nil && ctx.Err() != nil {
+		// Shutting down (or the caller went away): leave the feed due so it is fetched next time
+		log.Printf("Fetch of feed %s cancelled: %v", feed.URL, ctx.Err())
+		return result, ctx.Err()
+	}
+	if err != nil {
+		log.Printf("Error parsing feed %s: %v", feed.URL, err)
+		paused := f.markFailed(feed, err)
+		attempt.Status = FetchStatusError
+		attempt.Error = err.Error()
+		attempt.Message = "Failed to fetch feed"
+		if paused {
+			attempt.Message = fmt.Sprintf("Failed to fetch feed; paused after %d consecutive failures", feed.ConsecutiveFailures)
+		}
+		f.recordAttempt(&attempt)
+		return result, err
+	}
+
+	// The feed answered: follow it if it has consistently moved permanently
+	redirectNote := f.trackRedirect(feed, attempt.PermanentRedirect)
+
+	if notModified {
+		f.markNotModified(feed)
+		result.NotModified = true
+		attempt.Status = FetchStatusNotModified
+		attempt.Message = "Feed not modified since last fetch" + noteSuffix(redirectNote)
+		f.recordAttempt(&attempt)
+		return result, nil
+	}
+
+	// Update successful fetch timestamp and clear error
+	now := f.Now()
+	feed.LastSuccessfullyFetchedAt = &now
+	feed.LastError = ""
+	feed.LastErrorAt = nil
+	feed.ConsecutiveFailures = 0
+	feed.PausedAt = nil
+	result = f.ingest(feed, parsedFeed)
+	if feed.FetchFullArticle {
+		result.Articles = f.fetchFullArticles(ctx, feed)
+	}
+
+	// Schedule the next fetch based on whether new items appeared
+	scheduleNextFetch(feed, result.Created, now)
+	f.DB.Model(feed).Select("fetch_interval", "next_fetch_at", "paused_at").Updates(feed)
+
+	attempt.Status = FetchStatusSuccess
+	attempt.ItemsCreated = result.Created
+	attempt.ItemsUpdated = result.Updated
+	attempt.Message = "Successfully fetched feed: " + result.summary() + noteSuffix(redirectNote)
+	f.recordAttempt(&attempt)
+
+	// Subscribe to the feed's hub so future updates are pushed instead of polled
+	if f.WebSub != nil {
+		if err := f.WebSub.EnsureSubscription(ctx, feed); err != nil {
+			log.Printf("Error subscribing to WebSub hub of feed %s: %v", feed.URL, err)
+		}
+	}
+
+	return result, nil
+}
+
+// IngestPush ingests a feed document pushed by a WebSub hub through the same path as Fetch
+// and records it as a FetchAttempt
+func (f *FeedFetcher) IngestPush(feed *Feed, body []byte) (FetchResult, error) {
+	attempt := FetchAttempt{
+		FeedID:    feed.ID,
+		FeedURL:   feed.URL,
+		StartedAt: f.Now(),
+		Bytes:     int64(len(body)),
+	}
+
+	parsedFeed, err := gofeed.NewParser().Parse(bytes.NewReader(body))
+	if err != nil {
+		log.Printf("Error parsing WebSub push for feed %s: %v", feed.URL, err)
+		attempt.Status = FetchStatusError
+		attempt.Error = err.Error()
+		attempt.Message = "Failed to parse WebSub push"
+		f.recordAttempt(&attempt)
+		return FetchResult{}, err
+	}
+
+	result := f.ingest(feed, parsedFeed)
+	attempt.Status = FetchStatusSuccess
+	attempt.ItemsCreated = result.Created
+	attempt.ItemsUpdated = result.Updated
+	attempt.Message = "Received WebSub push: " + result.summary()
+	f.recordAttempt(&attempt)
+	return result, nil
+}
+
+// ingest updates the feed's title and description, saves it and upserts its items
+func (f *FeedFetcher) ingest(feed *Feed, parsedFeed *gofeed.Feed) FetchResult {
+	var result FetchResult
+	// Update feed title and description if available
+	if parsedFeed.Title != "" {
+		feed.Title = parsedFeed.Title
+	}
+	if parsedFeed.Description != "" {
+		feed.Description = parsedFeed.Description
+	}
+	f.saveFetchState(feed)
+
+	result.Created, result.Updated, result.Errors = f.upsertItems(feed, parsedFeed.Items)
+	return result
+}
+
+// summary describes the item counts of a result for fetch attempt messages
+func (r FetchResult) summary() string {
+	summary := fmt.Sprintf("%d created, %d updated", r.Created, r.Updated)
+	if r.Errors > 0 {
+		summary += fmt.Sprintf(", %d items failed to save", r.Errors)
+	}
+	if r.Articles > 0 {
+		summary += fmt.Sprintf(", %d full articles extracted", r.Articles)
+	}
+	return summary
+}
+
+// loadHTTPOptions returns the FeedHTTPOptions of a feed, or nil if it has none or f has no database
+func (f *FeedFetcher) loadHTTPOptions(feedID uint) (*FeedHTTPOptions, error) {
+	if f.DB == nil || feedID == 0 {
+		return nil, nil
+	}
+	return loadFeedHTTPOptions(f.DB, feedID)
+}
+
+// noteSuffix appends an optional note to a fetch attempt message
+func noteSuffix(note string) string {
+	if note == "" {
+		return ""
+	}
+	return "; " + note
+}
+
+// recordAttempt stores a finished FetchAttempt
+func (f *FeedFetcher) recordAttempt(attempt *FetchAttempt) {
+	attempt.FinishedAt = f.Now()
+	if err := f.DB.Create(attempt).Error; err != nil {
+		log.Printf("Error recording fetch attempt for %s: %v", attempt.FeedURL, err)
+	}
+}
+
+// FetchAll fetches the given feeds with a pool of f.Workers workers, returns statistics
+// Feeds are interleaved by host so the per-host limits don't stall the whole pool
+// Once ctx is cancelled remaining feeds are skipped; feeds in flight finish unless workCtx is cancelled too
+// errors counts both failed feeds and items that failed to save
+func (f *FeedFetcher) FetchAll(ctx, workCtx context.Context, feeds []Feed) (itemsCreated, itemsUpdated, errors int) {
+	if len(feeds) == 0 {
+		return 0, 0, 0
+	}
+
+	// Counters with mutex for thread safety
+	var mu sync.Mutex
+
+	// Worker pool: no more workers than feeds
+	workers := f.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(feeds) {
+		workers = len(feeds)
+	}
+	feedChan := make(chan Feed, len(feeds))
+	var wg sync.WaitGroup
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for feed := range feedChan {
+				if ctx.Err() != nil {
+					continue
+				}
+				result, err := f.Fetch(workCtx, &feed)
+
+				mu.Lock()
+				itemsCreated += result.Created
+				itemsUpdated += result.Updated
+				errors += result.Errors
+				if err != nil && workCtx.Err() == nil {
+					errors++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	// Send all feeds to the channel
+	for _, feed := range interleaveByHost(feeds) {
+		feedChan <- feed
+	}
+	close(feedChan)
+
+	// Wait for all workers to finish
+	wg.Wait()
+
+	return itemsCreated, itemsUpdated, errors
+}
+
+// download fetches and parses a feed, sending If-None-Match and If-Modified-Since
+// headers from the previous fetch. On success the feed's ETag and LastModified
+// fields are updated from the response (the caller is responsible for saving).
+// Returns notModified=true with a nil feed when the server responds with 304.
+// The response status, body size and followed redirects are recorded on attempt.
+func (f *FeedFetcher) download(ctx context.Context, feed *Feed, attempt *FetchAttempt) (parsedFeed *gofeed.Feed, notModified bool, err error) {
+	body, header, notModified, err := f.downloadBody(ctx, feed, attempt)
+	if err != nil || notModified {
+		return nil, notModified, err
+	}
+
+	parsedFeed, err = gofeed.NewParser().Parse(bytes.NewReader(body))
+	if err != nil {
+		return nil, false, err
+	}
+
+	// Remember validators only once the body parsed, so a broken response is re-downloaded next time
+	feed.ETag = header.Get("ETag")
+	feed.LastModified = header.Get("Last-Modified")
+	feed.HubURL, feed.SelfURL = discoverWebSubLinks(header, body)
+	return parsedFeed, false, nil
+}
+
+// downloadBody performs the request of download and returns the raw response body and headers
+// Returns notModified=true with a nil body when the server responds with 304.
+// The response status, body size and followed redirects are recorded on attempt.
+// The feed's FeedHTTPOptions, if any, are applied to the request.
+// The request waits for the per-host limits of f.Hosts, if set, and is then bounded by f.Timeout.
+func (f *FeedFetcher) downloadBody(ctx context.Context, feed *Feed, attempt *FetchAttempt) (body []byte, header http.Header, notModified bool, err error) {
+	if f.Hosts != nil {
+		host := feedHost(feed.URL)
+		if err := f.Hosts.Acquire(ctx, host); err != nil {
+			return nil, nil, false, err
+		}
+		defer f.Hosts.Release(host)
+	}
+	if f.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, f.Timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, feed.URL, nil)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	req.Header.Set("User-Agent", "Gofeed/1.0")
+	options, err := f.loadHTTPOptions(feed.ID)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	if options != nil {
+		if err := options.applyHeaders(req); err != nil {
+			return nil, nil, false, err
+		}
+	}
+	if feed.ETag != "" {
+		req.Header.Set("If-None-Match", feed.ETag)
+	}
+	if feed.LastModified != "" {
+		req.Header.Set("If-Modified-Since", feed.LastModified)
+	}
+
+	// Follow redirects on a copy of the client so the chain of this request can be recorded
+	client := *f.Client
+	if options != nil {
+		transport, err := options.transport(f.Client.Transport)
+		if err != nil {
+			return nil, nil, false, err
+		}
+		if transport != f.Client.Transport {
+			// A one-off transport for this feed's proxy or CA; don't leave its connections open
+			defer transport.(*http.Transport).CloseIdleConnections()
+		}
+		client.Transport = transport
+	}
+	var hops []redirectHop
+	client.CheckRedirect = recordRedirects(f.Client.CheckRedirect, &hops)
+	if options != nil {
+		client.CheckRedirect = options.dropHeadersOnHostChange(client.CheckRedirect)
+	}
+	resp, err := client.Do(req)
+	attempt.RedirectChain = formatRedirectChain(hops)
+	attempt.PermanentRedirect = permanentRedirectTarget(hops)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	defer resp.Body.Close()
+	attempt.HTTPStatus = resp.StatusCode
+
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, resp.Header, true, nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, resp.Header, false, gofeed.HTTPError{
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+		}
+	}
+
+	body, err = io.ReadAll(resp.Body)
+	attempt.Bytes = int64(len(body))
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return nil, resp.Header, false, fmt.Errorf("reading feed body timed out after %s: %w", f.Timeout, err)
+		}
+		return nil, resp.Header, false, err
+	}
+	return body, resp.Header, false, nil
+}
+
+// upsertItems creates new items and updates existing ones (matched by GUID within the feed)
+// with a batched INSERT ... ON CONFLICT (feed_id, guid) DO UPDATE inside one transaction, and
+// replaces the enclosures and categories of items whose media or categories changed.
+// The lead image is not part of the content hash; a changed image alone is updated in place.
+// Items whose content hash is unchanged are not written; for changed items the previous
+// version is kept as an ItemRevision. The feed row is locked for the transaction so concurrent
+// fetches of the same feed report accurate counts. New items already older than ITEM_MAX_AGE_DAYS
+// are skipped, since retention would remove them again. If the transaction fails, every item counts as an error
+func (f *FeedFetcher) upsertItems(feed *Feed, items []*gofeed.Item) (created, updated, errors int) {
+	rows := buildItems(feed, items)
+	if len(rows) == 0 {
+		return 0, 0, 0
+	}
+
+	err := f.DB.Transaction(func(tx *gorm.DB) error {
+		created, updated = 0, 0
+		// feed was loaded before the download: re-read the settings items depend on, which an admin may have changed since
+		var current Feed
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "item_identity", "keep_items").First(&current, feed.ID).Error; err != nil {
+			return err
+		}
+		feed.KeepItems = current.KeepItems
+		if current.ItemIdentity != feed.ItemIdentity {
+			feed.ItemIdentity = current.ItemIdentity
+			rows = buildItems(feed, items)
+		}
+		guids := make([]string, len(rows))
+		for i, row := range rows {
+			guids[i] = row.GUID
+		}
+
+		// Soft-deleted items are included so they can be restored (and count as created)
+		var existing []Item
+		if err := tx.Unscoped().Where("feed_id = ? AND guid IN ?", feed.ID, guids).Find(&existing).Error; err != nil {
+			return err
+		}
+		existingByGUID := make(map[string]*Item, len(existing))
+		for i := range existing {
+			existingByGUID[existing[i].GUID] = &existing[i]
+		}
+
+		now := f.Now()
+		cutoff := itemMaxAgeCutoff(now)
+		floor, err := keepItemsFloor(tx, feed, cutoff)
+		if err != nil {
+			return err
+		}
+		var changed []Item
+		var revisions []ItemRevision
+		var relinked []uint
+		for _, row := range rows {
+			old, ok := existingByGUID[row.GUID]
+			if !ok {
+				if row.PublishedAt != nil && (cutoff != nil && row.PublishedAt.Before(*cutoff) || floor != nil && row.PublishedAt.Before(*floor)) {
+					continue
+				}
+				changed = append(changed, row)
+				created++
+				continue
+			}
+
+			oldHash := old.ContentHash
+			if oldHash == "" {
+				oldHash = old.computeContentHash()
+			}
+			contentChanged := oldHash != row.ContentHash
+			if contentChanged {
+				revisions = append(revisions, revisionOf(old, now))
+			}
+			if old.Link != row.Link && (old.FullContentFetchedAt != nil || old.FullContent != "") {
+				relinked = append(relinked, old.ID)
+			}
+
+			switch {
+			case old.DeletedAt.Valid:
+				changed = append(changed, row)
+				created++
+			case contentChanged:
+				changed = append(changed, row)
+				updated++
+			default:
+				// Unchanged content: backfill the hash for items stored before content hashes
+				// existed and pick up a new lead image or canonical URL, without touching updated_at
+				columns := map[string]interface{}{}
+				if old.ContentHash == "" {
+					columns["content_hash"] = row.ContentHash
+				}
+				if old.CanonicalURL != row.CanonicalURL {
+					columns["canonical_url"] = row.CanonicalURL
+				}
+				if old.SourceGUID != row.SourceGUID {
+					columns["source_guid"] = row.SourceGUID
+				}
+				if old.Fingerprint != row.Fingerprint {
+					columns["fingerprint"] = row.Fingerprint
+				}
+				if old.ImageURL != row.ImageURL || old.ImageWidth != row.ImageWidth || old.ImageHeight != row.ImageHeight {
+					columns["image_url"] = row.ImageURL
+					columns["image_width"] = row.ImageWidth
+					columns["image_height"] = row.ImageHeight
+				}
+				if len(columns) > 0 {
+					if err := tx.Model(old).UpdateColumns(columns).Error; err != nil {
+						return err
+					}
+				}
+			}
+		}
+
+		if len(changed) > 0 {
+			err := tx.Clauses(clause.OnConflict{
+				Columns: []clause.Column{{Name: "feed_id"}, {Name: "guid"}},
+				DoUpdates: append(
+					clause.AssignmentColumns([]string{"title", "link", "description", "content", "author", "source_guid", "canonical_url", "fingerprint", "image_url", "image_width", "image_height", "content_hash", "updated_at", "deleted_at"}),
+					// Keep the previous publication date when the feed no longer provides one
+					clause.Assignment{Column: clause.Column{Name: "published_at"}, Value: gorm.Expr("COALESCE(excluded.published_at, items.published_at)")},
+				),
+			}).Omit(clause.Associations).CreateInBatches(&changed, 100).Error
+			if err != nil {
+				return err
+			}
+		}
+		if len(revisions) > 0 {
+			if err := tx.CreateInBatches(&revisions, 100).Error; err != nil {
+				return err
+			}
+		}
+		// The full article of an item whose link changed is stale: drop it so it is extracted again
+		if len(relinked) > 0 {
+			err := tx.Model(&Item{}).Where("id IN ?", relinked).UpdateColumns(map[string]interface{}{
+				"full_content":            "",
+				"full_content_fetched_at": nil,
+				"full_content_error":      "",
+			}).Error
+			if err != nil {
+				return err
+			}
+		}
+		// Media and categories are compared separately from the content hash, so unchanged items pick them up too
+		if err := syncEnclosures(tx, feed.ID, rows); err != nil {
+			return err
+		}
+		if err := syncCategories(tx, feed.ID, rows); err != nil {
+			return err
+		}
+		// Only new and changed items look for other copies of their story
+		return clusterItems(tx, feed.ID, changed, now)
+	})
+	if err != nil {
+		log.Printf("Error saving items for feed %s: %v", feed.URL, err)
+		return 0, 0, len(rows)
+	}
+	return created, updated, 0
+}
+
+// buildItems converts parsed items into Item rows for feed, sanitizing their HTML
+// Each row's GUID follows the feed's identity strategy (see itemIdentity)
+// Items repeating a GUID within the same document are collapsed into the last occurrence
+func buildItems(feed *Feed, items []*gofeed.Item) []Item {
+	rows := make([]Item, 0, len(items))
+	index := make(map[string]int, len(items))
+	for _, item := range items {
+		publishedAt := itemPublishedAt(item)
+		row := Item{
+			FeedID:       feed.ID,
+			Title:        item.Title,
+			Link:         item.Link,
+			Description:  SanitizeHTML(item.Description),
+			Content:      SanitizeHTML(getItemContent(item)),
+			Author:       getItemAuthor(item),
+			PublishedAt:  publishedAt,
+			CanonicalURL: canonicalizeURL(item.Link),
+			Enclosures:   buildEnclosures(item),
+			Categories:   buildCategories(item),
+		}
+		image := buildLeadImage(item, row.Enclosures, row.Content+row.Description)
+		row.ImageURL, row.ImageWidth, row.ImageHeight = image.URL, image.Width, image.Height
+		row.SourceGUID = strings.TrimSpace(item.GUID)
+		row.GUID = itemIdentity(feed, row.SourceGUID, item.Link, row.Title, row.PublishedAt, row.Content)
+		row.ContentHash = row.computeContentHash()
+		row.Fingerprint = storyFingerprint(row.Title, row.Content)
+		if i, ok := index[row.GUID]; ok {
+			rows[i] = row
+			continue
+		}
+		index[row.GUID] = len(rows)
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// fetchStateColumns are the Feed columns the fetcher owns. Fetches only write these, so settings an
+// admin changes while a fetch runs (item identity, retention, full articles, fixed interval) are kept
+var fetchStateColumns = []string{
+	"title", "description", "etag", "last_modified", "last_successfully_fetched_at", "last_error", "last_error_at",
+	"consecutive_failures", "fetch_interval", "next_fetch_at", "hub_url", "self_url", "redirect_url", "redirect_count",
+}
+
+// saveFetchState writes the fetchStateColumns of feed, plus the given columns
+// paused_at is only written when the fetch pauses or resumes the feed, so it doesn't undo an admin resuming it
+func (f *FeedFetcher) saveFetchState(feed *Feed, columns ...string) {
+	columns = append(append([]string{}, fetchStateColumns...), columns...)
+	if err := f.DB.Model(feed).Select(columns).Updates(feed).Error; err != nil {
+		log.Printf("Error saving fetch state of feed %s: %v", feed.URL, err)
+	}
+}
+
+// markNotModified records a 304 response as a successful fetch without touching items
+func (f *FeedFetcher) markNotModified(feed *Feed) {
+	now := f.Now()
+	feed.LastSuccessfullyFetchedAt = &now
+	feed.LastError = ""
+	feed.LastErrorAt = nil
+	feed.ConsecutiveFailures = 0
+	feed.PausedAt = nil
+	scheduleNextFetch(feed, 0, now)
+	f.saveFetchState(feed, "paused_at")
+}
+
+// markFailed records a failed fetch, backs off the next retry exponentially
+// and pauses the feed once FETCH_FAILURE_PAUSE_THRESHOLD consecutive failures are reached
+// Returns true if this failure paused the feed
+func (f *FeedFetcher) markFailed(feed *Feed, fetchErr error) bool {
+	now := f.Now()
+	feed.LastError = fetchErr.Error()
+	feed.LastErrorAt = &now
+	feed.ConsecutiveFailures++
+	scheduleRetry(feed, now)
+
+	threshold := GetFailurePauseThreshold()
+	pause := feed.PausedAt == nil && feed.ConsecutiveFailures >= threshold
+	if pause {
+		feed.PausedAt = &now
+		f.saveFetchState(feed, "paused_at")
+	} else {
+		f.saveFetchState(feed)
+	}
+
+	if pause {
+		log.Printf("Pausing feed %s after %d consecutive failures", feed.URL, feed.ConsecutiveFailures)
+	}
+	return pause
+}
+
+func getItemContent(item *gofeed.Item) string {
+	if item.Content != "" {
+		return item.Content
+	}
+	return item.Description
+}
+
+func getItemAuthor(item *gofeed.Item) string {
+	if item.Author != nil && item.Author.Name != "" {
+		return item.Author.Name
+	}
+	if len(item.Authors) > 0 && item.Authors[0].Name != "" {
+		return item.Authors[0].Name
+	}
+	return ""
+}
+
+// processAllFeeds fetches and processes all active feeds, including test feeds, returns statistics
+// Paused feeds are only fetched when requested individually
+func processAllFeeds(ctx context.Context) (itemsCreated, itemsUpdated, errors int) {
+	var feeds []Feed
+	DB.Where("paused_at IS NULL").Find(&feeds)
+	return NewFeedFetcher(DB).FetchAll(ctx, ctx, feeds)
+}
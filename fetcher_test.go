@@ -0,0 +1,371 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	"github.com/stretchr/testify/assert"
+)
+
+const testRSS = `<?xml version="1.0"?><rss version="2.0"><channel><title>Test Feed</title>` +
+	`<description>Feed description</description>` +
+	`<item><title>Item A</title><link>http://example.com/a</link><guid>a</guid>` +
+	`<description>&lt;p&gt;First&lt;/p&gt;&lt;script&gt;alert(1)&lt;/script&gt;</description></item>` +
+	`<item><title>Item B</title><link>http://example.com/b</link></item>` +
+	`</channel></rss>`
+
+// newTestFetcher returns a FeedFetcher backed by the test database with a fixed clock
+// and without per-host delays (all test servers share 127.0.0.1)
+func newTestFetcher(t *testing.T) (*FeedFetcher, time.Time) {
+	db := setupTestDB(t)
+	DB = db
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	fetcher := NewFeedFetcher(db)
+	fetcher.Now = func() time.Time { return now }
+	fetcher.Hosts = nil
+	// Test servers listen on loopback, which the article client refuses
+	fetcher.ArticleClient = nil
+	return fetcher, now
+}
+
+func TestFeedFetcher_DownloadConditionalRequest(t *testing.T) {
+	const etag = `"v1"`
+	const lastModified = "Mon, 01 Jan 2024 12:00:00 GMT"
+
+	var gotIfNoneMatch, gotIfModifiedSince string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotIfNoneMatch = r.Header.Get("If-None-Match")
+		gotIfModifiedSince = r.Header.Get("If-Modified-Since")
+		if gotIfNoneMatch == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Last-Modified", lastModified)
+		w.Write([]byte(testRSS))
+	}))
+	defer server.Close()
+
+	fetcher := NewFeedFetcher(nil)
+	fetcher.Hosts = nil
+	feed := &Feed{URL: server.URL}
+
+	// First fetch: no validators sent, body parsed, validators stored
+	parsed, notModified, err := fetcher.download(context.Background(), feed, &FetchAttempt{})
+	assert.NoError(t, err)
+	assert.False(t, notModified)
+	assert.Equal(t, 2, len(parsed.Items), "Should parse items from a 200 response")
+	assert.Equal(t, "", gotIfNoneMatch, "Should not send If-None-Match on first fetch")
+	assert.Equal(t, etag, feed.ETag, "Should store ETag from response")
+	assert.Equal(t, lastModified, feed.LastModified, "Should store Last-Modified from response")
+
+	// Second fetch: validators sent, 304 reported as not modified
+	parsed, notModified, err = fetcher.download(context.Background(), feed, &FetchAttempt{})
+	assert.NoError(t, err)
+	assert.True(t, notModified, "Should report 304 as not modified")
+	assert.Nil(t, parsed)
+	assert.Equal(t, etag, gotIfNoneMatch, "Should send stored ETag")
+	assert.Equal(t, lastModified, gotIfModifiedSince, "Should send stored Last-Modified")
+	assert.Equal(t, etag, feed.ETag, "Should keep ETag after 304")
+}
+
+func TestFeedFetcher_DownloadHTTPError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	feed := &Feed{URL: server.URL}
+	_, notModified, err := NewFeedFetcher(nil).download(context.Background(), feed, &FetchAttempt{})
+	assert.Error(t, err)
+	assert.False(t, notModified)
+	assert.Contains(t, err.Error(), "404", "Error should mention the status code")
+}
+
+func TestFeedFetcher_Fetch(t *testing.T) {
+	fetcher, now := newTestFetcher(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(testRSS))
+	}))
+	defer server.Close()
+
+	feed := Feed{URL: server.URL}
+	fetcher.DB.Create(&feed)
+
+	// First fetch creates both items
+	result, err := fetcher.Fetch(context.Background(), &feed)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, result.Created, "Should create new items")
+	assert.Equal(t, 0, result.Updated)
+
+	var reloaded Feed
+	fetcher.DB.First(&reloaded, feed.ID)
+	assert.Equal(t, "Test Feed", reloaded.Title, "Should update feed title")
+	assert.Equal(t, "Feed description", reloaded.Description, "Should update feed description")
+	assert.True(t, now.Equal(*reloaded.LastSuccessfullyFetchedAt), "Should use the fetcher clock")
+	assert.NotNil(t, reloaded.NextFetchAt, "Should schedule the next fetch")
+
+	var items []Item
+	fetcher.DB.Order("id").Find(&items)
+	assert.Equal(t, 2, len(items))
+	assert.Equal(t, "a", items[0].GUID)
+	assert.NotContains(t, items[0].Description, "<script>", "Should sanitize item HTML")
+	assert.Equal(t, "http://example.com/b", items[1].GUID, "Should fall back to link when GUID is missing")
+
+	// Second fetch of the same document leaves the items untouched
+	result, err = fetcher.Fetch(context.Background(), &feed)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, result.Created, "Should not create duplicates")
+	assert.Equal(t, 0, result.Updated, "Should not count unchanged items as updated")
+
+	// Each fetch is recorded as an attempt
+	var attempts []FetchAttempt
+	fetcher.DB.Order("id").Find(&attempts)
+	assert.Equal(t, 2, len(attempts), "Should record one attempt per fetch")
+	assert.Equal(t, FetchStatusSuccess, attempts[0].Status)
+	assert.Equal(t, feed.ID, attempts[0].FeedID)
+	assert.Equal(t, http.StatusOK, attempts[0].HTTPStatus, "Should record the HTTP status")
+	assert.Equal(t, int64(len(testRSS)), attempts[0].Bytes, "Should record the response size")
+	assert.Equal(t, 2, attempts[0].ItemsCreated)
+	assert.Equal(t, 0, attempts[1].ItemsUpdated)
+}
+
+func TestFeedFetcher_FetchKeepsAdminChanges(t *testing.T) {
+	fetcher, _ := newTestFetcher(t)
+	failing := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(testRSS))
+	}))
+	defer server.Close()
+
+	feed := Feed{URL: server.URL}
+	fetcher.DB.Create(&feed)
+	pausedAt := time.Now()
+	fetcher.DB.Model(&feed).UpdateColumn("paused_at", pausedAt)
+
+	// The worker loaded the feed, then an admin changed its settings and resumed it before the fetch finished
+	stale := feed
+	stale.PausedAt = &pausedAt
+	fetcher.DB.Model(&feed).UpdateColumns(map[string]interface{}{
+		"item_identity": ItemIdentityLink, "keep_items": 7, "fetch_full_article": true, "paused_at": nil,
+	})
+	failing = true
+	_, err := fetcher.Fetch(context.Background(), &stale)
+	assert.Error(t, err)
+
+	var reloaded Feed
+	fetcher.DB.First(&reloaded, feed.ID)
+	assert.Equal(t, ItemIdentityLink, reloaded.ItemIdentity)
+	assert.Equal(t, 7, reloaded.KeepItems)
+	assert.True(t, reloaded.FetchFullArticle)
+	assert.Nil(t, reloaded.PausedAt, "Should not undo resuming the feed")
+	assert.Equal(t, 1, reloaded.ConsecutiveFailures)
+
+	stale = feed
+	failing = false
+	_, err = fetcher.Fetch(context.Background(), &stale)
+	assert.NoError(t, err)
+	reloaded = Feed{}
+	fetcher.DB.First(&reloaded, feed.ID)
+	assert.Equal(t, ItemIdentityLink, reloaded.ItemIdentity)
+	assert.Equal(t, 7, reloaded.KeepItems)
+	assert.True(t, reloaded.FetchFullArticle)
+	assert.Equal(t, "Test Feed", reloaded.Title)
+	assert.Zero(t, reloaded.ConsecutiveFailures)
+
+	var guids []string
+	fetcher.DB.Model(&Item{}).Order("guid").Pluck("guid", &guids)
+	assert.Equal(t, []string{"http://example.com/a", "http://example.com/b"}, guids, "Should key items by the current identity strategy")
+}
+
+func TestFeedFetcher_FetchAll(t *testing.T) {
+	fetcher, _ := newTestFetcher(t)
+
+	okServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(testRSS))
+	}))
+	defer okServer.Close()
+	errServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer errServer.Close()
+
+	okFeed := Feed{URL: okServer.URL + "/ok.xml"}
+	errFeed := Feed{URL: errServer.URL + "/broken.xml"}
+	fetcher.DB.Create(&okFeed)
+	fetcher.DB.Create(&errFeed)
+
+	created, updated, errors := fetcher.FetchAll(context.Background(), context.Background(), []Feed{okFeed, errFeed})
+	assert.Equal(t, 2, created, "Should create items from the working feed")
+	assert.Equal(t, 0, updated)
+	assert.Equal(t, 1, errors, "Should count the failing feed")
+
+	var reloaded Feed
+	fetcher.DB.First(&reloaded, errFeed.ID)
+	assert.Contains(t, reloaded.LastError, "500", "Should record the error on the failing feed")
+	assert.Equal(t, 1, reloaded.ConsecutiveFailures)
+
+	var attempt FetchAttempt
+	fetcher.DB.Where("feed_id = ?", errFeed.ID).First(&attempt)
+	assert.Equal(t, FetchStatusError, attempt.Status, "Should record the failed attempt")
+	assert.Equal(t, http.StatusInternalServerError, attempt.HTTPStatus)
+	assert.Contains(t, attempt.Error, "500")
+}
+
+func TestFeedFetcher_FetchTimeout(t *testing.T) {
+	fetcher, _ := newTestFetcher(t)
+	fetcher.Timeout = 50 * time.Millisecond
+
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	feed := Feed{URL: server.URL}
+	fetcher.DB.Create(&feed)
+
+	start := time.Now()
+	_, err := fetcher.Fetch(context.Background(), &feed)
+	assert.Error(t, err, "Should fail when the server hangs")
+	assert.Less(t, time.Since(start), 5*time.Second, "Should give up after the request timeout")
+
+	var reloaded Feed
+	fetcher.DB.First(&reloaded, feed.ID)
+	assert.Equal(t, 1, reloaded.ConsecutiveFailures, "Should count a timeout as a failure")
+}
+
+func TestFeedFetcher_FetchCancelled(t *testing.T) {
+	fetcher, _ := newTestFetcher(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(testRSS))
+	}))
+	defer server.Close()
+
+	feed := Feed{URL: server.URL}
+	fetcher.DB.Create(&feed)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	created, _, errors := fetcher.FetchAll(ctx, ctx, []Feed{feed})
+	assert.Equal(t, 0, created, "Should not fetch once cancelled")
+	assert.Equal(t, 0, errors, "Should not count cancelled feeds as errors")
+
+	_, err := fetcher.Fetch(ctx, &feed)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	var reloaded Feed
+	fetcher.DB.First(&reloaded, feed.ID)
+	assert.Equal(t, 0, reloaded.ConsecutiveFailures, "Should not mark a cancelled fetch as failed")
+	assert.Nil(t, reloaded.NextFetchAt, "Should leave the feed due")
+
+	var attempts int64
+	fetcher.DB.Model(&FetchAttempt{}).Count(&attempts)
+	assert.Equal(t, int64(0), attempts, "Should not record cancelled fetches")
+}
+
+func TestFeedFetcher_UpsertItems(t *testing.T) {
+	fetcher, _ := newTestFetcher(t)
+
+	feed := Feed{URL: "https://example.com/feed.xml"}
+	fetcher.DB.Create(&feed)
+
+	published := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	created, updated, errors := fetcher.upsertItems(&feed, []*gofeed.Item{
+		{GUID: "a", Title: "A", PublishedParsed: &published},
+		{GUID: "b", Title: "B (first)"},
+		{GUID: "b", Title: "B (second)"},
+	})
+	assert.Equal(t, 2, created, "Should count items repeated within a document once")
+	assert.Equal(t, 0, updated)
+	assert.Equal(t, 0, errors)
+
+	// Soft-deleted items come back as created, existing ones are updated
+	fetcher.DB.Where("guid = ?", "b").Delete(&Item{})
+	created, updated, _ = fetcher.upsertItems(&feed, []*gofeed.Item{
+		{GUID: "a", Title: "A (edited)"},
+		{GUID: "b", Title: "B (restored)"},
+		{GUID: "c", Title: "C"},
+	})
+	assert.Equal(t, 2, created, "Should count new and restored items as created")
+	assert.Equal(t, 1, updated, "Should count existing items as updated")
+
+	var items []Item
+	fetcher.DB.Order("guid").Find(&items)
+	assert.Equal(t, 3, len(items), "Should not create duplicates")
+	assert.Equal(t, "A (edited)", items[0].Title)
+	assert.True(t, published.Equal(*items[0].PublishedAt), "Should keep the publication date when the feed drops it")
+	assert.Equal(t, "B (restored)", items[1].Title)
+
+	var revisions []ItemRevision
+	fetcher.DB.Order("id").Find(&revisions)
+	assert.Equal(t, 2, len(revisions), "Should keep the previous version of edited items")
+	assert.Equal(t, "A", revisions[0].Title)
+	assert.Equal(t, "B (second)", revisions[1].Title)
+}
+
+func TestFeedFetcher_UpsertItemsSkipsUnchanged(t *testing.T) {
+	fetcher, _ := newTestFetcher(t)
+
+	feed := Feed{URL: "https://example.com/feed.xml"}
+	fetcher.DB.Create(&feed)
+
+	parsed := []*gofeed.Item{{GUID: "a", Title: "Headline", Description: "<p>Body</p>"}}
+	fetcher.upsertItems(&feed, parsed)
+
+	var before Item
+	fetcher.DB.First(&before)
+	assert.Equal(t, before.computeContentHash(), before.ContentHash, "Should store the content hash")
+
+	created, updated, _ := fetcher.upsertItems(&feed, parsed)
+	assert.Equal(t, 0, created)
+	assert.Equal(t, 0, updated, "Should not update unchanged items")
+
+	var after Item
+	fetcher.DB.First(&after)
+	assert.True(t, before.UpdatedAt.Equal(after.UpdatedAt), "Should not bump UpdatedAt for unchanged items")
+
+	var revisions int64
+	fetcher.DB.Model(&ItemRevision{}).Count(&revisions)
+	assert.Equal(t, int64(0), revisions, "Should not record revisions for unchanged items")
+
+	// Items stored before content hashes existed get one backfilled without a revision
+	fetcher.DB.Model(&after).UpdateColumn("content_hash", "")
+	_, updated, _ = fetcher.upsertItems(&feed, parsed)
+	assert.Equal(t, 0, updated)
+	fetcher.DB.First(&after)
+	assert.Equal(t, before.ContentHash, after.ContentHash, "Should backfill the content hash")
+	fetcher.DB.Model(&ItemRevision{}).Count(&revisions)
+	assert.Equal(t, int64(0), revisions)
+}
+
+func TestFeedFetcher_UpsertItemsSkipsExpired(t *testing.T) {
+	fetcher, now := newTestFetcher(t)
+	t.Setenv("ITEM_MAX_AGE_DAYS", "30")
+
+	feed := Feed{URL: "https://example.com/feed.xml"}
+	fetcher.DB.Create(&feed)
+
+	old := now.AddDate(0, 0, -60)
+	recent := now.AddDate(0, 0, -1)
+	created, _, _ := fetcher.upsertItems(&feed, []*gofeed.Item{
+		{GUID: "old", Title: "Old", PublishedParsed: &old},
+		{GUID: "recent", Title: "Recent", PublishedParsed: &recent},
+	})
+	assert.Equal(t, 1, created, "Should not ingest items retention would remove right away")
+}
@@ -2,7 +2,6 @@ package main
 
 import (
 	"errors"
-	"fmt"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -187,50 +186,3 @@ func TestGeneratePageNumbers(t *testing.T) {
 		})
 	}
 }
-
-func TestGetLogEntries(t *testing.T) {
-	// Clear log entries before test
-	logMutex.Lock()
-	logEntries = []LogEntry{}
-	logMutex.Unlock()
-
-	// Add some test entries
-	addLogEntry("success", "https://example.com/feed.xml", "Test message 1")
-	addLogEntry("error", "https://example.com/feed2.xml", "Test message 2")
-	addLogEntry("success", "https://example.com/feed3.xml", "Test message 3")
-
-	entries := getLogEntries()
-
-	assert.Equal(t, 3, len(entries), "Should return 3 log entries")
-	assert.Equal(t, "success", entries[0].Type, "First entry should be success")
-	assert.Equal(t, "error", entries[1].Type, "Second entry should be error")
-	assert.Equal(t, "success", entries[2].Type, "Third entry should be success")
-
-	// Verify entries are copies (modifying shouldn't affect original)
-	entries[0].Type = "modified"
-	entries2 := getLogEntries()
-	assert.Equal(t, "success", entries2[0].Type, "Original entries should not be modified")
-}
-
-func TestAddLogEntry(t *testing.T) {
-	// Clear log entries before test
-	logMutex.Lock()
-	logEntries = []LogEntry{}
-	logMutex.Unlock()
-
-	// Add entries with different messages to track which ones are removed
-	for i := 0; i < maxLogSize+10; i++ {
-		addLogEntry("success", "https://example.com/feed.xml", fmt.Sprintf("Test message %d", i))
-	}
-
-	entries := getLogEntries()
-
-	// Should only keep maxLogSize entries
-	assert.Equal(t, maxLogSize, len(entries), "Should maintain max log size")
-	
-	// Oldest entries (0-9) should be removed, newest entries (10-1009) should remain
-	// First entry should be "Test message 10" (the 11th entry added)
-	assert.Equal(t, "Test message 10", entries[0].Message, "Oldest entries should be removed, keeping newest")
-	// Last entry should be the last one added
-	assert.Equal(t, fmt.Sprintf("Test message %d", maxLogSize+9), entries[len(entries)-1].Message, "Newest entries should be kept")
-}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HostLimiter enforces per-host politeness limits: at most Concurrency requests
+// in flight to a host, and at least MinDelay between the starts of two requests to it
+type HostLimiter struct {
+	Concurrency int
+	MinDelay    time.Duration
+
+	mu    sync.Mutex
+	hosts map[string]*hostSlot
+}
+
+// hostSlot tracks the in-flight requests and the next allowed start time for one host
+type hostSlot struct {
+	sem  chan struct{}
+	next time.Time
+}
+
+// NewHostLimiter creates a HostLimiter; concurrency below 1 is treated as 1
+func NewHostLimiter(concurrency int, minDelay time.Duration) *HostLimiter {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return &HostLimiter{
+		Concurrency: concurrency,
+		MinDelay:    minDelay,
+		hosts:       make(map[string]*hostSlot),
+	}
+}
+
+var (
+	sharedHostLimiter     *HostLimiter
+	sharedHostLimiterOnce sync.Once
+)
+
+// getSharedHostLimiter returns the process-wide HostLimiter configured from
+// FETCH_HOST_CONCURRENCY and FETCH_HOST_MIN_DELAY_MS, so manual and background
+// fetches respect the same limits
+func getSharedHostLimiter() *HostLimiter {
+	sharedHostLimiterOnce.Do(func() {
+		sharedHostLimiter = NewHostLimiter(GetHostConcurrency(), time.Duration(GetHostMinDelay())*time.Millisecond)
+	})
+	return sharedHostLimiter
+}
+
+// slot returns the hostSlot for host, creating it on first use
+func (l *HostLimiter) slot(host string) *hostSlot {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	s, ok := l.hosts[host]
+	if !ok {
+		s = &hostSlot{sem: make(chan struct{}, l.Concurrency)}
+		l.hosts[host] = s
+	}
+	return s
+}
+
+// Acquire blocks until a request to host may start or ctx is done
+// Every successful Acquire must be followed by Release
+func (l *HostLimiter) Acquire(ctx context.Context, host string) error {
+	s := l.slot(host)
+	select {
+	case s.sem <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	// Reserve the next start time for this host, then wait for it outside the lock
+	l.mu.Lock()
+	now := time.Now()
+	start := s.next
+	if start.Before(now) {
+		start = now
+	}
+	s.next = start.Add(l.MinDelay)
+	l.mu.Unlock()
+
+	if wait := start.Sub(now); wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			<-s.sem
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// Release frees the request slot taken by Acquire
+func (l *HostLimiter) Release(host string) {
+	<-l.slot(host).sem
+}
+
+// feedHost returns the lower-cased host (with port) of a feed URL, or the raw URL if it cannot be parsed
+func feedHost(feedURL string) string {
+	parsed, err := url.Parse(feedURL)
+	if err != nil || parsed.Host == "" {
+		return feedURL
+	}
+	return strings.ToLower(parsed.Host)
+}
+
+// interleaveByHost reorders feeds round-robin by host, so workers spread over
+// many hosts instead of queuing behind the per-host limit of a single one
+func interleaveByHost(feeds []Feed) []Feed {
+	groups := make(map[string][]Feed)
+	var hosts []string
+	for _, feed := range feeds {
+		host := feedHost(feed.URL)
+		if _, ok := groups[host]; !ok {
+			hosts = append(hosts, host)
+		}
+		groups[host] = append(groups[host], feed)
+	}
+	// Busiest hosts first so their feeds are spread over the whole run
+	sort.SliceStable(hosts, func(i, j int) bool {
+		return len(groups[hosts[i]]) > len(groups[hosts[j]])
+	})
+
+	result := make([]Feed, 0, len(feeds))
+	for round := 0; len(result) < len(feeds); round++ {
+		for _, host := range hosts {
+			if round < len(groups[host]) {
+				result = append(result, groups[host][round])
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHostLimiter_Concurrency(t *testing.T) {
+	limiter := NewHostLimiter(2, 0)
+
+	var inFlight, maxInFlight int32
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			limiter.Acquire(context.Background(), "example.com")
+			defer limiter.Release("example.com")
+
+			current := atomic.AddInt32(&inFlight, 1)
+			for {
+				seen := atomic.LoadInt32(&maxInFlight)
+				if current <= seen || atomic.CompareAndSwapInt32(&maxInFlight, seen, current) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+			atomic.AddInt32(&inFlight, -1)
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(2), maxInFlight, "Should never exceed the per-host concurrency")
+}
+
+func TestHostLimiter_MinDelay(t *testing.T) {
+	limiter := NewHostLimiter(5, 50*time.Millisecond)
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		limiter.Acquire(context.Background(), "example.com")
+		limiter.Release("example.com")
+	}
+	assert.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond, "Should space out requests to the same host")
+
+	// Other hosts are not delayed
+	start = time.Now()
+	limiter.Acquire(context.Background(), "other.example.com")
+	limiter.Release("other.example.com")
+	assert.Less(t, time.Since(start), 50*time.Millisecond, "Should not delay requests to other hosts")
+}
+
+func TestInterleaveByHost(t *testing.T) {
+	feeds := []Feed{
+		{URL: "https://reddit.com/r/a.rss"},
+		{URL: "https://reddit.com/r/b.rss"},
+		{URL: "https://reddit.com/r/c.rss"},
+		{URL: "https://theguardian.com/world/rss"},
+		{URL: "https://example.com/feed.xml"},
+	}
+
+	var urls []string
+	for _, feed := range interleaveByHost(feeds) {
+		urls = append(urls, feed.URL)
+	}
+	assert.Equal(t, []string{
+		"https://reddit.com/r/a.rss",
+		"https://theguardian.com/world/rss",
+		"https://example.com/feed.xml",
+		"https://reddit.com/r/b.rss",
+		"https://reddit.com/r/c.rss",
+	}, urls, "Should spread feeds of the same host across the run")
+}
+
+func TestHostLimiter_AcquireCancelled(t *testing.T) {
+	limiter := NewHostLimiter(1, 0)
+	assert.NoError(t, limiter.Acquire(context.Background(), "example.com"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := limiter.Acquire(ctx, "example.com")
+	assert.ErrorIs(t, err, context.DeadlineExceeded, "Should stop waiting for a slot when the context is done")
+
+	limiter.Release("example.com")
+	assert.NoError(t, limiter.Acquire(context.Background(), "example.com"), "Should not leak the slot of a cancelled Acquire")
+}
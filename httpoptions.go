@@ -0,0 +1,187 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// loadFeedHTTPOptions returns the HTTP options of a feed, or nil if it has none
+func loadFeedHTTPOptions(db *gorm.DB, feedID uint) (*FeedHTTPOptions, error) {
+	// Find instead of First: most feeds have no options, which is not worth logging as an error
+	var options []FeedHTTPOptions
+	if err := db.Where("feed_id = ?", feedID).Limit(1).Find(&options).Error; err != nil {
+		return nil, fmt.Errorf("loading HTTP options: %w", err)
+	}
+	if len(options) == 0 {
+		return nil, nil
+	}
+	return &options[0], nil
+}
+
+// IsEmpty reports whether none of the options is set
+func (o *FeedHTTPOptions) IsEmpty() bool {
+	return o.Username == "" && o.Password == "" && o.BearerToken == "" && o.Cookie == "" &&
+		o.Headers == "" && o.UserAgent == "" && o.ProxyURL == "" && o.CACert == ""
+}
+
+// applyInput copies the form input onto the options. Plain fields are replaced; secret fields
+// keep their stored value when left empty, since the form never shows them, unless cleared
+func (o *FeedHTTPOptions) applyInput(input FeedHTTPOptionsInput) {
+	o.Username = strings.TrimSpace(input.Username)
+	o.UserAgent = strings.TrimSpace(input.UserAgent)
+	o.CACert = strings.TrimSpace(input.CACert)
+	updateSecret(&o.Password, input.Password, input.ClearPassword)
+	updateSecret(&o.BearerToken, strings.TrimSpace(input.BearerToken), input.ClearBearerToken)
+	updateSecret(&o.Cookie, strings.TrimSpace(input.Cookie), input.ClearCookie)
+	updateSecret(&o.Headers, strings.TrimSpace(input.Headers), input.ClearHeaders)
+	updateSecret(&o.ProxyURL, strings.TrimSpace(input.ProxyURL), input.ClearProxyURL)
+}
+
+// updateSecret clears secret, replaces it with a non-empty value or leaves it unchanged
+func updateSecret(secret *EncryptedString, value string, clear bool) {
+	if clear {
+		*secret = ""
+	} else if value != "" {
+		*secret = EncryptedString(value)
+	}
+}
+
+// applyHeaders sets the credentials, cookie, User-Agent and extra headers on req
+// Extra headers are applied last, so they can override anything else
+func (o *FeedHTTPOptions) applyHeaders(req *http.Request) error {
+	if o.UserAgent != "" {
+		req.Header.Set("User-Agent", o.UserAgent)
+	}
+	if o.Username != "" || o.Password != "" {
+		req.SetBasicAuth(o.Username, string(o.Password))
+	} else if o.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+string(o.BearerToken))
+	}
+	if o.Cookie != "" {
+		req.Header.Set("Cookie", string(o.Cookie))
+	}
+	headers, err := parseHeaderLines(string(o.Headers))
+	if err != nil {
+		return err
+	}
+	for name, values := range headers {
+		req.Header[name] = values
+	}
+	return nil
+}
+
+// dropHeadersOnHostChange returns a CheckRedirect policy that removes the extra headers, which may
+// carry tokens, from redirects to a host other than the feed's, then applies next. net/http already
+// drops Authorization and Cookie on such redirects, but not custom headers
+func (o *FeedHTTPOptions) dropHeadersOnHostChange(next func(*http.Request, []*http.Request) error) func(*http.Request, []*http.Request) error {
+	headers, _ := parseHeaderLines(string(o.Headers))
+	return func(req *http.Request, via []*http.Request) error {
+		if len(via) > 0 && !strings.EqualFold(req.URL.Host, via[0].URL.Host) {
+			for name := range headers {
+				req.Header.Del(name)
+			}
+		}
+		return next(req, via)
+	}
+}
+
+// transport returns a copy of base that uses the proxy and trusts the CA certificates,
+// or base itself when neither is set. base must be an *http.Transport (nil means http.DefaultTransport)
+func (o *FeedHTTPOptions) transport(base http.RoundTripper) (http.RoundTripper, error) {
+	if o.ProxyURL == "" && o.CACert == "" {
+		return base, nil
+	}
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	baseTransport, ok := base.(*http.Transport)
+	if !ok {
+		return nil, fmt.Errorf("proxy and CA options need an *http.Transport, got %T", base)
+	}
+	transport := baseTransport.Clone()
+
+	if o.ProxyURL != "" {
+		proxyURL, err := parseProxyURL(string(o.ProxyURL))
+		if err != nil {
+			return nil, err
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+	if o.CACert != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM([]byte(o.CACert)) {
+			return nil, errors.New("CA certificate contains no valid PEM certificates")
+		}
+		if transport.TLSClientConfig == nil {
+			transport.TLSClientConfig = &tls.Config{}
+		}
+		transport.TLSClientConfig.RootCAs = pool
+	}
+	return transport, nil
+}
+
+// MaskedHeaders returns the extra header names with their values masked, for display
+func (o *FeedHTTPOptions) MaskedHeaders() []string {
+	headers, err := parseHeaderLines(string(o.Headers))
+	if err != nil {
+		return []string{"(invalid headers)"}
+	}
+	var masked []string
+	for name := range headers {
+		masked = append(masked, name+": ***")
+	}
+	sort.Strings(masked)
+	return masked
+}
+
+// MaskedProxyURL returns the proxy URL with its password masked, for display
+func (o *FeedHTTPOptions) MaskedProxyURL() string {
+	return maskURLPassword(string(o.ProxyURL))
+}
+
+// parseHeaderLines parses "Name: value" lines; blank lines are skipped
+func parseHeaderLines(text string) (http.Header, error) {
+	headers := http.Header{}
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(line, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" || strings.ContainsAny(name, " \t") {
+			return nil, fmt.Errorf("invalid header line %q, expected \"Name: value\"", line)
+		}
+		headers.Add(textproto.CanonicalMIMEHeaderKey(name), strings.TrimSpace(value))
+	}
+	return headers, nil
+}
+
+// parseProxyURL parses a proxy URL and checks its scheme is one http.Transport supports
+func parseProxyURL(rawURL string) (*url.URL, error) {
+	proxyURL, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL: %w", err)
+	}
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, errors.New("proxy URL must use http, https or socks5")
+	}
+	if proxyURL.Host == "" {
+		return nil, errors.New("proxy URL must include a host")
+	}
+	return proxyURL, nil
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	"gorm.io/gorm"
+)
+
+// Item identity strategies: which field of a parsed item becomes its GUID
+const (
+	ItemIdentityGUID = "guid" // The feed's GUID, then the link, then a hash (the default)
+	ItemIdentityLink = "link" // The link, then a hash; for feeds that rotate their GUIDs
+	ItemIdentityHash = "hash" // Always a hash of title, publication date and content
+)
+
+// itemIdentityStrategies lists the strategies in the order shown on the feed page
+var itemIdentityStrategies = []string{ItemIdentityGUID, ItemIdentityLink, ItemIdentityHash}
+
+// IdentityStrategy returns the feed's item identity strategy, ItemIdentityGUID if unset
+func (feed Feed) IdentityStrategy() string {
+	switch feed.ItemIdentity {
+	case ItemIdentityLink, ItemIdentityHash:
+		return feed.ItemIdentity
+	}
+	return ItemIdentityGUID
+}
+
+// itemIdentity returns the GUID an item is stored under, following the feed's strategy
+// The hash fallback means items without a GUID or link no longer share the empty GUID
+func itemIdentity(feed *Feed, guid, link, title string, publishedAt *time.Time, content string) string {
+	guid, link = strings.TrimSpace(guid), strings.TrimSpace(link)
+	switch feed.IdentityStrategy() {
+	case ItemIdentityGUID:
+		if guid != "" {
+			return guid
+		}
+		if link != "" {
+			return link
+		}
+	case ItemIdentityLink:
+		if link != "" {
+			return link
+		}
+	}
+	return itemIdentityHash(feed.ID, title, publishedAt, content)
+}
+
+// parsedItemIdentity returns the GUID buildItems stores a parsed item under
+func parsedItemIdentity(feed *Feed, item *gofeed.Item) string {
+	return itemIdentity(feed, item.GUID, item.Link, item.Title, itemPublishedAt(item), SanitizeHTML(getItemContent(item)))
+}
+
+// itemPublishedAt returns the publication date of a parsed item, or its update date if it has none
+func itemPublishedAt(item *gofeed.Item) *time.Time {
+	if item.PublishedParsed != nil {
+		return item.PublishedParsed
+	}
+	return item.UpdatedParsed
+}
+
+// itemIdentityHash returns a deterministic identifier from the feed ID, title, publication date
+// and (sanitized) content of an item, prefixed with "hash:" to tell it apart from publisher GUIDs
+func itemIdentityHash(feedID uint, title string, publishedAt *time.Time, content string) string {
+	published := ""
+	if publishedAt != nil {
+		published = publishedAt.UTC().Format(time.RFC3339)
+	}
+	sum := sha256.Sum256([]byte(strings.Join([]string{strconv.FormatUint(uint64(feedID), 10), title, published, content}, "\x00")))
+	return "hash:" + hex.EncodeToString(sum[:])
+}
+
+// setFeedItemIdentity switches a feed to another identity strategy and re-keys its stored items under
+// it in the same transaction, so the next fetch updates them instead of storing them again. Items that
+// end up with the same identifier are copies of one item (e.g. stored twice under a rotating GUID): the
+// newest is kept, with the stars and notes of the others, and the others are deleted. Returns how many
+// items were re-keyed and removed
+func setFeedItemIdentity(db *gorm.DB, feed *Feed, identity string) (rekeyed, removed int, err error) {
+	err = db.Transaction(func(tx *gorm.DB) error {
+		feed.ItemIdentity = identity
+		if err := tx.Model(feed).Select("item_identity").Updates(feed).Error; err != nil {
+			return err
+		}
+
+		var items []Item
+		err := tx.Unscoped().Select("id", "guid", "source_guid", "link", "title", "published_at", "content", "starred_at", "note").
+			Where("feed_id = ?", feed.ID).Order("id DESC").Find(&items).Error
+		if err != nil {
+			return err
+		}
+		kept := make(map[string]*Item, len(items))
+		marked := map[uint]*Item{}
+		changed := map[uint]string{}
+		var duplicates []uint
+		for i := range items {
+			item := &items[i]
+			guid := itemIdentity(feed, item.SourceGUID, item.Link, item.Title, item.PublishedAt, item.Content)
+			if survivor, ok := kept[guid]; ok {
+				if mergeItemMarks(survivor, item) {
+					marked[survivor.ID] = survivor
+				}
+				duplicates = append(duplicates, item.ID)
+				continue
+			}
+			kept[guid] = item
+			if guid != item.GUID {
+				changed[item.ID] = guid
+			}
+		}
+
+		for id, item := range marked {
+			err := tx.Unscoped().Model(&Item{}).Where("id = ?", id).
+				UpdateColumns(map[string]interface{}{"starred_at": item.StarredAt, "note": item.Note}).Error
+			if err != nil {
+				return err
+			}
+		}
+		if len(duplicates) > 0 {
+			if err := deleteItems(tx, duplicates); err != nil {
+				return err
+			}
+		}
+		// Move the items out of the way first, so swapping identifiers doesn't trip the unique index
+		for id := range changed {
+			if err := tx.Unscoped().Model(&Item{}).Where("id = ?", id).UpdateColumn("guid", fmt.Sprintf("rekey:%d", id)).Error; err != nil {
+				return err
+			}
+		}
+		for id, guid := range changed {
+			if err := tx.Unscoped().Model(&Item{}).Where("id = ?", id).UpdateColumn("guid", guid).Error; err != nil {
+				return err
+			}
+		}
+		rekeyed, removed = len(changed), len(duplicates)
+		return nil
+	})
+	return rekeyed, removed, err
+}
+
+// mergeItemMarks carries the star and note of duplicate over to survivor, which replaces it: the earlier
+// star is kept and notes are joined. Returns whether survivor changed
+func mergeItemMarks(survivor, duplicate *Item) bool {
+	changed := false
+	if duplicate.StarredAt != nil && (survivor.StarredAt == nil || duplicate.StarredAt.Before(*survivor.StarredAt)) {
+		survivor.StarredAt = duplicate.StarredAt
+		changed = true
+	}
+	if note := strings.TrimSpace(duplicate.Note); note != "" && !strings.Contains(survivor.Note, note) {
+		if survivor.Note != "" {
+			survivor.Note += "\n\n"
+		}
+		survivor.Note += note
+		changed = true
+	}
+	return changed
+}
+
+// backfillSourceGUIDs fills SourceGUID for items stored before it existed: their GUID is the
+// publisher's, unless it is a hash
+func backfillSourceGUIDs(db *gorm.DB) error {
+	return db.Unscoped().Model(&Item{}).Where("source_guid IS NULL").
+		UpdateColumn("source_guid", gorm.Expr("CASE WHEN guid LIKE 'hash:%' THEN '' ELSE guid END")).Error
+}
+
+// repairEmptyGUIDs gives items stored with an empty GUID (before the hash fallback existed) the
+// identifier the fetcher now computes for them, so the next fetch updates them instead of
+// adding a copy. If that identifier is already taken, the empty-GUID row is a stale copy and is deleted
+func repairEmptyGUIDs(db *gorm.DB) error {
+	var items []Item
+	if err := db.Unscoped().Preload("Feed").Where("guid = '' OR guid IS NULL").Find(&items).Error; err != nil {
+		return err
+	}
+	repaired, removed := 0, 0
+	for _, item := range items {
+		feed := item.Feed
+		feed.ID = item.FeedID
+		guid := itemIdentity(&feed, "", item.Link, item.Title, item.PublishedAt, item.Content)
+		var taken int64
+		if err := db.Unscoped().Model(&Item{}).Where("feed_id = ? AND guid = ?", item.FeedID, guid).Count(&taken).Error; err != nil {
+			return err
+		}
+		if taken > 0 {
+			if err := deleteItems(db, []uint{item.ID}); err != nil {
+				return err
+			}
+			removed++
+			continue
+		}
+		if err := db.Unscoped().Model(&Item{}).Where("id = ?", item.ID).UpdateColumn("guid", guid).Error; err != nil {
+			return err
+		}
+		repaired++
+	}
+	if repaired > 0 || removed > 0 {
+		log.Printf("Repaired %d items with an empty GUID, removed %d duplicates of them", repaired, removed)
+	}
+	return nil
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestItemIdentity(t *testing.T) {
+	published := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	feed := &Feed{}
+	feed.ID = 1
+	hash := itemIdentityHash(1, "Title", &published, "<p>Body</p>")
+
+	assert.True(t, strings.HasPrefix(hash, "hash:"))
+	assert.Equal(t, hash, itemIdentityHash(1, "Title", &published, "<p>Body</p>"), "Hashes should be deterministic")
+	assert.NotEqual(t, hash, itemIdentityHash(2, "Title", &published, "<p>Body</p>"), "Hashes should differ between feeds")
+	assert.NotEqual(t, hash, itemIdentityHash(1, "Title", nil, "<p>Body</p>"))
+
+	assert.Equal(t, "guid-1", itemIdentity(feed, " guid-1 ", "https://example.com/a", "Title", &published, "<p>Body</p>"))
+	assert.Equal(t, "https://example.com/a", itemIdentity(feed, "", "https://example.com/a", "Title", &published, "<p>Body</p>"))
+	assert.Equal(t, hash, itemIdentity(feed, "", "", "Title", &published, "<p>Body</p>"))
+
+	feed.ItemIdentity = ItemIdentityLink
+	assert.Equal(t, "https://example.com/a", itemIdentity(feed, "guid-1", "https://example.com/a", "Title", &published, "<p>Body</p>"))
+	assert.Equal(t, hash, itemIdentity(feed, "guid-1", "", "Title", &published, "<p>Body</p>"))
+
+	feed.ItemIdentity = ItemIdentityHash
+	assert.Equal(t, hash, itemIdentity(feed, "guid-1", "https://example.com/a", "Title", &published, "<p>Body</p>"))
+
+	feed.ItemIdentity = "bogus"
+	assert.Equal(t, ItemIdentityGUID, feed.IdentityStrategy())
+}
+
+func TestFeedFetcher_ItemsWithoutIdentifiers(t *testing.T) {
+	fetcher, _ := newTestFetcher(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/rss+xml")
+		w.Write([]byte(`<?xml version="1.0"?><rss version="2.0"><channel><title>Notes</title>
+<item><title>First note</title><description>One</description></item>
+<item><title>Second note</title><description>Two</description></item>
+</channel></rss>`))
+	}))
+	defer server.Close()
+
+	feed := Feed{URL: server.URL}
+	fetcher.DB.Create(&feed)
+	for i := 0; i < 2; i++ {
+		_, err := fetcher.Fetch(context.Background(), &feed)
+		assert.NoError(t, err)
+	}
+
+	var items []Item
+	fetcher.DB.Order("id").Find(&items)
+	if !assert.Len(t, items, 2, "Items without GUID or link should not collapse into one, nor be stored again") {
+		return
+	}
+	for _, item := range items {
+		assert.True(t, strings.HasPrefix(item.GUID, "hash:"), "GUID %q", item.GUID)
+	}
+	assert.NotEqual(t, items[0].GUID, items[1].GUID)
+}
+
+func TestFeedFetcher_LinkIdentityIgnoresRotatingGUIDs(t *testing.T) {
+	fetcher, _ := newTestFetcher(t)
+	fetches := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		w.Header().Set("Content-Type", "application/rss+xml")
+		w.Write([]byte(`<?xml version="1.0"?><rss version="2.0"><channel><title>Rotating</title>
+<item><title>Story</title><guid>session-` + strconv.Itoa(fetches) + `</guid><link>https://example.com/story</link></item>
+</channel></rss>`))
+	}))
+	defer server.Close()
+
+	feed := Feed{URL: server.URL, ItemIdentity: ItemIdentityLink}
+	fetcher.DB.Create(&feed)
+	for i := 0; i < 2; i++ {
+		_, err := fetcher.Fetch(context.Background(), &feed)
+		assert.NoError(t, err)
+	}
+
+	var items []Item
+	fetcher.DB.Find(&items)
+	if assert.Len(t, items, 1) {
+		assert.Equal(t, "https://example.com/story", items[0].GUID)
+	}
+}
+
+func TestSetFeedItemIdentity_RekeysStoredItems(t *testing.T) {
+	fetcher, _ := newTestFetcher(t)
+	fetches := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		w.Header().Set("Content-Type", "application/rss+xml")
+		w.Write([]byte(`<?xml version="1.0"?><rss version="2.0"><channel><title>Rotating</title>
+<item><title>Story</title><guid>session-` + strconv.Itoa(fetches) + `</guid><link>https://example.com/story</link></item>
+<item><title>Note</title><guid>note</guid><description>No link</description></item>
+</channel></rss>`))
+	}))
+	defer server.Close()
+
+	feed := Feed{URL: server.URL}
+	fetcher.DB.Create(&feed)
+	for i := 0; i < 2; i++ {
+		_, err := fetcher.Fetch(context.Background(), &feed)
+		assert.NoError(t, err)
+	}
+	var count int64
+	fetcher.DB.Model(&Item{}).Count(&count)
+	assert.Equal(t, int64(3), count, "The rotating GUID stores the story twice")
+
+	rekeyed, removed, err := setFeedItemIdentity(fetcher.DB, &feed, ItemIdentityLink)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, rekeyed)
+	assert.Equal(t, 1, removed, "Should merge the copies of the story")
+
+	var guids []string
+	fetcher.DB.Model(&Item{}).Order("title").Pluck("guid", &guids)
+	if assert.Len(t, guids, 2) {
+		assert.True(t, strings.HasPrefix(guids[0], "hash:"), "Items without a link should fall back to a hash")
+		assert.Equal(t, "https://example.com/story", guids[1])
+	}
+
+	// The next fetch updates the re-keyed items instead of storing them again
+	feed.ETag, feed.LastModified = "", ""
+	result, err := fetcher.Fetch(context.Background(), &feed)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, result.Created)
+	fetcher.DB.Model(&Item{}).Count(&count)
+	assert.Equal(t, int64(2), count)
+
+	// Switching back uses the GUIDs the publisher last sent
+	_, _, err = setFeedItemIdentity(fetcher.DB, &feed, ItemIdentityGUID)
+	assert.NoError(t, err)
+	fetcher.DB.Model(&Item{}).Order("guid").Pluck("guid", &guids)
+	assert.Equal(t, []string{"note", "session-3"}, guids)
+}
+
+func TestSetFeedItemIdentity_KeepsStarsAndNotes(t *testing.T) {
+	db := setupTestDB(t)
+	feed := Feed{URL: "https://example.com/feed.xml"}
+	db.Create(&feed)
+	starred := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	older := Item{FeedID: feed.ID, GUID: "session-1", SourceGUID: "session-1", Link: "https://example.com/story", StarredAt: &starred, Note: "Follow up"}
+	db.Create(&older)
+	newer := Item{FeedID: feed.ID, GUID: "session-2", SourceGUID: "session-2", Link: "https://example.com/story", Note: "Quoted in the newsletter"}
+	db.Create(&newer)
+
+	_, removed, err := setFeedItemIdentity(db, &feed, ItemIdentityLink)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, removed)
+
+	var items []Item
+	db.Unscoped().Find(&items)
+	if assert.Len(t, items, 1) {
+		assert.Equal(t, newer.ID, items[0].ID)
+		if assert.NotNil(t, items[0].StarredAt, "Should keep the star of the removed copy") {
+			assert.True(t, items[0].StarredAt.Equal(starred))
+		}
+		assert.Equal(t, "Quoted in the newsletter\n\nFollow up", items[0].Note, "Should keep the notes of both copies")
+	}
+}
+
+func TestAutoMigrateAll_BackfillsSourceGUIDs(t *testing.T) {
+	db := setupTestDB(t)
+	feed := Feed{URL: "https://example.com/feed.xml"}
+	db.Create(&feed)
+	db.Create(&Item{FeedID: feed.ID, GUID: "published"})
+	db.Create(&Item{FeedID: feed.ID, GUID: "hash:abc"})
+
+	// Simulate items stored before source GUIDs existed
+	db.Exec("UPDATE items SET source_guid = NULL")
+	assert.NoError(t, AutoMigrateAll(db))
+
+	var sources []string
+	db.Model(&Item{}).Order("id").Pluck("source_guid", &sources)
+	assert.Equal(t, []string{"published", ""}, sources)
+}
+
+func TestAutoMigrateAll_RepairsEmptyGUIDs(t *testing.T) {
+	db := setupTestDB(t)
+	feed := Feed{URL: "https://example.com/feed.xml"}
+	db.Create(&feed)
+	stale := Item{FeedID: feed.ID, GUID: "", Title: "Note", Content: "Body"}
+	db.Create(&stale)
+	linked := Item{FeedID: feed.ID, GUID: "a", Title: "Linked", Link: "https://example.com/a"}
+	db.Create(&linked)
+
+	assert.NoError(t, AutoMigrateAll(db))
+
+	var repaired Item
+	db.First(&repaired, stale.ID)
+	assert.Equal(t, itemIdentityHash(feed.ID, "Note", nil, "Body"), repaired.GUID)
+
+	// A row whose computed identifier is already stored is a stale copy
+	copyOfLinked := Item{FeedID: feed.ID, GUID: "", Title: "Linked", Link: "https://example.com/a"}
+	db.Create(&copyOfLinked)
+	db.Model(&Item{}).Where("id = ?", linked.ID).UpdateColumn("guid", "https://example.com/a")
+	assert.NoError(t, repairEmptyGUIDs(db))
+
+	var count int64
+	db.Model(&Item{}).Where("id = ?", copyOfLinked.ID).Count(&count)
+	assert.Zero(t, count)
+	db.Model(&Item{}).Where("id = ?", linked.ID).Count(&count)
+	assert.Equal(t, int64(1), count)
+}
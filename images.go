@@ -0,0 +1,140 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/mmcdole/gofeed"
+	ext "github.com/mmcdole/gofeed/extensions"
+)
+
+// leadImage is the picture shown next to an item, with its dimensions if the feed declares them
+type leadImage struct {
+	URL    string
+	Width  int // 0 if unknown
+	Height int // 0 if unknown
+}
+
+// buildLeadImage picks an item's lead image from, in order: gofeed's Item.Image, media:thumbnail,
+// Media RSS image content, an image enclosure, or the first <img> of the sanitized content.
+// Relative URLs are resolved against the item link; only http(s) images are used and tracking
+// pixels are skipped. Dimensions come from whichever source declares them for the chosen URL
+func buildLeadImage(item *gofeed.Item, enclosures []Enclosure, sanitizedContent string) leadImage {
+	sizes := map[string][2]int{}
+	pixels := map[string]bool{}
+	var candidates []string
+	add := func(rawURL, width, height string, candidate bool) {
+		resolved := resolveImageURL(rawURL, item.Link)
+		if resolved == "" {
+			return
+		}
+		if candidate {
+			candidates = append(candidates, resolved)
+		}
+		w, h := int(parseNonNegativeInt64(width)), int(parseNonNegativeInt64(height))
+		if size := sizes[resolved]; w > 0 && h > 0 && size[0] == 0 {
+			sizes[resolved] = [2]int{w, h}
+		}
+	}
+
+	add(declaredItemImage(item), "", "", true)
+	for _, thumbnail := range mediaRSSThumbnails(item.Extensions) {
+		add(thumbnail.Attrs["url"], thumbnail.Attrs["width"], thumbnail.Attrs["height"], true)
+	}
+	for _, content := range mediaRSSContents(item.Extensions) {
+		isImage := content.Attrs["medium"] == "image" || strings.HasPrefix(content.Attrs["type"], "image/")
+		add(content.Attrs["url"], content.Attrs["width"], content.Attrs["height"], isImage)
+	}
+	for _, enclosure := range enclosures {
+		if enclosure.Kind() == "image" {
+			add(enclosure.URL, "", "", true)
+		}
+	}
+	// Every <img> contributes its dimensions, and gofeed's Item.Image may be a tracking pixel
+	// taken from the raw content, so the whole document is scanned
+	if doc, err := goquery.NewDocumentFromReader(strings.NewReader(sanitizedContent)); err == nil {
+		doc.Find("img[src]").Each(func(_ int, img *goquery.Selection) {
+			src, width, height := img.AttrOr("src", ""), img.AttrOr("width", ""), img.AttrOr("height", "")
+			if width == "1" || height == "1" {
+				if resolved := resolveImageURL(src, item.Link); resolved != "" {
+					pixels[resolved] = true
+				}
+				return
+			}
+			add(src, width, height, true)
+		})
+	}
+
+	for _, candidate := range candidates {
+		if !pixels[candidate] {
+			return leadImage{URL: candidate, Width: sizes[candidate][0], Height: sizes[candidate][1]}
+		}
+	}
+	return leadImage{}
+}
+
+// declaredItemImage returns the image the item declares for itself. For RSS, gofeed falls back
+// to the first <img> of the raw content when an item declares none; that image ranks with the
+// content images instead
+func declaredItemImage(item *gofeed.Item) string {
+	if item.ITunesExt != nil && item.ITunesExt.Image != "" {
+		return item.ITunesExt.Image
+	}
+	if item.Image == nil {
+		return ""
+	}
+	for _, raw := range []string{item.Content, item.Description} {
+		doc, err := goquery.NewDocumentFromReader(strings.NewReader(raw))
+		if err != nil {
+			continue
+		}
+		if src, ok := doc.Find("img[src]").First().Attr("src"); ok {
+			if src == item.Image.URL {
+				return ""
+			}
+			break
+		}
+	}
+	return item.Image.URL
+}
+
+// mediaRSSThumbnails returns the media:thumbnail elements of an item, including those in
+// media:group and media:content
+func mediaRSSThumbnails(extensions ext.Extensions) []ext.Extension {
+	media, ok := extensions["media"]
+	if !ok {
+		return nil
+	}
+	thumbnails := append([]ext.Extension{}, media["thumbnail"]...)
+	for _, group := range media["group"] {
+		thumbnails = append(thumbnails, group.Children["thumbnail"]...)
+	}
+	for _, content := range mediaRSSContents(extensions) {
+		thumbnails = append(thumbnails, content.Children["thumbnail"]...)
+	}
+	return thumbnails
+}
+
+// resolveImageURL resolves an image URL against the item link and returns it if it is http(s), "" otherwise
+func resolveImageURL(rawURL, base string) string {
+	rawURL = strings.TrimSpace(rawURL)
+	if rawURL == "" {
+		return ""
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	if !u.IsAbs() {
+		baseURL, err := url.Parse(base)
+		if err != nil || !baseURL.IsAbs() {
+			return ""
+		}
+		u = baseURL.ResolveReference(u)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ""
+	}
+	return u.String()
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mmcdole/gofeed"
+	"github.com/stretchr/testify/assert"
+)
+
+const testImagesRSS = `<?xml version="1.0"?>
+<rss version="2.0" xmlns:media="http://search.yahoo.com/mrss/">
+<channel><title>Photos</title>
+<item><title>Thumbnail</title><guid>thumb</guid><link>http://example.com/posts/thumb</link>
+  <media:thumbnail url="/images/thumb.jpg" width="320" height="180"/>
+  <description><![CDATA[<p><img src="/images/inline.png" width="800" height="600"></p>]]></description>
+</item>
+<item><title>Group</title><guid>group</guid>
+  <media:group>
+    <media:content url="http://example.com/clip.mp4" type="video/mp4">
+      <media:thumbnail url="http://example.com/clip.jpg" width="640" height="360"/>
+    </media:content>
+  </media:group>
+</item>
+<item><title>Enclosure</title><guid>enclosure</guid>
+  <enclosure url="http://example.com/photo.jpg" length="1024" type="image/jpeg"/>
+</item>
+<item><title>Inline</title><guid>inline</guid><link>http://example.com/posts/inline</link>
+  <description><![CDATA[<img src="http://tracker.example.com/pixel.gif" width="1" height="1"><img src="cover.png" width="400" height="300">]]></description>
+</item>
+<item><title>Unsafe</title><guid>unsafe</guid>
+  <description><![CDATA[<img src="data:image/png;base64,AAAA"><img src="relative.png">]]></description>
+</item>
+</channel></rss>`
+
+func TestBuildItems_LeadImage(t *testing.T) {
+	parsed, err := gofeed.NewParser().ParseString(testImagesRSS)
+	if !assert.NoError(t, err) {
+		return
+	}
+	rows := buildItems(&Feed{}, parsed.Items)
+	if !assert.Len(t, rows, 5) {
+		return
+	}
+
+	assert.Equal(t, "http://example.com/images/thumb.jpg", rows[0].ImageURL, "media:thumbnail should win over inline images and resolve against the link")
+	assert.Equal(t, 320, rows[0].ImageWidth)
+	assert.Equal(t, 180, rows[0].ImageHeight)
+
+	assert.Equal(t, "http://example.com/clip.jpg", rows[1].ImageURL, "Should find thumbnails nested in media:group content")
+	assert.Equal(t, 640, rows[1].ImageWidth)
+
+	assert.Equal(t, "http://example.com/photo.jpg", rows[2].ImageURL, "Should use an image enclosure")
+	assert.Zero(t, rows[2].ImageWidth, "Dimensions should be 0 when unknown")
+
+	assert.Equal(t, "http://example.com/posts/cover.png", rows[3].ImageURL, "Should skip tracking pixels")
+	assert.Equal(t, 400, rows[3].ImageWidth)
+	assert.Equal(t, 300, rows[3].ImageHeight)
+
+	assert.Empty(t, rows[4].ImageURL, "Should ignore data URIs and relative URLs without a link to resolve them")
+}
+
+func TestBuildLeadImage_ItemImageFirst(t *testing.T) {
+	item := &gofeed.Item{
+		Link:       "http://example.com/post",
+		Image:      &gofeed.Image{URL: "http://example.com/cover.jpg"},
+		Enclosures: []*gofeed.Enclosure{{URL: "http://example.com/other.jpg", Type: "image/jpeg"}},
+	}
+	image := buildLeadImage(item, buildEnclosures(item), `<img src="http://example.com/cover.jpg" width="1200" height="630">`)
+	assert.Equal(t, leadImage{URL: "http://example.com/cover.jpg", Width: 1200, Height: 630}, image,
+		"Should prefer Item.Image and take its dimensions from the content")
+}
+
+func TestBuildItems_DeclaredImageInContent(t *testing.T) {
+	parsed, err := gofeed.NewParser().ParseString(`<?xml version="1.0"?>
+<rss version="2.0" xmlns:itunes="http://www.itunes.com/dtds/podcast-1.0.dtd" xmlns:media="http://search.yahoo.com/mrss/"><channel><title>Episodes</title>
+<item><title>Episode</title><link>http://example.com/episode</link>
+<itunes:image href="http://example.com/cover.jpg"/>
+<media:thumbnail url="http://example.com/thumb.jpg" width="160" height="90"/>
+<description>&lt;img src="http://example.com/cover.jpg" width="1400" height="1400"&gt;</description></item>
+</channel></rss>`)
+	if !assert.NoError(t, err) {
+		return
+	}
+	rows := buildItems(&Feed{}, parsed.Items)
+	if assert.Len(t, rows, 1) {
+		assert.Equal(t, "http://example.com/cover.jpg", rows[0].ImageURL, "The item's own image should win even when the content shows it")
+		assert.Equal(t, 1400, rows[0].ImageWidth)
+	}
+}
+
+func TestFeedFetcher_FetchStoresLeadImage(t *testing.T) {
+	fetcher, _ := newTestFetcher(t)
+	body := testImagesRSS
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/rss+xml")
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	feed := Feed{URL: server.URL}
+	fetcher.DB.Create(&feed)
+	_, err := fetcher.Fetch(context.Background(), &feed)
+	assert.NoError(t, err)
+
+	var item Item
+	fetcher.DB.Where("guid = ?", "thumb").First(&item)
+	assert.Equal(t, "http://example.com/images/thumb.jpg", item.ImageURL)
+	assert.Equal(t, 320, item.ImageWidth)
+
+	// A new thumbnail alone updates the image without counting as an edit
+	body = strings.Replace(testImagesRSS, `url="/images/thumb.jpg" width="320" height="180"`, `url="/images/thumb-2.jpg" width="160" height="90"`, 1)
+	feed.ETag, feed.LastModified = "", ""
+	result, err := fetcher.Fetch(context.Background(), &feed)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, result.Updated)
+
+	fetcher.DB.First(&item, item.ID)
+	assert.Equal(t, "http://example.com/images/thumb-2.jpg", item.ImageURL)
+	assert.Equal(t, 160, item.ImageWidth)
+	assert.Equal(t, 90, item.ImageHeight)
+
+	var revisions int64
+	fetcher.DB.Model(&ItemRevision{}).Count(&revisions)
+	assert.Zero(t, revisions)
+}
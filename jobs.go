@@ -0,0 +1,471 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxFetchJobAttempts is how often a job is claimed before a job whose workers keep disappearing is given up
+const maxFetchJobAttempts = 3
+
+// fetchJobRetention is how long finished jobs are kept before pruning
+const fetchJobRetention = 24 * time.Hour
+
+// fetchJobClaimWindow is how many available jobs a claim considers when spreading its jobs over hosts
+const fetchJobClaimWindow = 100
+
+// fetchJobPollInterval is how often the background fetcher checks the queue for jobs enqueued by other processes
+const fetchJobPollInterval = 5 * time.Second
+
+// fetchWorkerBeatInterval is how often a worker records its heartbeat in the database
+const fetchWorkerBeatInterval = fetchJobPollInterval
+
+// fetchJobWake wakes the local worker when a job is enqueued, so manual fetches don't wait for the next tick
+var fetchJobWake = make(chan struct{}, 1)
+
+// EnqueueFetchJob queues a fetch of a feed, unless one is already queued or running
+// (the partial unique index allows a single unfinished job per feed). Enqueuing with a higher
+// priority raises the priority of an already queued job. Returns the feed's unfinished job
+func EnqueueFetchJob(db *gorm.DB, feedID uint, priority int, now time.Time) (*FetchJob, error) {
+	job := FetchJob{FeedID: feedID, Priority: priority, Status: FetchJobQueued, AvailableAt: now}
+	err := db.Clauses(clause.OnConflict{
+		Columns:     []clause.Column{{Name: "feed_id"}},
+		TargetWhere: clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "finished_at IS NULL"}}},
+		DoNothing:   true,
+	}).Create(&job).Error
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Model(&FetchJob{}).
+		Where("feed_id = ? AND status = ? AND priority < ?", feedID, FetchJobQueued, priority).
+		Updates(map[string]interface{}{"priority": priority, "available_at": now}).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var active FetchJob
+	if err := db.Where("feed_id = ? AND finished_at IS NULL", feedID).First(&active).Error; err != nil {
+		return nil, err
+	}
+
+	select {
+	case fetchJobWake <- struct{}{}:
+	default:
+	}
+	return &active, nil
+}
+
+// ClaimFetchJobs leases up to limit jobs to owner until now+lease, highest priority first and
+// spread over as many hosts as possible. Jobs are selected with FOR UPDATE SKIP LOCKED, so
+// concurrent workers on other replicas claim different jobs. Running jobs whose lease expired
+// (their worker crashed) are claimed again, and failed once they were claimed maxFetchJobAttempts times
+func ClaimFetchJobs(db *gorm.DB, owner string, limit int, lease time.Duration, now time.Time) ([]FetchJob, error) {
+	return claimFetchJobs(db, owner, limit, lease, now, nil, nil)
+}
+
+// claimFetchJobs works like ClaimFetchJobs, but only considers the jobs with the given IDs when ids
+// is not empty, and ranks jobs of the hosts in busy (fetches in flight per host) after other hosts.
+// Claimed jobs come with the ID and URL of their Feed
+func claimFetchJobs(db *gorm.DB, owner string, limit int, lease time.Duration, now time.Time, ids []uint, busy map[string]int) ([]FetchJob, error) {
+	var jobs []FetchJob
+	err := db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&FetchJob{}).
+			Where("status = ? AND lease_expires_at < ? AND attempts >= ?", FetchJobRunning, now, maxFetchJobAttempts).
+			Updates(map[string]interface{}{
+				"status":      FetchJobFailed,
+				"error":       fmt.Sprintf("lease expired %d times", maxFetchJobAttempts),
+				"finished_at": now,
+			}).Error
+		if err != nil {
+			return err
+		}
+
+		query := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("(status = ? AND available_at <= ?) OR (status = ? AND lease_expires_at < ?)",
+				FetchJobQueued, now, FetchJobRunning, now)
+		if len(ids) > 0 {
+			query = query.Where("id IN ?", ids)
+		}
+		var candidates []FetchJob
+		window := limit
+		if window < fetchJobClaimWindow {
+			window = fetchJobClaimWindow
+		}
+		err = query.Order("priority DESC, available_at, id").Limit(window).Find(&candidates).Error
+		if err != nil || len(candidates) == 0 {
+			return err
+		}
+
+		feedIDs := make([]uint, len(candidates))
+		for i := range candidates {
+			feedIDs[i] = candidates[i].FeedID
+		}
+		var feeds []Feed
+		if err := tx.Select("id", "url").Where("id IN ?", feedIDs).Find(&feeds).Error; err != nil {
+			return err
+		}
+		feedsByID := make(map[uint]Feed, len(feeds))
+		hosts := make(map[uint]string, len(feeds))
+		for _, feed := range feeds {
+			feedsByID[feed.ID] = feed
+			hosts[feed.ID] = feedHost(feed.URL)
+		}
+		jobs = pickFetchJobs(candidates, hosts, busy, limit)
+		for i := range jobs {
+			jobs[i].Feed = feedsByID[jobs[i].FeedID]
+		}
+
+		claimed := make([]uint, len(jobs))
+		for i := range jobs {
+			claimed[i] = jobs[i].ID
+		}
+		expiresAt := now.Add(lease)
+		return tx.Model(&FetchJob{}).Where("id IN ?", claimed).Updates(map[string]interface{}{
+			"status":           FetchJobRunning,
+			"lease_owner":      owner,
+			"lease_expires_at": expiresAt,
+			"attempts":         gorm.Expr("attempts + 1"),
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i := range jobs {
+		jobs[i].Status = FetchJobRunning
+		jobs[i].LeaseOwner = owner
+		jobs[i].Attempts++
+	}
+	return jobs, nil
+}
+
+// pickFetchJobs picks up to limit of candidates, which are ordered by priority. Within a priority,
+// jobs of the hosts with the fewest fetches in flight (busy) or already picked come first, so
+// workers spread over many hosts instead of queuing behind the per-host limit of a single one
+func pickFetchJobs(candidates []FetchJob, hosts map[uint]string, busy map[string]int, limit int) []FetchJob {
+	load := make(map[string]int, len(busy))
+	for host, n := range busy {
+		load[host] = n
+	}
+	picked := make([]bool, len(candidates))
+	var jobs []FetchJob
+	for len(jobs) < limit {
+		best := -1
+		for i, job := range candidates {
+			if picked[i] {
+				continue
+			}
+			if best >= 0 && job.Priority < candidates[best].Priority {
+				break
+			}
+			if best < 0 || load[hosts[job.FeedID]] < load[hosts[candidates[best].FeedID]] {
+				best = i
+			}
+		}
+		if best < 0 {
+			break
+		}
+		picked[best] = true
+		load[hosts[candidates[best].FeedID]]++
+		jobs = append(jobs, candidates[best])
+	}
+	return jobs
+}
+
+// finishFetchJob records the outcome of a job, as long as owner still holds its lease
+// Returns false if the lease was lost, i.e. another worker reclaimed the job
+func finishFetchJob(db *gorm.DB, job *FetchJob, owner string, result FetchResult, fetchErr error, now time.Time) bool {
+	updates := map[string]interface{}{
+		"status":        FetchJobDone,
+		"items_created": result.Created,
+		"items_updated": result.Updated,
+		"error":         "",
+		"finished_at":   now,
+	}
+	if fetchErr != nil {
+		updates["status"] = FetchJobFailed
+		updates["error"] = fetchErr.Error()
+	}
+	res := db.Model(&FetchJob{}).
+		Where("id = ? AND lease_owner = ? AND status = ?", job.ID, owner, FetchJobRunning).
+		Updates(updates)
+	if res.Error != nil {
+		log.Printf("Error finishing fetch job %d: %v", job.ID, res.Error)
+		return false
+	}
+	return res.RowsAffected == 1
+}
+
+// releaseFetchJob puts a job whose fetch was aborted back in the queue, as long as owner still holds
+// its lease, so another worker can claim it right away. The aborted claim does not count as an attempt
+func releaseFetchJob(db *gorm.DB, job *FetchJob, owner string) {
+	err := db.Model(&FetchJob{}).
+		Where("id = ? AND lease_owner = ? AND status = ?", job.ID, owner, FetchJobRunning).
+		Updates(map[string]interface{}{
+			"status":           FetchJobQueued,
+			"lease_owner":      "",
+			"lease_expires_at": nil,
+			"attempts":         gorm.Expr("attempts - 1"),
+		}).Error
+	if err != nil {
+		log.Printf("Error releasing fetch job %d: %v", job.ID, err)
+	}
+}
+
+// extendFetchJobLease moves the lease of a running job to now+lease, as long as owner still holds it
+// Returns false if the lease was lost
+func extendFetchJobLease(db *gorm.DB, job *FetchJob, owner string, lease time.Duration, now time.Time) bool {
+	res := db.Model(&FetchJob{}).
+		Where("id = ? AND lease_owner = ? AND status = ?", job.ID, owner, FetchJobRunning).
+		Update("lease_expires_at", now.Add(lease))
+	if res.Error != nil {
+		log.Printf("Error extending the lease of fetch job %d: %v", job.ID, res.Error)
+		return false
+	}
+	return res.RowsAffected == 1
+}
+
+// FetchWorker claims fetch jobs from the queue and runs them with a FeedFetcher
+type FetchWorker struct {
+	DB      *gorm.DB
+	Fetcher *FeedFetcher
+	Owner   string        // Identifies this worker in job leases
+	Lease   time.Duration // How long a claimed job is leased before other workers may reclaim it
+
+	lastBeat time.Time // When beat last recorded the heartbeat in the database
+}
+
+// NewFetchWorker creates a FetchWorker with a unique owner ID and FETCH_JOB_LEASE
+func NewFetchWorker(db *gorm.DB) *FetchWorker {
+	return &FetchWorker{
+		DB:      db,
+		Fetcher: NewFeedFetcher(db),
+		Owner:   newWorkerID(),
+		Lease:   time.Duration(GetFetchJobLease()) * time.Second,
+	}
+}
+
+// Drain runs w.Fetcher.Workers workers that each claim and run one job at a time, until the queue
+// has no available jobs or ctx is cancelled. Jobs run with workCtx: once ctx is cancelled no new job
+// is claimed, but the ones in flight finish unless workCtx is cancelled too. Returns statistics of the jobs it ran
+func (w *FetchWorker) Drain(ctx, workCtx context.Context) (itemsCreated, itemsUpdated, errors int) {
+	return w.drain(ctx, workCtx, nil)
+}
+
+// DrainJobs works like Drain, but only claims the jobs with the given IDs
+// Processes without a background fetcher use it to run manual fetches themselves
+func (w *FetchWorker) DrainJobs(ctx, workCtx context.Context, ids []uint) (itemsCreated, itemsUpdated, errors int) {
+	if len(ids) == 0 {
+		return
+	}
+	return w.drain(ctx, workCtx, ids)
+}
+
+// drain runs Drain, limited to the jobs with the given IDs when ids is not empty
+// Workers claim a new job as soon as they finish one, so a slow feed only holds up its own worker
+func (w *FetchWorker) drain(ctx, workCtx context.Context, ids []uint) (itemsCreated, itemsUpdated, errors int) {
+	var mu sync.Mutex
+	busy := make(map[string]int) // Jobs in flight per host
+	var wg sync.WaitGroup
+	for i := 0; i < w.workerCount(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil && workCtx.Err() == nil {
+				mu.Lock()
+				if len(ids) == 0 {
+					w.beat()
+				}
+				jobs, err := claimFetchJobs(w.DB, w.Owner, 1, w.Lease, w.Fetcher.Now(), ids, busy)
+				if err != nil {
+					log.Printf("Error claiming fetch jobs: %v", err)
+				}
+				if len(jobs) == 0 {
+					mu.Unlock()
+					return
+				}
+				host := feedHost(jobs[0].Feed.URL)
+				busy[host]++
+				mu.Unlock()
+
+				result, err := w.run(workCtx, &jobs[0])
+
+				mu.Lock()
+				busy[host]--
+				itemsCreated += result.Created
+				itemsUpdated += result.Updated
+				errors += result.Errors
+				if err != nil {
+					errors++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return
+}
+
+// beat records that the background fetcher is making progress: in this process, and in the
+// database at most every fetchWorkerBeatInterval so other processes see that a worker is running
+func (w *FetchWorker) beat() {
+	beatFetcherHeartbeat()
+	now := time.Now()
+	if now.Sub(w.lastBeat) < fetchWorkerBeatInterval {
+		return
+	}
+	w.lastBeat = now
+	err := w.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "owner"}},
+		DoUpdates: clause.AssignmentColumns([]string{"beat_at"}),
+	}).Create(&FetchWorkerHeartbeat{Owner: w.Owner, BeatAt: now}).Error
+	if err != nil {
+		log.Printf("Error recording the heartbeat of fetch worker %s: %v", w.Owner, err)
+	}
+}
+
+// retire removes the worker's heartbeat, so other processes stop relying on it right away
+func (w *FetchWorker) retire() {
+	if err := w.DB.Delete(&FetchWorkerHeartbeat{Owner: w.Owner}).Error; err != nil {
+		log.Printf("Error removing the heartbeat of fetch worker %s: %v", w.Owner, err)
+	}
+}
+
+// hasLiveFetchWorker reports whether any process's background fetcher recorded a heartbeat within fetcherStaleAfter
+func hasLiveFetchWorker(db *gorm.DB, now time.Time) bool {
+	var count int64
+	if err := db.Model(&FetchWorkerHeartbeat{}).Where("beat_at > ?", now.Add(-fetcherStaleAfter())).Count(&count).Error; err != nil {
+		log.Printf("Error checking fetch worker heartbeats: %v", err)
+		return false
+	}
+	return count > 0
+}
+
+// run fetches the feed of a claimed job and records the outcome on the job
+// Scheduled jobs of feeds that were paused in the meantime are skipped
+// If ctx is cancelled mid-fetch the job is put back in the queue for other workers
+func (w *FetchWorker) run(ctx context.Context, job *FetchJob) (FetchResult, error) {
+	var feed Feed
+	if err := w.DB.First(&feed, job.FeedID).Error; err != nil {
+		finishFetchJob(w.DB, job, w.Owner, FetchResult{}, err, w.Fetcher.Now())
+		return FetchResult{}, err
+	}
+	if feed.PausedAt != nil && job.Priority <= FetchJobPriorityScheduled {
+		finishFetchJob(w.DB, job, w.Owner, FetchResult{}, nil, w.Fetcher.Now())
+		return FetchResult{}, nil
+	}
+
+	// Keep the lease while the fetch runs: full article extraction can take longer than one lease
+	done := make(chan struct{})
+	defer close(done)
+	go w.keepLease(job, done)
+
+	result, err := w.Fetcher.Fetch(ctx, &feed)
+	if err != nil && ctx.Err() != nil {
+		releaseFetchJob(w.DB, job, w.Owner)
+		return result, err
+	}
+	if !finishFetchJob(w.DB, job, w.Owner, result, err, w.Fetcher.Now()) {
+		log.Printf("Lost the lease of fetch job %d for feed %s", job.ID, feed.URL)
+	}
+	return result, err
+}
+
+// keepLease extends the lease of job every third of w.Lease until done is closed or the lease is lost
+func (w *FetchWorker) keepLease(job *FetchJob, done <-chan struct{}) {
+	interval := w.Lease / 3
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if !extendFetchJobLease(w.DB, job, w.Owner, w.Lease, w.Fetcher.Now()) {
+				return
+			}
+		}
+	}
+}
+
+// workerCount returns how many jobs drain runs at once: one per fetch worker
+func (w *FetchWorker) workerCount() int {
+	if w.Fetcher.Workers < 1 {
+		return 1
+	}
+	return w.Fetcher.Workers
+}
+
+// waitForFetchJobs polls the given jobs until all have finished or timeout passes
+// Returns the jobs as last read; unfinished jobs have a nil FinishedAt
+func waitForFetchJobs(ctx context.Context, db *gorm.DB, ids []uint, timeout time.Duration) []FetchJob {
+	deadline := time.Now().Add(timeout)
+	ticker := time.NewTicker(200 * time.Millisecond)
+	defer ticker.Stop()
+
+	var jobs []FetchJob
+	for {
+		db.Where("id IN ?", ids).Find(&jobs)
+		finished := 0
+		for _, job := range jobs {
+			if job.FinishedAt != nil {
+				finished++
+			}
+		}
+		if finished == len(jobs) || time.Now().After(deadline) {
+			return jobs
+		}
+		select {
+		case <-ctx.Done():
+			return jobs
+		case <-ticker.C:
+		}
+	}
+}
+
+// pruneFetchJobs deletes jobs that finished, and heartbeats of workers last seen, more than
+// fetchJobRetention before now. Returns the number of jobs deleted
+func pruneFetchJobs(db *gorm.DB, now time.Time) (int64, error) {
+	if err := db.Where("beat_at < ?", now.Add(-fetchJobRetention)).Delete(&FetchWorkerHeartbeat{}).Error; err != nil {
+		return 0, err
+	}
+	result := db.Where("finished_at < ?", now.Add(-fetchJobRetention)).Delete(&FetchJob{})
+	return result.RowsAffected, result.Error
+}
+
+// runFetchJobPruning prunes finished fetch jobs and logs the outcome
+func runFetchJobPruning() {
+	deleted, err := pruneFetchJobs(DB, time.Now())
+	if err != nil {
+		log.Printf("Error pruning fetch jobs: %v", err)
+		return
+	}
+	if deleted > 0 {
+		log.Printf("Pruned %d finished fetch jobs", deleted)
+	}
+}
+
+// newWorkerID returns an ID for this process's job leases: host name, process ID and a random suffix
+func newWorkerID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return fmt.Sprintf("%s-%d", host, os.Getpid())
+	}
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), hex.EncodeToString(suffix))
+}
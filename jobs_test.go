@@ -0,0 +1,449 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnqueueFetchJob(t *testing.T) {
+	db := setupTestDB(t)
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	feed := Feed{URL: "http://example.com/feed.xml"}
+	db.Create(&feed)
+
+	first, err := EnqueueFetchJob(db, feed.ID, FetchJobPriorityScheduled, now)
+	assert.NoError(t, err)
+	assert.Equal(t, FetchJobQueued, first.Status)
+
+	// A second request joins the unfinished job and raises its priority
+	second, err := EnqueueFetchJob(db, feed.ID, FetchJobPriorityManual, now.Add(time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, first.ID, second.ID, "Should not queue a second job for the same feed")
+	assert.Equal(t, FetchJobPriorityManual, second.Priority)
+
+	// A lower priority does not lower it again
+	third, err := EnqueueFetchJob(db, feed.ID, FetchJobPriorityScheduled, now)
+	assert.NoError(t, err)
+	assert.Equal(t, FetchJobPriorityManual, third.Priority)
+
+	var count int64
+	db.Model(&FetchJob{}).Count(&count)
+	assert.Equal(t, int64(1), count)
+
+	// Once the job finished, the feed can be queued again
+	db.Model(&FetchJob{}).Where("id = ?", first.ID).Updates(map[string]interface{}{"status": FetchJobDone, "finished_at": now})
+	next, err := EnqueueFetchJob(db, feed.ID, FetchJobPriorityScheduled, now)
+	assert.NoError(t, err)
+	assert.NotEqual(t, first.ID, next.ID)
+}
+
+func TestClaimFetchJobs(t *testing.T) {
+	db := setupTestDB(t)
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	lease := 5 * time.Minute
+
+	feeds := []Feed{{URL: "http://example.com/a"}, {URL: "http://example.com/b"}, {URL: "http://example.com/c"}}
+	db.Create(&feeds)
+	scheduled, _ := EnqueueFetchJob(db, feeds[0].ID, FetchJobPriorityScheduled, now.Add(-time.Minute))
+	manual, _ := EnqueueFetchJob(db, feeds[1].ID, FetchJobPriorityManual, now)
+	later, _ := EnqueueFetchJob(db, feeds[2].ID, FetchJobPriorityManual, now.Add(time.Hour))
+
+	jobs, err := ClaimFetchJobs(db, "worker-1", 1, lease, now)
+	assert.NoError(t, err)
+	if assert.Len(t, jobs, 1) {
+		assert.Equal(t, manual.ID, jobs[0].ID, "Should claim the highest priority first")
+	}
+
+	// The other worker gets the remaining available job, not the claimed one or the one not yet available
+	jobs, err = ClaimFetchJobs(db, "worker-2", 10, lease, now)
+	assert.NoError(t, err)
+	if assert.Len(t, jobs, 1) {
+		assert.Equal(t, scheduled.ID, jobs[0].ID)
+	}
+
+	var claimed FetchJob
+	db.First(&claimed, manual.ID)
+	assert.Equal(t, FetchJobRunning, claimed.Status)
+	assert.Equal(t, "worker-1", claimed.LeaseOwner)
+	assert.Equal(t, 1, claimed.Attempts)
+	if assert.NotNil(t, claimed.LeaseExpiresAt) {
+		assert.True(t, claimed.LeaseExpiresAt.Equal(now.Add(lease)))
+	}
+
+	jobs, err = ClaimFetchJobs(db, "worker-2", 10, lease, now)
+	assert.NoError(t, err)
+	assert.Empty(t, jobs)
+
+	jobs, err = ClaimFetchJobs(db, "worker-2", 10, lease, now.Add(time.Hour))
+	assert.NoError(t, err)
+	ids := []uint{}
+	for _, job := range jobs {
+		ids = append(ids, job.ID)
+	}
+	assert.Contains(t, ids, later.ID, "Should claim the job once it is available")
+}
+
+func TestClaimFetchJobs_ExpiredLease(t *testing.T) {
+	db := setupTestDB(t)
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	lease := 5 * time.Minute
+	feed := Feed{URL: "http://example.com/feed.xml"}
+	db.Create(&feed)
+	job, _ := EnqueueFetchJob(db, feed.ID, FetchJobPriorityManual, now)
+
+	// The worker holding the lease crashes; the job is reclaimed once the lease expired
+	for attempt := 1; attempt <= maxFetchJobAttempts; attempt++ {
+		jobs, err := ClaimFetchJobs(db, "worker", 1, lease, now)
+		assert.NoError(t, err)
+		if assert.Len(t, jobs, 1, "attempt %d", attempt) {
+			assert.Equal(t, job.ID, jobs[0].ID)
+			assert.Equal(t, attempt, jobs[0].Attempts)
+		}
+		now = now.Add(lease + time.Second)
+	}
+
+	// After maxFetchJobAttempts claims the job is given up
+	jobs, err := ClaimFetchJobs(db, "worker", 1, lease, now)
+	assert.NoError(t, err)
+	assert.Empty(t, jobs)
+
+	var failed FetchJob
+	db.First(&failed, job.ID)
+	assert.Equal(t, FetchJobFailed, failed.Status)
+	assert.NotNil(t, failed.FinishedAt)
+	assert.Contains(t, failed.Error, "lease expired")
+}
+
+func TestClaimFetchJobs_SpreadsOverHosts(t *testing.T) {
+	db := setupTestDB(t)
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	feeds := []Feed{
+		{URL: "https://reddit.com/r/a.rss"},
+		{URL: "https://reddit.com/r/b.rss"},
+		{URL: "https://reddit.com/r/c.rss"},
+		{URL: "https://example.com/feed.xml"},
+		{URL: "https://example.org/feed.xml"},
+	}
+	db.Create(&feeds)
+	for i, feed := range feeds {
+		EnqueueFetchJob(db, feed.ID, FetchJobPriorityScheduled, now.Add(time.Duration(i)*time.Second))
+	}
+
+	jobs, err := ClaimFetchJobs(db, "worker", 3, time.Minute, now.Add(time.Minute))
+	assert.NoError(t, err)
+	var urls []string
+	for _, job := range jobs {
+		urls = append(urls, job.Feed.URL)
+	}
+	assert.Equal(t, []string{feeds[0].URL, feeds[3].URL, feeds[4].URL}, urls, "Should claim one job per host first")
+
+	// Hosts with fetches in flight rank after idle ones
+	jobs, err = claimFetchJobs(db, "worker", 1, time.Minute, now.Add(time.Minute), nil, map[string]int{"reddit.com": 1})
+	assert.NoError(t, err)
+	if assert.Len(t, jobs, 1) {
+		assert.Equal(t, feeds[1].URL, jobs[0].Feed.URL, "Should still claim a busy host's job when no other host has one")
+	}
+
+	// Priority comes before spreading
+	other := Feed{URL: "https://example.com/other.xml"}
+	db.Create(&other)
+	manual, _ := EnqueueFetchJob(db, other.ID, FetchJobPriorityManual, now)
+	jobs, err = claimFetchJobs(db, "worker", 1, time.Minute, now.Add(time.Minute), nil, map[string]int{"example.com": 1})
+	assert.NoError(t, err)
+	if assert.Len(t, jobs, 1) {
+		assert.Equal(t, manual.ID, jobs[0].ID)
+	}
+}
+
+func TestFinishFetchJob_LostLease(t *testing.T) {
+	db := setupTestDB(t)
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	feed := Feed{URL: "http://example.com/feed.xml"}
+	db.Create(&feed)
+	EnqueueFetchJob(db, feed.ID, FetchJobPriorityManual, now)
+
+	stale, _ := ClaimFetchJobs(db, "worker-1", 1, time.Minute, now)
+	fresh, _ := ClaimFetchJobs(db, "worker-2", 1, time.Minute, now.Add(2*time.Minute))
+	assert.Len(t, stale, 1)
+	assert.Len(t, fresh, 1)
+
+	assert.False(t, finishFetchJob(db, &stale[0], "worker-1", FetchResult{Created: 1}, nil, now), "Should not finish a job another worker reclaimed")
+	assert.True(t, finishFetchJob(db, &fresh[0], "worker-2", FetchResult{Created: 2}, nil, now))
+
+	var job FetchJob
+	db.First(&job, fresh[0].ID)
+	assert.Equal(t, FetchJobDone, job.Status)
+	assert.Equal(t, 2, job.ItemsCreated)
+}
+
+func TestExtendFetchJobLease(t *testing.T) {
+	db := setupTestDB(t)
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	feed := Feed{URL: "http://example.com/feed.xml"}
+	db.Create(&feed)
+	EnqueueFetchJob(db, feed.ID, FetchJobPriorityManual, now)
+
+	jobs, _ := ClaimFetchJobs(db, "worker-1", 1, time.Minute, now)
+	if !assert.Len(t, jobs, 1) {
+		return
+	}
+	assert.True(t, extendFetchJobLease(db, &jobs[0], "worker-1", time.Minute, now.Add(50*time.Second)))
+	reclaimed, _ := ClaimFetchJobs(db, "worker-2", 1, time.Minute, now.Add(90*time.Second))
+	assert.Empty(t, reclaimed, "Should not reclaim a job whose lease was extended")
+
+	assert.False(t, extendFetchJobLease(db, &jobs[0], "worker-2", time.Minute, now), "Should not extend another worker's lease")
+}
+
+func TestFetchWorker_Drain(t *testing.T) {
+	fetcher, now := newTestFetcher(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/rss+xml")
+		w.Write([]byte(testRSS))
+	}))
+	defer server.Close()
+
+	pausedAt := now
+	feeds := []Feed{
+		{URL: server.URL + "/feed"},
+		{URL: server.URL + "/missing"},
+		{URL: server.URL + "/paused", PausedAt: &pausedAt},
+	}
+	fetcher.DB.Create(&feeds)
+	for _, feed := range feeds {
+		_, err := EnqueueFetchJob(fetcher.DB, feed.ID, FetchJobPriorityScheduled, now)
+		assert.NoError(t, err)
+	}
+
+	worker := &FetchWorker{DB: fetcher.DB, Fetcher: fetcher, Owner: "test-worker", Lease: time.Minute}
+	created, updated, errors := worker.Drain(context.Background(), context.Background())
+	assert.Equal(t, 2, created)
+	assert.Equal(t, 0, updated)
+	assert.Equal(t, 1, errors)
+
+	var jobs []FetchJob
+	fetcher.DB.Order("feed_id").Find(&jobs)
+	if assert.Len(t, jobs, 3) {
+		assert.Equal(t, FetchJobDone, jobs[0].Status)
+		assert.Equal(t, 2, jobs[0].ItemsCreated)
+		assert.Equal(t, FetchJobFailed, jobs[1].Status)
+		assert.NotEmpty(t, jobs[1].Error)
+		assert.Equal(t, FetchJobDone, jobs[2].Status, "Should skip scheduled jobs of paused feeds")
+		for _, job := range jobs {
+			assert.NotNil(t, job.FinishedAt)
+		}
+	}
+
+	var attempts int64
+	fetcher.DB.Model(&FetchAttempt{}).Where("feed_id = ?", feeds[2].ID).Count(&attempts)
+	assert.Equal(t, int64(0), attempts, "Should not fetch the paused feed")
+}
+
+func TestFetchWorker_DrainDoesNotWaitForSlowJobs(t *testing.T) {
+	fetcher, now := newTestFetcher(t)
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			<-release
+		}
+		w.Header().Set("Content-Type", "application/rss+xml")
+		w.Write([]byte(testRSS))
+	}))
+	defer server.Close()
+	defer close(release)
+
+	feeds := []Feed{{URL: server.URL + "/slow"}, {URL: server.URL + "/a"}, {URL: server.URL + "/b"}, {URL: server.URL + "/c"}}
+	fetcher.DB.Create(&feeds)
+	for i, feed := range feeds {
+		EnqueueFetchJob(fetcher.DB, feed.ID, FetchJobPriorityScheduled, now.Add(time.Duration(i-10)*time.Second))
+	}
+	fetcher.Workers = 2
+
+	worker := &FetchWorker{DB: fetcher.DB, Fetcher: fetcher, Owner: "test-worker", Lease: time.Minute}
+	drained := make(chan struct{})
+	go func() {
+		worker.Drain(context.Background(), context.Background())
+		close(drained)
+	}()
+
+	// The other worker runs every remaining job while the slow one is still in flight
+	assert.Eventually(t, func() bool {
+		var done int64
+		fetcher.DB.Model(&FetchJob{}).Where("status = ?", FetchJobDone).Count(&done)
+		return done == 3
+	}, 5*time.Second, 20*time.Millisecond)
+
+	release <- struct{}{}
+	<-drained
+	var done int64
+	fetcher.DB.Model(&FetchJob{}).Where("status = ?", FetchJobDone).Count(&done)
+	assert.Equal(t, int64(4), done)
+}
+
+func TestFetchWorker_DrainShutdown(t *testing.T) {
+	fetcher, now := newTestFetcher(t)
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			started <- struct{}{}
+			select {
+			case <-release:
+			case <-r.Context().Done():
+				return
+			}
+		}
+		w.Header().Set("Content-Type", "application/rss+xml")
+		w.Write([]byte(testRSS))
+	}))
+	defer server.Close()
+
+	feeds := []Feed{{URL: server.URL + "/slow"}, {URL: server.URL + "/next"}}
+	fetcher.DB.Create(&feeds)
+	slow, _ := EnqueueFetchJob(fetcher.DB, feeds[0].ID, FetchJobPriorityScheduled, now.Add(-time.Minute))
+	next, _ := EnqueueFetchJob(fetcher.DB, feeds[1].ID, FetchJobPriorityScheduled, now)
+	fetcher.Workers = 1
+	worker := &FetchWorker{DB: fetcher.DB, Fetcher: fetcher, Owner: "test-worker", Lease: time.Minute}
+
+	// Shutdown starts while the slow job is in flight: it finishes, but no new job is claimed
+	ctx, stop := context.WithCancel(context.Background())
+	drained := make(chan struct{})
+	go func() {
+		worker.Drain(ctx, context.Background())
+		close(drained)
+	}()
+	<-started
+	stop()
+	close(release)
+	<-drained
+
+	var jobs []FetchJob
+	fetcher.DB.Order("id").Find(&jobs)
+	if assert.Len(t, jobs, 2) {
+		assert.Equal(t, slow.ID, jobs[0].ID)
+		assert.Equal(t, FetchJobDone, jobs[0].Status, "Should finish the job in flight")
+		assert.Equal(t, next.ID, jobs[1].ID)
+		assert.Equal(t, FetchJobQueued, jobs[1].Status, "Should not claim new jobs after shutdown started")
+	}
+
+	// Past the shutdown deadline the fetch in flight is aborted and its job goes back to the queue
+	EnqueueFetchJob(fetcher.DB, feeds[0].ID, FetchJobPriorityManual, now)
+	workCtx, abort := context.WithCancel(context.Background())
+	drained = make(chan struct{})
+	go func() {
+		worker.Drain(context.Background(), workCtx)
+		close(drained)
+	}()
+	<-started
+	abort()
+	<-drained
+
+	var aborted FetchJob
+	fetcher.DB.Where("feed_id = ? AND finished_at IS NULL", feeds[0].ID).First(&aborted)
+	assert.Equal(t, FetchJobQueued, aborted.Status, "Should release the aborted job")
+	assert.Empty(t, aborted.LeaseOwner)
+	assert.Equal(t, 0, aborted.Attempts, "Should not count the aborted claim as an attempt")
+}
+
+func TestRunManualFetchJobs_WithoutBackgroundFetcher(t *testing.T) {
+	t.Setenv("BACKGROUND_FETCH_ENABLED", "false")
+	fetcher, now := newTestFetcher(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/rss+xml")
+		w.Write([]byte(testRSS))
+	}))
+	defer server.Close()
+
+	feeds := []Feed{{URL: server.URL + "/manual"}, {URL: server.URL + "/other"}}
+	fetcher.DB.Create(&feeds)
+	manual, _ := EnqueueFetchJob(fetcher.DB, feeds[0].ID, FetchJobPriorityManual, now)
+	other, _ := EnqueueFetchJob(fetcher.DB, feeds[1].ID, FetchJobPriorityScheduled, now)
+
+	jobs := runManualFetchJobs(context.Background(), []uint{manual.ID})
+	if assert.Len(t, jobs, 1) {
+		assert.Equal(t, FetchJobDone, jobs[0].Status, "Should run the job inline when no background fetcher runs")
+		assert.Equal(t, 2, jobs[0].ItemsCreated)
+	}
+
+	var untouched FetchJob
+	fetcher.DB.First(&untouched, other.ID)
+	assert.Equal(t, FetchJobQueued, untouched.Status, "Should only run the requested jobs")
+}
+
+func TestRunManualFetchJobs_Detached(t *testing.T) {
+	t.Setenv("BACKGROUND_FETCH_ENABLED", "false")
+	fetcher, now := newTestFetcher(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/rss+xml")
+		w.Write([]byte(testRSS))
+	}))
+	defer server.Close()
+
+	feed := Feed{URL: server.URL}
+	fetcher.DB.Create(&feed)
+	job, _ := EnqueueFetchJob(fetcher.DB, feed.ID, FetchJobPriorityManual, now)
+
+	// The browser navigated away: the fetch still runs to completion
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	runManualFetchJobs(ctx, []uint{job.ID})
+	assert.Eventually(t, func() bool {
+		var finished FetchJob
+		fetcher.DB.First(&finished, job.ID)
+		return finished.Status == FetchJobDone
+	}, 5*time.Second, 20*time.Millisecond)
+}
+
+func TestRunManualFetchJobs_LeavesJobsToLiveWorkers(t *testing.T) {
+	t.Setenv("BACKGROUND_FETCH_ENABLED", "false")
+	fetcher, now := newTestFetcher(t)
+	feed := Feed{URL: "http://example.com/feed.xml"}
+	fetcher.DB.Create(&feed)
+	job, _ := EnqueueFetchJob(fetcher.DB, feed.ID, FetchJobPriorityManual, now)
+
+	worker := &FetchWorker{DB: fetcher.DB, Fetcher: fetcher, Owner: "other-process"}
+	worker.beat()
+	assert.True(t, hasLiveFetchWorker(fetcher.DB, time.Now()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	jobs := runManualFetchJobs(ctx, []uint{job.ID})
+	if assert.Len(t, jobs, 1) {
+		assert.Equal(t, FetchJobQueued, jobs[0].Status, "Should leave the job to the worker process")
+	}
+
+	// A worker that stopped, or stopped beating, no longer counts
+	worker.retire()
+	assert.False(t, hasLiveFetchWorker(fetcher.DB, time.Now()))
+	fetcher.DB.Create(&FetchWorkerHeartbeat{Owner: "crashed", BeatAt: time.Now().Add(-fetcherStaleAfter() - time.Minute)})
+	assert.False(t, hasLiveFetchWorker(fetcher.DB, time.Now()))
+}
+
+func TestPruneFetchJobs(t *testing.T) {
+	db := setupTestDB(t)
+	now := time.Date(2024, 1, 10, 12, 0, 0, 0, time.UTC)
+	feeds := []Feed{{URL: "http://example.com/a"}, {URL: "http://example.com/b"}, {URL: "http://example.com/c"}}
+	db.Create(&feeds)
+
+	old := now.Add(-2 * fetchJobRetention)
+	recent := now.Add(-time.Hour)
+	db.Create(&FetchJob{FeedID: feeds[0].ID, Status: FetchJobDone, AvailableAt: old, FinishedAt: &old})
+	db.Create(&FetchJob{FeedID: feeds[1].ID, Status: FetchJobDone, AvailableAt: recent, FinishedAt: &recent})
+	db.Create(&FetchJob{FeedID: feeds[2].ID, Status: FetchJobQueued, AvailableAt: old})
+
+	deleted, err := pruneFetchJobs(db, now)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+
+	var remaining int64
+	db.Model(&FetchJob{}).Count(&remaining)
+	assert.Equal(t, int64(2), remaining, "Should keep recent and unfinished jobs")
+}
@@ -1,74 +1,30 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"html/template"
+	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"reflect"
+	"slices"
+	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/gin-contrib/multitemplate"
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-contrib/sessions/cookie"
 	"github.com/gin-gonic/gin"
-	"github.com/mmcdole/gofeed"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 )
 
-// LogEntry represents a single log entry
-type LogEntry struct {
-	Timestamp time.Time
-	Type      string // "success" or "error"
-	FeedURL   string
-	Message   string
-}
-
-// In-memory log storage with max 1000 entries
-var (
-	logEntries []LogEntry
-	logMutex   sync.RWMutex
-	maxLogSize = 1000
-)
-
-// addLogEntry adds a log entry to the in-memory log storage
-// Maintains maximum of 1000 entries by removing oldest entries
-func addLogEntry(logType, feedURL, message string) {
-	logMutex.Lock()
-	defer logMutex.Unlock()
-
-	entry := LogEntry{
-		Timestamp: time.Now(),
-		Type:      logType,
-		FeedURL:   feedURL,
-		Message:   message,
-	}
-
-	logEntries = append(logEntries, entry)
-
-	// Keep only the last maxLogSize entries
-	if len(logEntries) > maxLogSize {
-		logEntries = logEntries[len(logEntries)-maxLogSize:]
-	}
-}
-
-// getLogEntries returns a copy of all log entries
-func getLogEntries() []LogEntry {
-	logMutex.RLock()
-	defer logMutex.RUnlock()
-
-	// Return a copy to prevent external modifications
-	entries := make([]LogEntry, len(logEntries))
-	copy(entries, logEntries)
-	return entries
-}
-
 // isUniqueConstraintError checks if the error is a unique constraint violation
 func isUniqueConstraintError(err error) bool {
 	if err == nil {
@@ -168,7 +124,8 @@ func showStartupInfo() {
 	fmt.Println()
 	fmt.Println("Starting web server on http://localhost:8082")
 	fmt.Println()
-	fmt.Println("When you run the application without a command, it starts the web server.")
+	fmt.Println("When you run the application without a command, it starts the web server")
+	fmt.Println("and the background fetcher, like the all command.")
 	fmt.Println("You can access the application in your browser at http://localhost:8082")
 	fmt.Println()
 	fmt.Println("Available CLI commands:")
@@ -179,15 +136,24 @@ func showStartupInfo() {
 	fmt.Println("  fetch-feeds  - Fetch and process all RSS feeds (creates/updates items)")
 	fmt.Println("  execute-sql  - Execute SQL query (provide query as argument or via stdin)")
 	fmt.Println("                Example: go run . execute-sql \"SELECT * FROM feeds\"")
+	fmt.Println("  prune-items  - Delete items according to the retention rules")
+	fmt.Println("                Example: go run . prune-items --dry-run")
+	fmt.Println("  diagnose-feed - Report problems in a feed (missing GUIDs, bad dates, charset, ...)")
+	fmt.Println("                Example: go run . diagnose-feed 42")
 	fmt.Println("  migrate      - Create tables in database using AutoMigrate")
 	fmt.Println("  drop-db      - Delete the application database")
 	fmt.Println("  create-db    - Create the application database")
+	fmt.Println("  serve        - Run only the web server")
+	fmt.Println("  worker       - Run only the background fetcher and scheduled jobs")
+	fmt.Println("  all          - Run the web server and the background fetcher (default)")
 	fmt.Println()
 	fmt.Println("Usage examples:")
-	fmt.Println("  go run .                    - Start web server (default)")
+	fmt.Println("  go run .                    - Start web server and background fetcher (default)")
+	fmt.Println("  go run . worker             - Start a fetch worker without the web UI")
 	fmt.Println("  go run . seed-users         - Create admin user")
 	fmt.Println("  go run . fetch-feeds        - Fetch all RSS feeds")
 	fmt.Println("  go run . execute-sql \"...\"  - Execute SQL query")
+	fmt.Println("  go run . prune-items --dry-run - Show which items retention would delete")
 	fmt.Println()
 	fmt.Println("=" + strings.Repeat("=", 70) + "=")
 	fmt.Println()
@@ -217,6 +183,16 @@ func main() {
 			CommandFetchFeeds()
 		case "execute-sql":
 			CommandExecuteSQL()
+		case "prune-items":
+			CommandPruneItems()
+		case "diagnose-feed":
+			CommandDiagnoseFeed()
+		case "serve":
+			runProcess(roleWeb)
+		case "worker":
+			runProcess(roleWorker)
+		case "all":
+			runProcess(roleAll)
 		default:
 			fmt.Println("Unknown command:", command)
 			fmt.Println("\nAvailable commands:")
@@ -225,34 +201,33 @@ func main() {
 			fmt.Println("  seed-feeds   - Create default RSS feeds")
 			fmt.Println("  fetch-feeds  - Fetch and process all RSS feeds")
 			fmt.Println("  execute-sql  - Execute SQL query (provide query as argument or via stdin)")
+			fmt.Println("  prune-items  - Delete items according to the retention rules (--dry-run to only report)")
+			fmt.Println("  diagnose-feed - Report problems in a feed, given its ID or URL")
 			fmt.Println("  migrate      - Create tables in database using AutoMigrate")
 			fmt.Println("  drop-db      - Delete the application database")
 			fmt.Println("  create-db    - Create the application database")
+			fmt.Println("  serve        - Run only the web server")
+			fmt.Println("  worker       - Run only the background fetcher and scheduled jobs")
+			fmt.Println("  all          - Run the web server and the background fetcher (default)")
 			os.Exit(1)
 		}
 		return
 	}
 
-	// Show informational message about available commands
-	showStartupInfo()
-
-	// Run the web server
-	ConnectDatabase()
-	// Seed()
-
-	// Start background feed fetcher if enabled
-	if GetBackgroundFetchEnabled() {
-		go startBackgroundFeedFetcher()
-	} else {
-		log.Println("Background feed fetcher is disabled")
-	}
+	runProcess(roleAll)
+}
 
+// setupRouter creates the web application's router; the /healthz endpoint reports on the given role
+func setupRouter(role processRole) *gin.Engine {
 	r := gin.Default()
 
 	r.HTMLRender = loadTemplates("./templates")
 
 	r.Static("/static", "./static")
 
+	// Health check for load balancers and container orchestration
+	r.GET("/healthz", healthCheck(role))
+
 	// Custom handler for test_feeds that checks for error endpoints first
 	// This single handler handles both error endpoints and static files
 	r.GET("/test_feeds/*filepath", func(c *gin.Context) {
@@ -274,6 +249,10 @@ func main() {
 		c.File("./test_feeds" + filepath)
 	})
 
+	// WebSub callback: hubs verify subscription intent with GET and push updates with POST
+	r.GET("/websub/callback/:id", webSubVerify)
+	r.POST("/websub/callback/:id", webSubReceive)
+
 	store := cookie.NewStore([]byte("secret"))
 	store.Options(sessions.Options{
 		Path:     "/",
@@ -307,16 +286,29 @@ func main() {
 		// Feeds routes
 		admin.GET("/feeds", adminFeedsIndex)
 		admin.GET("/feeds/:id", showFeed)
+		admin.GET("/feeds/:id/diagnostics", showFeedDiagnostics)
 		admin.GET("/feeds/new", showCreateFeedForm)
 		admin.POST("/feeds", createFeed)
+		admin.POST("/feeds/preview", previewFeed)
 		admin.POST("/feeds/:id/fetch", fetchSingleFeed)
+		admin.POST("/feeds/:id/schedule", updateFeedSchedule)
+		admin.POST("/feeds/:id/resume", resumeFeed)
+		admin.POST("/feeds/:id/move", moveFeed)
+		admin.POST("/feeds/:id/retention", updateFeedRetention)
+		admin.POST("/feeds/:id/full-article", updateFeedFullArticle)
+		admin.POST("/feeds/:id/identity", updateFeedItemIdentity)
+		admin.POST("/feeds/:id/http-options", updateFeedHTTPOptions)
 		admin.POST("/feeds/:id/delete", deleteFeed)
 		admin.POST("/feeds/delete-all", deleteAllFeeds)
 		admin.POST("/feeds/seed", seedFeeds)
 
 		// Items routes
 		admin.GET("/items", adminItemsIndex)
+		admin.GET("/categories", showCategories)
+		admin.GET("/stories", showStories)
 		admin.GET("/items/:id", showItem)
+		admin.POST("/items/:id/star", updateItemStar)
+		admin.POST("/items/:id/note", updateItemNote)
 		admin.POST("/items/fetch", fetchFeedItems)
 		admin.POST("/items/delete-all", deleteAllItems)
 	}
@@ -346,7 +338,31 @@ func main() {
 		tools.POST("/execute-sql", executeSQL)
 	}
 
-	r.Run(":8082")
+	return r
+}
+
+// shutdownServer stops accepting requests and waits for in-flight requests and the background
+// fetcher to finish within SHUTDOWN_TIMEOUT; after that, remaining fetches are cancelled
+func shutdownServer(srv *http.Server, fetcherDone <-chan struct{}, cancelWork context.CancelFunc) {
+	timeout := time.Duration(GetShutdownTimeout()) * time.Second
+	log.Printf("Shutting down, waiting up to %s for in-flight requests and fetches...", timeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Error shutting down HTTP server: %v", err)
+	}
+
+	select {
+	case <-fetcherDone:
+	case <-shutdownCtx.Done():
+	}
+	if shutdownCtx.Err() != nil {
+		log.Println("Shutdown deadline reached, cancelling in-flight fetches")
+		cancelWork()
+		<-fetcherDone
+	}
+	log.Println("Shutdown complete")
 }
 
 func AuthRequired() gin.HandlerFunc {
@@ -544,6 +560,15 @@ func addPaginationData(data gin.H, page interface{}, baseURL, entityName string)
 	return data
 }
 
+// addPaginationQuery adds filter parameters that pagination links must keep
+// The partial appends "page=N" after them
+func addPaginationQuery(data gin.H, query url.Values) gin.H {
+	if len(query) > 0 {
+		data["paginationQuery"] = template.URL(query.Encode() + "&")
+	}
+	return data
+}
+
 // Helper functions for flash messages using simple strings instead of maps
 func addFlashSuccess(session sessions.Session, message string) {
 	session.AddFlash("success:" + message)
@@ -846,6 +871,7 @@ func showCreateFeedForm(c *gin.Context) {
 	c.HTML(http.StatusOK, "create_feed.html", data)
 }
 
+// createFeed saves a feed, or lists the feeds a pasted web page advertises so the admin can pick one
 func createFeed(c *gin.Context) {
 	// Create input struct from form data
 	input := FeedInput{
@@ -857,11 +883,49 @@ func createFeed(c *gin.Context) {
 		data := getTemplateData(c, gin.H{
 			"title": "Create New Feed",
 			"error": FormatValidationErrors(err),
+			"url":   input.URL,
+		})
+		c.HTML(http.StatusBadRequest, "create_feed.html", data)
+		return
+	}
+
+	// Reject URLs of existing feeds, including URLs they were fetched from before moving
+	if message := feedURLTakenMessage(input.URL); message != "" {
+		data := getTemplateData(c, gin.H{
+			"title": "Create New Feed",
+			"error": "Failed to create feed: " + message,
+			"url":   input.URL,
 		})
 		c.HTML(http.StatusBadRequest, "create_feed.html", data)
 		return
 	}
 
+	// A pasted web page is not saved; the admin picks one of the feeds it advertises instead
+	// A URL subscribed to from its preview was just parsed as a feed, so it isn't checked again
+	successMsg := "Feed created successfully"
+	var discovery Discovery
+	var err error
+	if c.PostForm("previewed") == "1" {
+		discovery.IsFeed = true
+	} else {
+		discovery, err = NewFeedFetcher(DB).Discover(c.Request.Context(), input.URL)
+	}
+	switch {
+	case err != nil:
+		successMsg += fmt.Sprintf(", but the URL could not be checked: %v", err)
+	case !discovery.IsFeed && len(discovery.Candidates) > 0:
+		data := getTemplateData(c, gin.H{
+			"title":      "Create New Feed",
+			"url":        input.URL,
+			"pageTitle":  discovery.Title,
+			"candidates": discovery.Candidates,
+		})
+		c.HTML(http.StatusOK, "create_feed.html", data)
+		return
+	case !discovery.IsFeed:
+		successMsg += ", but no feed was found at the URL"
+	}
+
 	feed := Feed{URL: input.URL}
 	if err := DB.Create(&feed).Error; err != nil {
 		data := getTemplateData(c, gin.H{
@@ -873,13 +937,76 @@ func createFeed(c *gin.Context) {
 	}
 
 	session := sessions.Default(c)
-	addFlashSuccess(session, "Feed created successfully")
+	addFlashSuccess(session, successMsg)
 	if err := session.Save(); err != nil {
 		log.Printf("Error saving session in createFeed: %v", err)
 	}
 	c.Redirect(http.StatusFound, "/admin/feeds")
 }
 
+// previewFeed downloads and parses a feed URL without saving anything and shows its title, type,
+// item count, item dates and a sample of sanitized items, with a button to subscribe
+// Web pages are answered with the feeds they advertise, like createFeed does
+func previewFeed(c *gin.Context) {
+	input := FeedInput{
+		URL: c.PostForm("url"),
+	}
+	if err := ValidateStruct(input); err != nil {
+		data := getTemplateData(c, gin.H{
+			"title": "Create New Feed",
+			"error": FormatValidationErrors(err),
+			"url":   input.URL,
+		})
+		c.HTML(http.StatusBadRequest, "create_feed.html", data)
+		return
+	}
+
+	fetcher := NewFeedFetcher(DB)
+	preview, err := fetcher.Preview(c.Request.Context(), input.URL)
+	if err != nil {
+		if discovery, discoverErr := fetcher.Discover(c.Request.Context(), input.URL); discoverErr == nil && len(discovery.Candidates) > 0 {
+			data := getTemplateData(c, gin.H{
+				"title":      "Create New Feed",
+				"url":        input.URL,
+				"pageTitle":  discovery.Title,
+				"candidates": discovery.Candidates,
+			})
+			c.HTML(http.StatusOK, "create_feed.html", data)
+			return
+		}
+		data := getTemplateData(c, gin.H{
+			"title": "Create New Feed",
+			"error": fmt.Sprintf("Failed to preview feed: %v", err),
+			"url":   input.URL,
+		})
+		c.HTML(http.StatusUnprocessableEntity, "create_feed.html", data)
+		return
+	}
+
+	data := getTemplateData(c, gin.H{
+		"title":   "Create New Feed",
+		"url":     input.URL,
+		"preview": preview,
+		"taken":   feedURLTakenMessage(input.URL),
+	})
+	c.HTML(http.StatusOK, "create_feed.html", data)
+}
+
+// feedURLTakenMessage explains which feed already uses rawURL, currently or before it moved,
+// or returns "" if the URL is free
+func feedURLTakenMessage(rawURL string) string {
+	existing, err := findFeedByURL(DB, rawURL, 0)
+	if err != nil {
+		return ""
+	}
+	if existing.URL != rawURL {
+		return fmt.Sprintf("feed #%d moved from this URL to %s", existing.ID, existing.URL)
+	}
+	return fmt.Sprintf("feed #%d already uses this URL", existing.ID)
+}
+
+// fetchSingleFeed enqueues a high-priority fetch job for a feed (paused feeds included)
+// and waits for a worker to run it, so the result can be shown right away
 func fetchSingleFeed(c *gin.Context) {
 	id := c.Param("id")
 	session := sessions.Default(c)
@@ -892,20 +1019,411 @@ func fetchSingleFeed(c *gin.Context) {
 		return
 	}
 
-	itemsCreated, itemsUpdated, err := processSingleFeed(feed.ID)
+	job, err := EnqueueFetchJob(DB, feed.ID, FetchJobPriorityManual, time.Now())
 	if err != nil {
-		addFlashError(session, fmt.Sprintf("Failed to fetch feed: %v", err))
+		addFlashError(session, fmt.Sprintf("Failed to queue feed fetch: %v", err))
 		session.Save()
 		c.Redirect(http.StatusFound, "/admin/feeds")
 		return
 	}
 
-	successMsg := fmt.Sprintf("Feed fetched successfully: %d items created, %d items updated", itemsCreated, itemsUpdated)
-	addFlashSuccess(session, successMsg)
+	jobs := runManualFetchJobs(c.Request.Context(), []uint{job.ID})
+	switch {
+	case len(jobs) == 0 || jobs[0].FinishedAt == nil:
+		addFlashSuccess(session, "Feed fetch queued; results will appear once a worker has fetched it")
+	case jobs[0].Status == FetchJobFailed:
+		addFlashError(session, fmt.Sprintf("Failed to fetch feed: %s", jobs[0].Error))
+	default:
+		successMsg := fmt.Sprintf("Feed fetched successfully: %d items created, %d items updated", jobs[0].ItemsCreated, jobs[0].ItemsUpdated)
+		addFlashSuccess(session, successMsg)
+	}
 	session.Save()
 	c.Redirect(http.StatusFound, "/admin/feeds")
 }
 
+// runManualFetchJobs waits up to FETCH_TIMEOUT plus a few seconds for manually enqueued jobs to finish
+// The jobs are left to the workers while any process runs a background fetcher. Otherwise this process
+// runs them itself, on fetchWorkContext rather than ctx, so leaving the page does not abort them half-way
+func runManualFetchJobs(ctx context.Context, ids []uint) []FetchJob {
+	if !currentRole.runsFetcher() && !hasLiveFetchWorker(DB, time.Now()) {
+		go NewFetchWorker(DB).DrainJobs(processContext, fetchWorkContext, ids)
+	}
+	return waitForFetchJobs(ctx, DB, ids, time.Duration(GetFetchTimeout()+5)*time.Second)
+}
+
+// updateFeedSchedule sets a fixed fetch interval for a feed, or returns it to adaptive scheduling when empty
+func updateFeedSchedule(c *gin.Context) {
+	id := c.Param("id")
+	session := sessions.Default(c)
+	redirectURL := "/admin/feeds/" + id
+
+	var feed Feed
+	if err := DB.First(&feed, id).Error; err != nil {
+		addFlashError(session, "Feed not found")
+		session.Save()
+		c.Redirect(http.StatusFound, "/admin/feeds")
+		return
+	}
+
+	intervalStr := strings.TrimSpace(c.PostForm("fetch_interval"))
+	if intervalStr == "" {
+		feed.FetchIntervalFixed = false
+	} else {
+		interval, err := strconv.Atoi(intervalStr)
+		if err != nil {
+			addFlashError(session, "Fetch interval must be a whole number of seconds")
+			session.Save()
+			c.Redirect(http.StatusFound, redirectURL)
+			return
+		}
+		input := FeedScheduleInput{FetchInterval: interval}
+		if err := ValidateStruct(input); err != nil {
+			addFlashError(session, FormatValidationErrors(err))
+			session.Save()
+			c.Redirect(http.StatusFound, redirectURL)
+			return
+		}
+		feed.FetchInterval = input.FetchInterval
+		feed.FetchIntervalFixed = true
+	}
+
+	// Reschedule relative to the last successful fetch so the new interval applies right away
+	if feed.LastSuccessfullyFetchedAt != nil {
+		next := feed.LastSuccessfullyFetchedAt.Add(time.Duration(effectiveFetchInterval(&feed)) * time.Second)
+		feed.NextFetchAt = &next
+	}
+
+	if err := DB.Model(&feed).Select("fetch_interval", "fetch_interval_fixed", "next_fetch_at").Updates(&feed).Error; err != nil {
+		addFlashError(session, "Failed to update fetch schedule: "+err.Error())
+		session.Save()
+		c.Redirect(http.StatusFound, redirectURL)
+		return
+	}
+
+	if feed.FetchIntervalFixed {
+		addFlashSuccess(session, fmt.Sprintf("Fetch interval set to %d seconds", feed.FetchInterval))
+	} else {
+		addFlashSuccess(session, "Fetch interval is now adaptive")
+	}
+	session.Save()
+	c.Redirect(http.StatusFound, redirectURL)
+}
+
+// updateFeedRetention sets how many of the newest items are kept for a feed
+// An empty value falls back to ITEM_KEEP_PER_FEED
+func updateFeedRetention(c *gin.Context) {
+	id := c.Param("id")
+	session := sessions.Default(c)
+	redirectURL := "/admin/feeds/" + id
+
+	var feed Feed
+	if err := DB.First(&feed, id).Error; err != nil {
+		addFlashError(session, "Feed not found")
+		session.Save()
+		c.Redirect(http.StatusFound, "/admin/feeds")
+		return
+	}
+
+	keepStr := strings.TrimSpace(c.PostForm("keep_items"))
+	if keepStr == "" {
+		feed.KeepItems = 0
+	} else {
+		keep, err := strconv.Atoi(keepStr)
+		if err != nil {
+			addFlashError(session, "Items to keep must be a whole number")
+			session.Save()
+			c.Redirect(http.StatusFound, redirectURL)
+			return
+		}
+		input := FeedRetentionInput{KeepItems: keep}
+		if err := ValidateStruct(input); err != nil {
+			addFlashError(session, FormatValidationErrors(err))
+			session.Save()
+			c.Redirect(http.StatusFound, redirectURL)
+			return
+		}
+		feed.KeepItems = input.KeepItems
+	}
+
+	if err := DB.Model(&feed).Select("keep_items").Updates(&feed).Error; err != nil {
+		addFlashError(session, "Failed to update item retention: "+err.Error())
+		session.Save()
+		c.Redirect(http.StatusFound, redirectURL)
+		return
+	}
+
+	if feed.KeepItems > 0 {
+		addFlashSuccess(session, fmt.Sprintf("Retention set to keep the newest %d items", feed.KeepItems))
+	} else {
+		addFlashSuccess(session, "Retention now uses the global default")
+	}
+	session.Save()
+	c.Redirect(http.StatusFound, redirectURL)
+}
+
+// updateFeedFullArticle turns full article extraction on or off for a feed
+// Turning it on retries items whose article could not be extracted before
+func updateFeedFullArticle(c *gin.Context) {
+	id := c.Param("id")
+	session := sessions.Default(c)
+	redirectURL := "/admin/feeds/" + id
+
+	var feed Feed
+	if err := DB.First(&feed, id).Error; err != nil {
+		addFlashError(session, "Feed not found")
+		session.Save()
+		c.Redirect(http.StatusFound, "/admin/feeds")
+		return
+	}
+
+	feed.FetchFullArticle = c.PostForm("fetch_full_article") == "1"
+	if err := DB.Model(&feed).Select("fetch_full_article").Updates(&feed).Error; err != nil {
+		addFlashError(session, "Failed to update full article setting: "+err.Error())
+		session.Save()
+		c.Redirect(http.StatusFound, redirectURL)
+		return
+	}
+
+	if feed.FetchFullArticle {
+		if err := markFullArticlesForRetry(DB, feed.ID); err != nil {
+			log.Printf("Error resetting full articles of feed %d: %v", feed.ID, err)
+		}
+		addFlashSuccess(session, "Full articles will be extracted on the next fetches")
+	} else {
+		addFlashSuccess(session, "Full article extraction turned off")
+	}
+	session.Save()
+	c.Redirect(http.StatusFound, redirectURL)
+}
+
+// updateFeedItemIdentity sets which field identifies the items of a feed and re-keys its stored items
+func updateFeedItemIdentity(c *gin.Context) {
+	id := c.Param("id")
+	session := sessions.Default(c)
+	redirectURL := "/admin/feeds/" + id
+
+	var feed Feed
+	if err := DB.First(&feed, id).Error; err != nil {
+		addFlashError(session, "Feed not found")
+		session.Save()
+		c.Redirect(http.StatusFound, "/admin/feeds")
+		return
+	}
+
+	identity := c.PostForm("item_identity")
+	if !slices.Contains(itemIdentityStrategies, identity) {
+		addFlashError(session, "Unknown item identity: "+identity)
+		session.Save()
+		c.Redirect(http.StatusFound, redirectURL)
+		return
+	}
+	rekeyed, removed, err := setFeedItemIdentity(DB, &feed, identity)
+	if err != nil {
+		addFlashError(session, "Failed to update item identity: "+err.Error())
+		session.Save()
+		c.Redirect(http.StatusFound, redirectURL)
+		return
+	}
+
+	addFlashSuccess(session, fmt.Sprintf("Items are now identified by %s: %d stored items re-keyed, %d duplicates removed", identity, rekeyed, removed))
+	session.Save()
+	c.Redirect(http.StatusFound, redirectURL)
+}
+
+// updateFeedHTTPOptions saves the credentials, headers, proxy and CA certificates used to fetch a feed
+// Posting remove=1 deletes all of them
+func updateFeedHTTPOptions(c *gin.Context) {
+	id := c.Param("id")
+	session := sessions.Default(c)
+	redirectURL := "/admin/feeds/" + id
+
+	var feed Feed
+	if err := DB.First(&feed, id).Error; err != nil {
+		addFlashError(session, "Feed not found")
+		session.Save()
+		c.Redirect(http.StatusFound, "/admin/feeds")
+		return
+	}
+
+	// Removing doesn't load the options first, so it also works when they can't be decrypted
+	if c.PostForm("remove") == "1" {
+		if err := DB.Where("feed_id = ?", feed.ID).Delete(&FeedHTTPOptions{}).Error; err != nil {
+			addFlashError(session, "Failed to remove HTTP options: "+err.Error())
+		} else {
+			addFlashSuccess(session, "HTTP options removed")
+		}
+		session.Save()
+		c.Redirect(http.StatusFound, redirectURL)
+		return
+	}
+
+	input := FeedHTTPOptionsInput{
+		Username:         c.PostForm("username"),
+		Password:         c.PostForm("password"),
+		BearerToken:      c.PostForm("bearer_token"),
+		Cookie:           c.PostForm("cookie"),
+		Headers:          c.PostForm("headers"),
+		UserAgent:        c.PostForm("user_agent"),
+		ProxyURL:         c.PostForm("proxy_url"),
+		CACert:           c.PostForm("ca_cert"),
+		ClearPassword:    c.PostForm("clear_password") == "1",
+		ClearBearerToken: c.PostForm("clear_bearer_token") == "1",
+		ClearCookie:      c.PostForm("clear_cookie") == "1",
+		ClearHeaders:     c.PostForm("clear_headers") == "1",
+		ClearProxyURL:    c.PostForm("clear_proxy_url") == "1",
+	}
+	if err := ValidateStruct(input); err != nil {
+		addFlashError(session, FormatValidationErrors(err))
+		session.Save()
+		c.Redirect(http.StatusFound, redirectURL)
+		return
+	}
+
+	options, err := loadFeedHTTPOptions(DB, feed.ID)
+	if err != nil {
+		addFlashError(session, "Failed to update HTTP options: "+err.Error())
+		session.Save()
+		c.Redirect(http.StatusFound, redirectURL)
+		return
+	}
+	if options == nil {
+		options = &FeedHTTPOptions{FeedID: feed.ID}
+	}
+	options.applyInput(input)
+
+	if options.IsEmpty() {
+		err = DB.Where("feed_id = ?", feed.ID).Delete(&FeedHTTPOptions{}).Error
+	} else {
+		err = DB.Save(options).Error
+	}
+	if err != nil {
+		addFlashError(session, "Failed to update HTTP options: "+err.Error())
+		session.Save()
+		c.Redirect(http.StatusFound, redirectURL)
+		return
+	}
+
+	addFlashSuccess(session, "HTTP options updated")
+	session.Save()
+	c.Redirect(http.StatusFound, redirectURL)
+}
+
+// webSubVerify answers a hub's intent verification for a subscription
+func webSubVerify(c *gin.Context) {
+	var sub WebSubSubscription
+	if err := DB.First(&sub, c.Param("id")).Error; err != nil {
+		c.String(http.StatusNotFound, "Unknown subscription")
+		return
+	}
+
+	challenge, err := verifyWebSubIntent(DB, &sub, c.Request.URL.Query(), time.Now())
+	if err != nil {
+		log.Printf("Rejected WebSub verification for subscription %d: %v", sub.ID, err)
+		c.String(http.StatusNotFound, err.Error())
+		return
+	}
+	c.String(http.StatusOK, challenge)
+}
+
+// webSubReceive ingests a feed update pushed by a hub
+// Payloads with a missing or invalid signature are acknowledged but ignored, as WebSub requires
+func webSubReceive(c *gin.Context) {
+	var sub WebSubSubscription
+	if err := DB.Preload("Feed").First(&sub, c.Param("id")).Error; err != nil {
+		c.String(http.StatusGone, "Unknown subscription")
+		return
+	}
+	// Without a secret every signature check passes, so only verified subscriptions that still
+	// hold their secret accept content
+	if sub.State != WebSubStateActive || sub.Secret == "" {
+		c.String(http.StatusGone, "Subscription is not active")
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxWebSubPushBytes))
+	if err != nil {
+		c.String(http.StatusBadRequest, "Failed to read body")
+		return
+	}
+	if !validWebSubSignature(string(sub.Secret), c.GetHeader("X-Hub-Signature"), body) {
+		log.Printf("Ignoring WebSub push for %s with an invalid signature", sub.Topic)
+		c.Status(http.StatusAccepted)
+		return
+	}
+
+	if _, err := NewFeedFetcher(DB).IngestPush(&sub.Feed, body); err != nil {
+		c.String(http.StatusBadRequest, "Failed to parse feed")
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// resumeFeed re-enables a paused feed and schedules it for the next scheduler tick
+func resumeFeed(c *gin.Context) {
+	id := c.Param("id")
+	session := sessions.Default(c)
+
+	var feed Feed
+	if err := DB.First(&feed, id).Error; err != nil {
+		addFlashError(session, "Feed not found")
+		session.Save()
+		c.Redirect(http.StatusFound, "/admin/feeds")
+		return
+	}
+
+	feed.PausedAt = nil
+	feed.ConsecutiveFailures = 0
+	feed.NextFetchAt = nil
+	if err := DB.Model(&feed).Select("paused_at", "consecutive_failures", "next_fetch_at").Updates(&feed).Error; err != nil {
+		addFlashError(session, "Failed to resume feed: "+err.Error())
+		session.Save()
+		c.Redirect(http.StatusFound, "/admin/feeds/"+id)
+		return
+	}
+
+	addFlashSuccess(session, "Feed resumed")
+	session.Save()
+	c.Redirect(http.StatusFound, "/admin/feeds/"+id)
+}
+
+// moveFeed changes a feed's URL to the permanent redirect target recorded on it
+// Feeds with HTTP options are only moved to another host this way, never by the fetcher
+func moveFeed(c *gin.Context) {
+	id := c.Param("id")
+	session := sessions.Default(c)
+
+	var feed Feed
+	if err := DB.First(&feed, id).Error; err != nil {
+		addFlashError(session, "Feed not found")
+		session.Save()
+		c.Redirect(http.StatusFound, "/admin/feeds")
+		return
+	}
+	if feed.RedirectURL == "" {
+		addFlashError(session, "Feed is not permanently redirected")
+		session.Save()
+		c.Redirect(http.StatusFound, "/admin/feeds/"+id)
+		return
+	}
+
+	oldURL, target := feed.URL, feed.RedirectURL
+	if err := moveFeedURL(DB, &feed, target, time.Now()); err != nil {
+		addFlashError(session, "Failed to move feed: "+err.Error())
+		session.Save()
+		c.Redirect(http.StatusFound, "/admin/feeds/"+id)
+		return
+	}
+	feed.RedirectURL = ""
+	feed.RedirectCount = 0
+	if err := DB.Model(&feed).Select("redirect_url", "redirect_count").Updates(&feed).Error; err != nil {
+		log.Printf("Error clearing the redirect of feed %s: %v", feed.URL, err)
+	}
+
+	addFlashSuccess(session, fmt.Sprintf("Feed moved from %s to %s", oldURL, target))
+	session.Save()
+	c.Redirect(http.StatusFound, "/admin/feeds/"+id)
+}
+
 func deleteFeed(c *gin.Context) {
 	id := c.Param("id")
 	session := sessions.Default(c)
@@ -919,7 +1437,7 @@ func deleteFeed(c *gin.Context) {
 	}
 
 	// Items will be deleted automatically due to CASCADE constraint
-	if err := DB.Unscoped().Delete(&feed).Error; err != nil {
+	if err := deleteFeeds(DB, []uint{feed.ID}); err != nil {
 		addFlashError(session, "Failed to delete feed: "+err.Error())
 		session.Save()
 		c.Redirect(http.StatusFound, "/admin/feeds")
@@ -943,6 +1461,10 @@ func deleteAllFeeds(c *gin.Context) {
 		return
 	}
 
+	// Their items are gone, and with them every story cluster
+	if err := DB.Where("1 = 1").Delete(&StoryCluster{}).Error; err != nil {
+		log.Printf("Error deleting story clusters: %v", err)
+	}
 	addFlashSuccess(session, "All feeds deleted successfully")
 	session.Save()
 	c.Redirect(http.StatusFound, "/admin/feeds")
@@ -981,6 +1503,31 @@ func seedFeeds(c *gin.Context) {
 	}
 }
 
+// showFeedDiagnostics downloads a feed and shows the problems found in it, most severe first
+func showFeedDiagnostics(c *gin.Context) {
+	id := c.Param("id")
+	session := sessions.Default(c)
+
+	var feed Feed
+	if err := DB.First(&feed, id).Error; err != nil {
+		addFlashError(session, "Feed not found")
+		session.Save()
+		c.Redirect(http.StatusFound, "/admin/feeds")
+		return
+	}
+
+	report := NewFeedFetcher(DB).Diagnose(c.Request.Context(), feed)
+	data := getTemplateData(c, gin.H{
+		"title":    "Feed Diagnostics",
+		"feed":     feed,
+		"report":   report,
+		"errors":   report.Count(SeverityError),
+		"warnings": report.Count(SeverityWarning),
+		"infos":    report.Count(SeverityInfo),
+	})
+	c.HTML(http.StatusOK, "feed_diagnostics.html", data)
+}
+
 func showFeed(c *gin.Context) {
 	id := c.Param("id")
 	session := sessions.Default(c)
@@ -998,10 +1545,38 @@ func showFeed(c *gin.Context) {
 	model := DB.Model(&Item{}).Where("feed_id = ?", feed.ID).Order("created_at DESC")
 	page := Paginator.With(model).Request(c.Request).Response(&items)
 
+	// WebSub subscription, if the feed advertises a hub and one was requested
+	var webSub *WebSubSubscription
+	var subscription WebSubSubscription
+	if err := DB.Where("feed_id = ?", feed.ID).First(&subscription).Error; err == nil {
+		webSub = &subscription
+	}
+
+	// HTTP options; secrets are only shown masked
+	httpOptions, httpOptionsErr := loadFeedHTTPOptions(DB, feed.ID)
+	httpOptionsError := ""
+	if httpOptionsErr != nil {
+		httpOptionsError = httpOptionsErr.Error()
+	}
+
+	// URLs the feed was fetched from before it moved, newest first
+	var urlHistory []FeedURLHistory
+	DB.Where("feed_id = ?", feed.ID).Order("replaced_at DESC").Find(&urlHistory)
+
 	data := gin.H{
-		"title": "Feed Details",
-		"feed":  feed,
-		"items": page.Items,
+		"title":             "Feed Details",
+		"feed":              feed,
+		"items":             page.Items,
+		"fetchInterval":     effectiveFetchInterval(&feed),
+		"keepItems":         feedKeepItems(&feed),
+		"itemMaxAge":        GetItemMaxAgeDays(),
+		"webSub":            webSub,
+		"urlHistory":        urlHistory,
+		"redirectThreshold": GetRedirectThreshold(),
+		"httpOptions":       httpOptions,
+		"httpOptionsError":  httpOptionsError,
+		"secretsKeySet":     GetSecretsKey() != "",
+		"identities":        itemIdentityStrategies,
 	}
 
 	// Add pagination data
@@ -1016,21 +1591,87 @@ func adminItemsIndex(c *gin.Context) {
 	var items []Item
 	model := DB.Model(&Item{}).Preload("Feed")
 
+	query := url.Values{}
+
 	// Filter by feed if provided
-	if feedID := c.Query("feed_id"); feedID != "" {
+	feedID := c.Query("feed_id")
+	if feedID != "" {
 		model = model.Where("feed_id = ?", feedID)
+		query.Set("feed_id", feedID)
+	}
+
+	// Only items with an audio or video enclosure
+	hasMedia := c.Query("media") == "1"
+	if hasMedia {
+		model = model.Where(hasMediaCondition)
+		query.Set("media", "1")
+	}
+
+	// Only the first copy of items published in several feeds
+	hideDuplicates := c.Query("dedupe") == "1"
+	if hideDuplicates {
+		model = model.Where(firstCopyCondition)
+		query.Set("dedupe", "1")
+	}
+
+	// Only items filed under every given category
+	var categories []string
+	seen := map[string]bool{}
+	for _, raw := range c.QueryArray("category") {
+		name, key := normalizeCategory(raw)
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		model = model.Where(categoryCondition, key)
+		query.Add("category", name)
+		categories = append(categories, name)
 	}
 
-	model = model.Order("created_at DESC")
+	model = model.Preload("Enclosures", func(db *gorm.DB) *gorm.DB {
+		return db.Order("position")
+	}).Preload("Categories", func(db *gorm.DB) *gorm.DB {
+		return db.Order("categories.name")
+	}).Order("created_at DESC")
 	page := Paginator.With(model).Request(c.Request).Response(&items)
 
+	// Each active category links to the same list without it
+	var categoryFilters []gin.H
+	for _, name := range categories {
+		without := url.Values{}
+		for key, values := range query {
+			for _, value := range values {
+				if key != "category" || value != name {
+					without.Add(key, value)
+				}
+			}
+		}
+		removeURL := "/admin/items"
+		if len(without) > 0 {
+			removeURL += "?" + without.Encode()
+		}
+		categoryFilters = append(categoryFilters, gin.H{"Name": name, "RemoveURL": removeURL})
+	}
+
+	copies, err := duplicateCounts(DB, items)
+	if err != nil {
+		log.Printf("Error counting duplicate items: %v", err)
+	}
+
 	data := gin.H{
-		"title": "Items",
-		"items": page.Items,
+		"title":           "Items",
+		"items":           page.Items,
+		"feedID":          feedID,
+		"hasMedia":        hasMedia,
+		"hideDuplicates":  hideDuplicates,
+		"copies":          copies,
+		"categories":      categories,
+		"categoryFilters": categoryFilters,
 	}
 
 	// Add pagination data
 	data = addPaginationData(data, page, "/admin/items", "items")
+	data = addPaginationQuery(data, query)
 
 	// Check for error in query parameter (for backward compatibility)
 	if queryError := c.Query("error"); queryError != "" {
@@ -1043,17 +1684,78 @@ func adminItemsIndex(c *gin.Context) {
 	c.HTML(http.StatusOK, "items.html", data)
 }
 
+// showCategories lists the categories that have items, with their item counts
+func showCategories(c *gin.Context) {
+	counts, err := categoryCounts(DB)
+	data := gin.H{
+		"title":      "Categories",
+		"categories": counts,
+	}
+	if err != nil {
+		data["error"] = "Failed to load categories: " + err.Error()
+	}
+	data = getTemplateData(c, data)
+	c.HTML(http.StatusOK, "categories.html", data)
+}
+
+// showStories lists story clusters covered by more than one item, most recently updated first
+func showStories(c *gin.Context) {
+	var clusters []StoryCluster
+	model := DB.Model(&StoryCluster{}).Where("item_count > 1").
+		Preload("Items", func(db *gorm.DB) *gorm.DB {
+			return db.Order("published_at DESC, id DESC")
+		}).Preload("Items.Feed").
+		Order("last_seen_at DESC, id DESC")
+	page := Paginator.With(model).Request(c.Request).Response(&clusters)
+
+	data := gin.H{
+		"title":   "Stories",
+		"stories": clusters,
+	}
+	data = addPaginationData(data, page, "/admin/stories", "stories")
+	data = getTemplateData(c, data)
+	c.HTML(http.StatusOK, "stories.html", data)
+}
+
+// showLogs shows fetch attempts, newest first, optionally filtered by status, feed ID or feed URL
 func showLogs(c *gin.Context) {
-	entries := getLogEntries()
-	// Reverse order to show newest first
-	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
-		entries[i], entries[j] = entries[j], entries[i]
+	var attempts []FetchAttempt
+	model := DB.Model(&FetchAttempt{})
+	query := url.Values{}
+
+	status := c.Query("status")
+	if status != "" {
+		model = model.Where("status = ?", status)
+		query.Set("status", status)
+	}
+	feedID := c.Query("feed_id")
+	if feedID != "" {
+		model = model.Where("feed_id = ?", feedID)
+		query.Set("feed_id", feedID)
+	}
+	search := strings.TrimSpace(c.Query("q"))
+	if search != "" {
+		model = model.Where("feed_url LIKE ?", "%"+search+"%")
+		query.Set("q", search)
 	}
 
-	data := getTemplateData(c, gin.H{
-		"title":   "Logs",
-		"entries": entries,
-	})
+	model = model.Order("started_at DESC, id DESC")
+	page := Paginator.With(model).Request(c.Request).Response(&attempts)
+
+	data := gin.H{
+		"title":    "Logs",
+		"attempts": attempts,
+		"status":   status,
+		"feedID":   feedID,
+		"search":   search,
+		"statuses": []string{FetchStatusSuccess, FetchStatusNotModified, FetchStatusError},
+	}
+
+	// Add pagination data
+	data = addPaginationData(data, page, "/logs", "log entries")
+	data = addPaginationQuery(data, query)
+
+	data = getTemplateData(c, data)
 	c.HTML(http.StatusOK, "logs.html", data)
 }
 
@@ -1095,6 +1797,7 @@ func showInfo(c *gin.Context) {
 	}
 
 	// Get environment variables
+	minInterval, maxInterval := GetFetchIntervalBounds()
 	envVars := []EnvVarInfo{
 		{
 			Name:        "DATABASE_URL",
@@ -1144,7 +1847,112 @@ func showInfo(c *gin.Context) {
 		{
 			Name:        "BACKGROUND_FETCH_INTERVAL",
 			Value:       fmt.Sprintf("%d (default: 60)", GetBackgroundFetchInterval()),
-			Description: "Background feed fetch interval in seconds",
+			Description: "Default per-feed fetch interval in seconds",
+		},
+		{
+			Name:        "FETCH_SCHEDULER_TICK",
+			Value:       fmt.Sprintf("%d (default: 30)", GetSchedulerTick()),
+			Description: "How often the background scheduler checks for due feeds, in seconds",
+		},
+		{
+			Name:        "FETCH_ADAPTIVE_ENABLED",
+			Value:       getEnvValueOrDefault("FETCH_ADAPTIVE_ENABLED", "true (default)"),
+			Description: "Widen or narrow each feed's fetch interval based on how often new items appear",
+		},
+		{
+			Name:        "FETCH_INTERVAL_MIN",
+			Value:       fmt.Sprintf("%d (default: 300)", minInterval),
+			Description: "Lower bound for adaptive fetch intervals in seconds",
+		},
+		{
+			Name:        "FETCH_INTERVAL_MAX",
+			Value:       fmt.Sprintf("%d (default: 86400)", maxInterval),
+			Description: "Upper bound for adaptive fetch intervals in seconds",
+		},
+		{
+			Name:        "FETCH_FAILURE_PAUSE_THRESHOLD",
+			Value:       fmt.Sprintf("%d (default: 10)", GetFailurePauseThreshold()),
+			Description: "Consecutive failed fetches after which a feed is paused automatically",
+		},
+		{
+			Name:        "FETCH_BACKOFF_MAX",
+			Value:       fmt.Sprintf("%d (default: 86400)", GetMaxBackoff()),
+			Description: "Upper bound for the exponential retry delay of failing feeds, in seconds",
+		},
+		{
+			Name:        "FETCH_WORKERS",
+			Value:       fmt.Sprintf("%d (default: 10)", GetFetchWorkers()),
+			Description: "Number of feeds fetched concurrently",
+		},
+		{
+			Name:        "FETCH_HOST_CONCURRENCY",
+			Value:       fmt.Sprintf("%d (default: 2)", GetHostConcurrency()),
+			Description: "Maximum number of concurrent requests to a single host",
+		},
+		{
+			Name:        "FETCH_HOST_MIN_DELAY_MS",
+			Value:       fmt.Sprintf("%d (default: 1000)", GetHostMinDelay()),
+			Description: "Minimum delay between the starts of two requests to a single host, in milliseconds (0 disables it)",
+		},
+		{
+			Name:        "FETCH_TIMEOUT",
+			Value:       fmt.Sprintf("%d (default: 30)", GetFetchTimeout()),
+			Description: "Timeout for a single feed request including reading the body, in seconds",
+		},
+		{
+			Name:        "FETCH_JOB_LEASE",
+			Value:       fmt.Sprintf("%d (default: 300)", GetFetchJobLease()),
+			Description: "How long a worker leases a claimed fetch job before other workers may reclaim it, in seconds",
+		},
+		{
+			Name:        "FEED_SECRETS_KEY",
+			Value:       maskPassword(os.Getenv("FEED_SECRETS_KEY")),
+			Description: "Key per-feed credentials, cookies, headers and proxy URLs are encrypted with in the database; required to store them",
+		},
+		{
+			Name:        "FETCH_REDIRECT_THRESHOLD",
+			Value:       fmt.Sprintf("%d (default: 3)", GetRedirectThreshold()),
+			Description: "Consecutive fetches permanently redirected (301/308) to the same URL after which the feed URL is updated",
+		},
+		{
+			Name:        "WORKER_HEALTH_ADDR",
+			Value:       getEnvValueOrDefault("WORKER_HEALTH_ADDR", ":8083 (default)"),
+			Description: "Address the worker process serves /healthz on",
+		},
+		{
+			Name:        "SHUTDOWN_TIMEOUT",
+			Value:       fmt.Sprintf("%d (default: 30)", GetShutdownTimeout()),
+			Description: "How long in-flight requests and fetches may take to finish on SIGTERM, in seconds",
+		},
+		{
+			Name:        "WEBSUB_CALLBACK_BASE_URL",
+			Value:       getEnvValueOrDefault("WEBSUB_CALLBACK_BASE_URL", "(not set, WebSub disabled)"),
+			Description: "Public base URL hubs use to reach /websub/callback; enables WebSub push subscriptions",
+		},
+		{
+			Name:        "WEBSUB_LEASE_SECONDS",
+			Value:       fmt.Sprintf("%d (default: 864000)", GetWebSubLeaseSeconds()),
+			Description: "Lease length requested from WebSub hubs, in seconds",
+		},
+		{
+			Name:        "ITEM_MAX_AGE_DAYS",
+			Value:       fmt.Sprintf("%d (default: 0)", GetItemMaxAgeDays()),
+			Description: "Items published more than this many days ago are pruned (0 keeps them forever)",
+		},
+		{
+			Name:        "ITEM_KEEP_PER_FEED",
+			Value:       fmt.Sprintf("%d (default: 0)", GetItemKeepPerFeed()),
+			Description: "Newest items kept per feed unless the feed overrides it (0 means no limit)",
+		},
+		{
+			Name:        "STORY_CLUSTER_DISTANCE",
+			Value:       fmt.Sprintf("%d (default: 6)", GetStoryClusterDistance()),
+			Description: "Fingerprint bits (of 64) two items from different feeds may differ in to be grouped as one story (0 disables stories)",
+		},
+		{
+			Name:        "FETCH_ATTEMPT_RETENTION_DAYS",
+			Value:       fmt.Sprintf("%d (default: 30)", GetFetchAttemptRetentionDays()),
+			Description: "Fetch attempts (shown on /logs) older than this many days are pruned",
 		},
 		{
 			Name:        "CYPRESS",
@@ -1162,6 +1970,9 @@ func showInfo(c *gin.Context) {
 		"lastErrorTime":   lastErrorTime,
 		"lastError":       lastError,
 		"lastErrorFeed":   lastErrorFeed,
+		"fetchWorkers":    GetFetchWorkers(),
+		"hostConcurrency": GetHostConcurrency(),
+		"hostMinDelay":    GetHostMinDelay(),
 		"envVars":         envVars,
 	})
 	c.HTML(http.StatusOK, "info.html", data)
@@ -1217,7 +2028,12 @@ func showItem(c *gin.Context) {
 	id := c.Param("id")
 
 	var item Item
-	if err := DB.Preload("Feed").First(&item, id).Error; err != nil {
+	err := DB.Preload("Feed").Preload("Enclosures", func(db *gorm.DB) *gorm.DB {
+		return db.Order("position")
+	}).Preload("Categories", func(db *gorm.DB) *gorm.DB {
+		return db.Order("categories.name")
+	}).First(&item, id).Error
+	if err != nil {
 		// Show 404 page instead of redirecting
 		data := getTemplateData(c, gin.H{
 			"title": "404 - Item Not Found",
@@ -1233,313 +2049,134 @@ func showItem(c *gin.Context) {
 
 	// Convert Description and Content to template.HTML for safe HTML rendering
 	itemData := gin.H{
-		"ID":          item.ID,
-		"FeedID":      item.FeedID,
-		"Title":       item.Title,
-		"Link":        item.Link,
-		"Author":      item.Author,
-		"PublishedAt": item.PublishedAt,
-		"CreatedAt":   item.CreatedAt,
-		"UpdatedAt":   item.UpdatedAt,
-		"Feed":        item.Feed,
-		"Description": template.HTML(sanitizedDescription),
-		"Content":     template.HTML(sanitizedContent),
-	}
+		"ID":                   item.ID,
+		"FeedID":               item.FeedID,
+		"Title":                item.Title,
+		"Link":                 item.Link,
+		"Author":               item.Author,
+		"PublishedAt":          item.PublishedAt,
+		"CreatedAt":            item.CreatedAt,
+		"UpdatedAt":            item.UpdatedAt,
+		"Feed":                 item.Feed,
+		"Enclosures":           item.Enclosures,
+		"Categories":           item.Categories,
+		"FullContent":          template.HTML(SanitizeHTML(item.FullContent)),
+		"FullContentFetchedAt": item.FullContentFetchedAt,
+		"FullContentError":     item.FullContentError,
+		"ImageURL":             item.ImageURL,
+		"ImageWidth":           item.ImageWidth,
+		"ImageHeight":          item.ImageHeight,
+		"StarredAt":            item.StarredAt,
+		"Note":                 item.Note,
+		"Description":          template.HTML(sanitizedDescription),
+		"Content":              template.HTML(sanitizedContent),
+	}
+
+	// The same story in other feeds
+	var alsoIn []Item
+	if item.CanonicalURL != "" {
+		DB.Preload("Feed").Where("canonical_url = ? AND id <> ?", item.CanonicalURL, item.ID).Order("id").Find(&alsoIn)
+	}
+
+	// Previous versions of the item, diffed against the version that replaced them
+	var revisions []ItemRevision
+	DB.Where("item_id = ?", item.ID).Order("replaced_at, id").Find(&revisions)
 
 	data := getTemplateData(c, gin.H{
-		"title": item.Title,
-		"item":  itemData,
+		"title":     item.Title,
+		"item":      itemData,
+		"revisions": buildRevisionDiffs(&item, revisions),
+		"alsoIn":    alsoIn,
 	})
 	c.HTML(http.StatusOK, "item.html", data)
 }
 
-func deleteAllItems(c *gin.Context) {
+// updateItemStar stars (starred=1) or unstars an item; starred items are kept by retention
+func updateItemStar(c *gin.Context) {
+	id := c.Param("id")
 	session := sessions.Default(c)
-	result := DB.Delete(&Item{}, "1 = 1")
-	if result.Error != nil {
-		addFlashError(session, "Failed to delete all items")
+	redirectURL := "/admin/items/" + id
+
+	var item Item
+	if err := DB.First(&item, id).Error; err != nil {
+		addFlashError(session, "Item not found")
 		session.Save()
 		c.Redirect(http.StatusFound, "/admin/items")
 		return
 	}
-	addFlashSuccess(session, "All items deleted successfully")
-	session.Save()
-	c.Redirect(http.StatusFound, "/admin/items")
-}
-
-// processFeeds fetches and processes all feeds, returns statistics
-func processFeeds() (itemsCreated, itemsUpdated, errors int) {
-	return processFeedsWithFilter(false)
-}
 
-func processAllFeeds() (itemsCreated, itemsUpdated, errors int) {
-	return processFeedsWithFilter(true)
-}
-
-func processFeedsWithFilter(includeTest bool) (itemsCreated, itemsUpdated, errors int) {
-	var feeds []Feed
-	if includeTest {
-		// Include all feeds (for manual fetch)
-		DB.Find(&feeds)
-	} else {
-		// Exclude test feeds from background fetching (feeds with /test_feeds/ in URL)
-		DB.Where("url NOT LIKE ?", "%/test_feeds/%").Find(&feeds)
+	var starredAt *time.Time
+	if c.PostForm("starred") == "1" {
+		now := time.Now()
+		starredAt = &now
 	}
-
-	if len(feeds) == 0 {
-		return 0, 0, 0
-	}
-
-	// Counters with mutex for thread safety
-	var mu sync.Mutex
-	itemsCreated = 0
-	itemsUpdated = 0
-	errors = 0
-
-	// Worker pool: limit to 10 concurrent goroutines
-	const maxWorkers = 10
-	feedChan := make(chan Feed, len(feeds))
-	var wg sync.WaitGroup
-
-	// Start 10 worker goroutines
-	for i := 0; i < maxWorkers; i++ {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			fp := gofeed.NewParser()
-
-			for feed := range feedChan {
-				parsedFeed, err := fp.ParseURL(feed.URL)
-				if err != nil {
-					log.Printf("Error parsing feed %s: %v", feed.URL, err)
-					// Update feed with error information
-					now := time.Now()
-					feed.LastError = err.Error()
-					feed.LastErrorAt = &now
-					DB.Save(&feed)
-					// Add error log entry
-					addLogEntry("error", feed.URL, fmt.Sprintf("Failed to fetch feed: %v", err))
-					mu.Lock()
-					errors++
-					mu.Unlock()
-					continue
-				}
-
-				// Update feed title and description if available
-				if parsedFeed.Title != "" {
-					feed.Title = parsedFeed.Title
-				}
-				if parsedFeed.Description != "" {
-					feed.Description = parsedFeed.Description
-				}
-				// Update successful fetch timestamp and clear error
-				now := time.Now()
-				feed.LastSuccessfullyFetchedAt = &now
-				feed.LastError = ""
-				feed.LastErrorAt = nil
-				DB.Save(&feed)
-
-				// Local counters for this feed
-				feedCreated := 0
-				feedUpdated := 0
-
-				// Process items for this feed
-				for _, item := range parsedFeed.Items {
-					// Determine GUID
-					guid := item.GUID
-					if guid == "" {
-						guid = item.Link
-					}
-
-					// Parse published date
-					var publishedAt *time.Time
-					if item.PublishedParsed != nil {
-						publishedAt = item.PublishedParsed
-					} else if item.UpdatedParsed != nil {
-						publishedAt = item.UpdatedParsed
-					}
-
-					// Check if item already exists by GUID
-					var existingItem Item
-					result := DB.Where("guid = ? AND feed_id = ?", guid, feed.ID).First(&existingItem)
-
-					if result.Error != nil {
-						// Item doesn't exist, create it
-						// Sanitize HTML content before saving
-						description := SanitizeHTML(item.Description)
-						content := SanitizeHTML(getItemContent(item))
-						newItem := Item{
-							FeedID:      feed.ID,
-							Title:       item.Title,
-							Link:        item.Link,
-							Description: description,
-							Content:     content,
-							Author:      getItemAuthor(item),
-							PublishedAt: publishedAt,
-							GUID:        guid,
-						}
-						if err := DB.Create(&newItem).Error; err != nil {
-							log.Printf("Error creating item: %v", err)
-							mu.Lock()
-							errors++
-							mu.Unlock()
-						} else {
-							feedCreated++
-							mu.Lock()
-							itemsCreated++
-							mu.Unlock()
-						}
-					} else {
-						// Item exists, update it
-						// Sanitize HTML content before saving
-						description := SanitizeHTML(item.Description)
-						content := SanitizeHTML(getItemContent(item))
-						existingItem.Title = item.Title
-						existingItem.Link = item.Link
-						existingItem.Description = description
-						existingItem.Content = content
-						existingItem.Author = getItemAuthor(item)
-						if publishedAt != nil {
-							existingItem.PublishedAt = publishedAt
-						}
-						if err := DB.Save(&existingItem).Error; err != nil {
-							log.Printf("Error updating item: %v", err)
-							mu.Lock()
-							errors++
-							mu.Unlock()
-						} else {
-							feedUpdated++
-							mu.Lock()
-							itemsUpdated++
-							mu.Unlock()
-						}
-					}
-				}
-
-				// Add success log entry with created and updated counts
-				addLogEntry("success", feed.URL, fmt.Sprintf("Successfully fetched feed: %d created, %d updated", feedCreated, feedUpdated))
-			}
-		}()
+	if err := DB.Model(&item).UpdateColumn("starred_at", starredAt).Error; err != nil {
+		addFlashError(session, "Failed to update item: "+err.Error())
+		session.Save()
+		c.Redirect(http.StatusFound, redirectURL)
+		return
 	}
 
-	// Send all feeds to the channel
-	for _, feed := range feeds {
-		feedChan <- feed
+	if starredAt != nil {
+		addFlashSuccess(session, "Item starred; it is kept by retention")
+	} else {
+		addFlashSuccess(session, "Item unstarred")
 	}
-	close(feedChan)
-
-	// Wait for all workers to finish
-	wg.Wait()
-
-	return itemsCreated, itemsUpdated, errors
+	session.Save()
+	c.Redirect(http.StatusFound, redirectURL)
 }
 
-// processSingleFeed processes a single feed by ID and returns created, updated, and error count
-func processSingleFeed(feedID uint) (itemsCreated, itemsUpdated int, err error) {
-	var feed Feed
-	if err := DB.First(&feed, feedID).Error; err != nil {
-		return 0, 0, err
-	}
+// updateItemNote saves the user's annotation of an item; an empty note removes it
+// Annotated items are kept by retention
+func updateItemNote(c *gin.Context) {
+	id := c.Param("id")
+	session := sessions.Default(c)
+	redirectURL := "/admin/items/" + id
 
-	fp := gofeed.NewParser()
-	parsedFeed, err := fp.ParseURL(feed.URL)
-	if err != nil {
-		log.Printf("Error parsing feed %s: %v", feed.URL, err)
-		// Update feed with error information
-		now := time.Now()
-		feed.LastError = err.Error()
-		feed.LastErrorAt = &now
-		DB.Save(&feed)
-		// Add error log entry
-		addLogEntry("error", feed.URL, fmt.Sprintf("Failed to fetch feed: %v", err))
-		return 0, 0, err
+	var item Item
+	if err := DB.First(&item, id).Error; err != nil {
+		addFlashError(session, "Item not found")
+		session.Save()
+		c.Redirect(http.StatusFound, "/admin/items")
+		return
 	}
 
-	// Update feed title and description if available
-	if parsedFeed.Title != "" {
-		feed.Title = parsedFeed.Title
-	}
-	if parsedFeed.Description != "" {
-		feed.Description = parsedFeed.Description
+	note := strings.TrimSpace(c.PostForm("note"))
+	if err := DB.Model(&item).UpdateColumn("note", note).Error; err != nil {
+		addFlashError(session, "Failed to save note: "+err.Error())
+		session.Save()
+		c.Redirect(http.StatusFound, redirectURL)
+		return
 	}
-	// Update successful fetch timestamp and clear error
-	now := time.Now()
-	feed.LastSuccessfullyFetchedAt = &now
-	feed.LastError = ""
-	feed.LastErrorAt = nil
-	DB.Save(&feed)
-
-	// Local counters for this feed
-	feedCreated := 0
-	feedUpdated := 0
-
-	// Process items for this feed
-	for _, item := range parsedFeed.Items {
-		// Determine GUID
-		guid := item.GUID
-		if guid == "" {
-			guid = item.Link
-		}
-
-		// Parse published date
-		var publishedAt *time.Time
-		if item.PublishedParsed != nil {
-			publishedAt = item.PublishedParsed
-		} else if item.UpdatedParsed != nil {
-			publishedAt = item.UpdatedParsed
-		}
-
-		// Check if item already exists by GUID
-		var existingItem Item
-		result := DB.Where("guid = ? AND feed_id = ?", guid, feed.ID).First(&existingItem)
 
-		if result.Error != nil {
-			// Item doesn't exist, create it
-			// Sanitize HTML content before saving
-			description := SanitizeHTML(item.Description)
-			content := SanitizeHTML(getItemContent(item))
-			newItem := Item{
-				FeedID:      feed.ID,
-				Title:       item.Title,
-				Link:        item.Link,
-				Description: description,
-				Content:     content,
-				Author:      getItemAuthor(item),
-				PublishedAt: publishedAt,
-				GUID:        guid,
-			}
-			if err := DB.Create(&newItem).Error; err != nil {
-				log.Printf("Error creating item: %v", err)
-			} else {
-				feedCreated++
-			}
-		} else {
-			// Item exists, update it
-			// Sanitize HTML content before saving
-			description := SanitizeHTML(item.Description)
-			content := SanitizeHTML(getItemContent(item))
-			existingItem.Title = item.Title
-			existingItem.Link = item.Link
-			existingItem.Description = description
-			existingItem.Content = content
-			existingItem.Author = getItemAuthor(item)
-			if publishedAt != nil {
-				existingItem.PublishedAt = publishedAt
-			}
-			if err := DB.Save(&existingItem).Error; err != nil {
-				log.Printf("Error updating item: %v", err)
-			} else {
-				feedUpdated++
-			}
-		}
+	if note != "" {
+		addFlashSuccess(session, "Note saved; the item is kept by retention")
+	} else {
+		addFlashSuccess(session, "Note removed")
 	}
+	session.Save()
+	c.Redirect(http.StatusFound, redirectURL)
+}
 
-	// Add success log entry with created and updated counts
-	addLogEntry("success", feed.URL, fmt.Sprintf("Successfully fetched feed: %d created, %d updated", feedCreated, feedUpdated))
-
-	return feedCreated, feedUpdated, nil
+func deleteAllItems(c *gin.Context) {
+	session := sessions.Default(c)
+	result := DB.Delete(&Item{}, "1 = 1")
+	if result.Error != nil {
+		addFlashError(session, "Failed to delete all items")
+		session.Save()
+		c.Redirect(http.StatusFound, "/admin/items")
+		return
+	}
+	// Story clusters no longer have any items to list
+	if err := DB.Model(&StoryCluster{}).Where("1 = 1").Updates(map[string]interface{}{"item_count": 0, "source_count": 0}).Error; err != nil {
+		log.Printf("Error resetting story clusters: %v", err)
+	}
+	addFlashSuccess(session, "All items deleted successfully")
+	session.Save()
+	c.Redirect(http.StatusFound, "/admin/items")
 }
 
+// fetchFeedItems enqueues high-priority fetch jobs for all active feeds and waits for workers to run them
 func fetchFeedItems(c *gin.Context) {
 	session := sessions.Default(c)
 	var feeds []Feed
@@ -1552,12 +2189,43 @@ func fetchFeedItems(c *gin.Context) {
 		return
 	}
 
-	itemsCreated, itemsUpdated, errors := processAllFeeds()
+	// Paused feeds are only fetched when requested individually
+	now := time.Now()
+	var ids []uint
+	errors := 0
+	for _, feed := range feeds {
+		if feed.PausedAt != nil {
+			continue
+		}
+		job, err := EnqueueFetchJob(DB, feed.ID, FetchJobPriorityManual, now)
+		if err != nil {
+			log.Printf("Error enqueuing fetch of feed %s: %v", feed.URL, err)
+			errors++
+			continue
+		}
+		ids = append(ids, job.ID)
+	}
+
+	itemsCreated, itemsUpdated, pending := 0, 0, len(ids)
+	for _, job := range runManualFetchJobs(c.Request.Context(), ids) {
+		if job.FinishedAt == nil {
+			continue
+		}
+		pending--
+		itemsCreated += job.ItemsCreated
+		itemsUpdated += job.ItemsUpdated
+		if job.Status == FetchJobFailed {
+			errors++
+		}
+	}
 
 	successMsg := fmt.Sprintf("Fetched items: %d created, %d updated", itemsCreated, itemsUpdated)
 	if errors > 0 {
 		successMsg += fmt.Sprintf(", %d errors", errors)
 	}
+	if pending > 0 {
+		successMsg += fmt.Sprintf(", %d feeds still queued", pending)
+	}
 	addFlashSuccess(session, successMsg)
 	if err := session.Save(); err != nil {
 		log.Printf("Error saving session in fetchFeedItems: %v", err)
@@ -1565,40 +2233,53 @@ func fetchFeedItems(c *gin.Context) {
 	c.Redirect(http.StatusFound, "/admin/items")
 }
 
-// startBackgroundFeedFetcher starts a background goroutine that fetches feeds at configured interval
-func startBackgroundFeedFetcher() {
-	interval := GetBackgroundFetchInterval()
-	ticker := time.NewTicker(time.Duration(interval) * time.Second)
+// startBackgroundFeedFetcher runs a scheduler loop that periodically enqueues fetch jobs for feeds whose
+// NextFetchAt has passed and runs queued jobs; manual fetch requests wake it up immediately
+// The loop returns once ctx is cancelled and the fetches in progress have finished; fetches run with
+// workCtx, so cancelling it aborts them
+func startBackgroundFeedFetcher(ctx, workCtx context.Context) {
+	tick := GetSchedulerTick()
+	ticker := time.NewTicker(time.Duration(tick) * time.Second)
 	defer ticker.Stop()
 
-	// Fetch immediately on startup
-	log.Printf("Starting background feed fetcher (interval: %d seconds)", interval)
-	itemsCreated, itemsUpdated, errors := processAllFeeds()
-	log.Printf("Initial feed fetch completed: %d created, %d updated, %d errors", itemsCreated, itemsUpdated, errors)
-
-	// Then fetch at configured interval
-	for range ticker.C {
-		log.Println("Background feed fetch started")
-		itemsCreated, itemsUpdated, errors := processAllFeeds()
-		log.Printf("Background feed fetch completed: %d created, %d updated, %d errors", itemsCreated, itemsUpdated, errors)
-	}
-}
-
-func getItemContent(item *gofeed.Item) string {
-	if item.Content != "" {
-		return item.Content
-	}
-	return item.Description
-}
-
-func getItemAuthor(item *gofeed.Item) string {
-	if item.Author != nil && item.Author.Name != "" {
-		return item.Author.Name
-	}
-	if len(item.Authors) > 0 && item.Authors[0].Name != "" {
-		return item.Authors[0].Name
+	pruneTicker := time.NewTicker(time.Hour)
+	defer pruneTicker.Stop()
+
+	// Jobs enqueued by other processes don't wake this one, so poll the queue between ticks
+	queueTicker := time.NewTicker(fetchJobPollInterval)
+	defer queueTicker.Stop()
+
+	worker := NewFetchWorker(DB)
+
+	// Fetch due feeds and prune old fetch attempts, jobs and items immediately on startup
+	log.Printf("Starting background feed scheduler %s (tick: %d seconds, default interval: %d seconds)", worker.Owner, tick, GetBackgroundFetchInterval())
+	defer worker.retire()
+	worker.beat()
+	processDueFeeds(ctx, workCtx, worker)
+	runFetchAttemptPruning()
+	runFetchJobPruning()
+	runItemPruning()
+
+	// Then check for due feeds on every tick and prune fetch attempts, jobs and items hourly
+	for {
+		worker.beat()
+		select {
+		case <-ctx.Done():
+			log.Println("Background feed scheduler stopped")
+			return
+		case <-ticker.C:
+			processDueFeeds(ctx, workCtx, worker)
+			runWebSubRenewal(workCtx)
+		case <-fetchJobWake:
+			worker.Drain(ctx, workCtx)
+		case <-queueTicker.C:
+			worker.Drain(ctx, workCtx)
+		case <-pruneTicker.C:
+			runFetchAttemptPruning()
+			runFetchJobPruning()
+			runItemPruning()
+		}
 	}
-	return ""
 }
 
 // Tools handlers (only available when CYPRESS=true)
@@ -2003,7 +2684,7 @@ func migrate(c *gin.Context) {
 	}
 
 	// Run AutoMigrate for all models
-	err = db.AutoMigrate(&User{}, &Feed{}, &Item{})
+	err = AutoMigrateAll(db)
 	if err != nil {
 		addFlashError(session, "Failed to migrate database: "+err.Error())
 		session.Save()
@@ -55,18 +55,229 @@ type Feed struct {
 	LastSuccessfullyFetchedAt *time.Time
 	LastError                 string `gorm:"type:text"`
 	LastErrorAt               *time.Time
-	Items                     []Item `gorm:"foreignKey:FeedID;constraint:OnDelete:CASCADE;"`
+	ETag                      string           // ETag header from the last successful fetch
+	LastModified              string           // Last-Modified header from the last successful fetch
+	FetchInterval             int              // Seconds between fetches; 0 means BACKGROUND_FETCH_INTERVAL
+	FetchIntervalFixed        bool             // Set when an admin overrides the interval; disables adaptive scheduling
+	NextFetchAt               *time.Time       `gorm:"index"`
+	ConsecutiveFailures       int              // Failed fetches since the last successful one
+	PausedAt                  *time.Time       // Set when the feed is paused after too many failures
+	KeepItems                 int              // Newest items kept by retention; 0 means ITEM_KEEP_PER_FEED
+	HubURL                    string           // WebSub hub advertised by the feed (rel="hub")
+	SelfURL                   string           // Canonical topic URL advertised by the feed (rel="self")
+	RedirectURL               string           // Permanent redirect target seen on the latest fetches
+	RedirectCount             int              // Consecutive fetches permanently redirected to RedirectURL
+	FetchFullArticle          bool             // Download each item's link and store the extracted article as FullContent
+	ItemIdentity              string           // Which field identifies items: "guid" (default), "link" or "hash"; see itemIdentity
+	URLHistory                []FeedURLHistory `gorm:"foreignKey:FeedID;constraint:OnDelete:CASCADE;"`
+	Items                     []Item           `gorm:"foreignKey:FeedID;constraint:OnDelete:CASCADE;"`
+}
+
+// Status returns "paused", "failing" or "active" for display
+func (feed Feed) Status() string {
+	if feed.PausedAt != nil {
+		return "paused"
+	}
+	if feed.ConsecutiveFailures > 0 {
+		return "failing"
+	}
+	return "active"
 }
 
 type Item struct {
 	gorm.Model
-	FeedID      uint `gorm:"not null;index"`
+	FeedID               uint `gorm:"not null;index;uniqueIndex:idx_items_feed_guid"`
+	Title                string
+	Link                 string
+	Description          string `gorm:"type:text"`
+	Content              string `gorm:"type:text"`
+	Author               string
+	PublishedAt          *time.Time
+	GUID                 string      `gorm:"uniqueIndex:idx_items_feed_guid"` // Unique identifier within the feed
+	SourceGUID           string      `gorm:"type:text"`                       // GUID as published by the feed, "" if it had none
+	CanonicalURL         string      `gorm:"type:text;index"`                 // Normalized Link shared by copies of the item in other feeds
+	ContentHash          string      `gorm:"size:64"`                         // SHA-256 of the fields tracked for revisions
+	ImageURL             string      `gorm:"type:text"`                       // Lead image, picked during ingest
+	ImageWidth           int         // Lead image width in pixels, 0 if unknown
+	ImageHeight          int         // Lead image height in pixels, 0 if unknown
+	FullContent          string      `gorm:"type:text"` // Article extracted from Link for feeds with FetchFullArticle; Content keeps the feed's own
+	FullContentFetchedAt *time.Time  // When the article was last downloaded, nil if never tried
+	FullContentError     string      `gorm:"type:text"` // Why the last article download or extraction failed
+	Feed                 Feed        `gorm:"foreignKey:FeedID"`
+	Enclosures           []Enclosure `gorm:"foreignKey:ItemID;constraint:OnDelete:CASCADE;"`
+	Categories           []Category  `gorm:"many2many:item_categories;constraint:OnDelete:CASCADE;"`
+	Fingerprint          int64       // SimHash of title and text for near-duplicate detection, 0 if the item has too little text
+	ClusterID            *uint       `gorm:"index"`     // StoryCluster of near-duplicate items from other feeds, nil if none
+	StarredAt            *time.Time  `gorm:"index"`     // When the user starred the item, nil if not starred
+	Note                 string      `gorm:"type:text"` // The user's annotation; starred and annotated items are exempt from retention
+}
+
+// StoryCluster groups near-duplicate items: the same story as published by several feeds
+type StoryCluster struct {
+	ID          uint `gorm:"primarykey"`
+	CreatedAt   time.Time
+	Title       string    // Title of the item that started the cluster
+	ItemCount   int       // Items in the cluster, recounted when items join or are deleted
+	SourceCount int       // Distinct feeds among those items
+	LastSeenAt  time.Time `gorm:"index"` // When an item last joined
+	Items       []Item    `gorm:"foreignKey:ClusterID;constraint:OnDelete:SET NULL;"`
+}
+
+// Category is a normalized item category, shared by all feeds; items link to it through item_categories
+type Category struct {
+	ID   uint   `gorm:"primarykey"`
+	Name string `gorm:"not null"`             // Display name, as first seen in a feed
+	Key  string `gorm:"not null;uniqueIndex"` // Lower-cased name with collapsed whitespace, used for matching
+}
+
+// Enclosure is a media file attached to an Item: an RSS enclosure, Atom enclosure link or Media RSS content
+type Enclosure struct {
+	ID       uint   `gorm:"primarykey"`
+	ItemID   uint   `gorm:"not null;index"`
+	URL      string `gorm:"type:text;not null"`
+	Type     string // MIME type, guessed from the file extension when the feed doesn't provide one
+	Length   int64  // Size in bytes, 0 if unknown
+	Duration int    // Playing time in seconds (Media RSS or iTunes), 0 if unknown
+	Position int    // Order within the item
+}
+
+// ItemRevision is a previous version of an Item, kept when a fetch brings changed content
+type ItemRevision struct {
+	ID          uint `gorm:"primarykey"`
+	ItemID      uint `gorm:"not null;index"`
 	Title       string
 	Link        string
 	Description string `gorm:"type:text"`
 	Content     string `gorm:"type:text"`
 	Author      string
-	PublishedAt *time.Time
-	GUID        string `gorm:"index"` // Unique identifier from feed
-	Feed        Feed   `gorm:"foreignKey:FeedID"`
+	ContentHash string    `gorm:"size:64"`
+	ReplacedAt  time.Time `gorm:"index"` // When this version was replaced by a newer one
+	Item        Item      `gorm:"foreignKey:ItemID;constraint:OnDelete:CASCADE"`
+}
+
+// WebSub subscription states
+const (
+	WebSubStatePending = "pending" // Subscription requested, waiting for the hub to verify intent
+	WebSubStateActive  = "active"  // Verified; the hub pushes updates until ExpiresAt
+	WebSubStateDenied  = "denied"  // The hub refused the subscription
+	WebSubStateError   = "error"   // The subscription request failed
+)
+
+// WebSubSubscription is a push subscription of a feed at its WebSub hub
+// While the lease is valid the scheduler does not poll the feed
+type WebSubSubscription struct {
+	ID          uint            `gorm:"primarykey"`
+	FeedID      uint            `gorm:"not null;uniqueIndex"`
+	HubURL      string          `gorm:"not null"`
+	Topic       string          `gorm:"not null"`
+	Secret      EncryptedString // HMAC secret the hub signs pushed payloads with, encrypted at rest
+	State       string          `gorm:"index"`
+	RequestedAt *time.Time      // When the last (re)subscription was requested
+	VerifiedAt  *time.Time
+	ExpiresAt   *time.Time `gorm:"index"` // End of the current lease
+	LastError   string     `gorm:"type:text"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Feed        Feed `gorm:"foreignKey:FeedID;constraint:OnDelete:CASCADE"`
+}
+
+// FeedHTTPOptions are per-feed settings applied to every request for the feed
+// Secrets are EncryptedString columns, encrypted at rest with FEED_SECRETS_KEY
+type FeedHTTPOptions struct {
+	ID          uint            `gorm:"primarykey"`
+	FeedID      uint            `gorm:"not null;uniqueIndex"`
+	Username    string          // HTTP basic auth user; sent when Username or Password is set
+	Password    EncryptedString `gorm:"type:text"`
+	BearerToken EncryptedString `gorm:"type:text"` // Sent as "Authorization: Bearer"; ignored when basic auth is set
+	Cookie      EncryptedString `gorm:"type:text"` // Raw Cookie header value
+	Headers     EncryptedString `gorm:"type:text"` // Extra "Name: value" headers, one per line
+	UserAgent   string          // Overrides the default User-Agent
+	ProxyURL    EncryptedString `gorm:"type:text"` // http, https or socks5 proxy; may contain credentials
+	CACert      string          `gorm:"type:text"` // PEM certificates trusted in addition to the system roots
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Feed        Feed `gorm:"foreignKey:FeedID;constraint:OnDelete:CASCADE"`
+}
+
+// FeedURLHistory keeps a URL a feed was fetched from before it moved
+// Previous URLs count as taken when a feed is created
+type FeedURLHistory struct {
+	ID         uint      `gorm:"primarykey"`
+	FeedID     uint      `gorm:"not null;index"`
+	URL        string    `gorm:"not null;index"`
+	ReplacedBy string    // URL the feed moved to
+	ReplacedAt time.Time // When the feed moved
+	Feed       Feed      `gorm:"foreignKey:FeedID;constraint:OnDelete:CASCADE"`
+}
+
+// Fetch job statuses
+const (
+	FetchJobQueued  = "queued"  // Waiting for a worker
+	FetchJobRunning = "running" // Leased by a worker until LeaseExpiresAt
+	FetchJobDone    = "done"
+	FetchJobFailed  = "failed"
+)
+
+// Fetch job priorities; higher priorities are claimed first
+const (
+	FetchJobPriorityScheduled = 0  // Enqueued by the scheduler for a due feed
+	FetchJobPriorityManual    = 10 // Requested from the UI
+)
+
+// FetchJob is a queued fetch of a feed. Workers on any replica claim jobs by leasing them,
+// so each feed is fetched by one worker at a time; a feed has at most one unfinished job
+type FetchJob struct {
+	ID             uint       `gorm:"primarykey"`
+	FeedID         uint       `gorm:"not null;index;uniqueIndex:idx_fetch_jobs_unfinished_feed,where:finished_at IS NULL"`
+	Priority       int        `gorm:"not null;default:0"`
+	Status         string     `gorm:"not null;index"`
+	AvailableAt    time.Time  `gorm:"index"` // Not claimed before this time
+	LeaseOwner     string     // Worker holding the lease
+	LeaseExpiresAt *time.Time `gorm:"index"` // Other workers may reclaim the job after this time
+	Attempts       int        // How often the job was claimed
+	ItemsCreated   int
+	ItemsUpdated   int
+	Error          string `gorm:"type:text"`
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	FinishedAt     *time.Time `gorm:"index"`
+	Feed           Feed       `gorm:"foreignKey:FeedID;constraint:OnDelete:CASCADE"`
+}
+
+// FetchWorkerHeartbeat records when a background fetcher last made progress, so processes
+// without one can tell whether a worker will pick up their manual fetch jobs
+type FetchWorkerHeartbeat struct {
+	Owner  string    `gorm:"primarykey"` // FetchWorker.Owner
+	BeatAt time.Time `gorm:"index"`
+}
+
+// Fetch attempt statuses
+const (
+	FetchStatusSuccess     = "success"
+	FetchStatusNotModified = "not_modified"
+	FetchStatusError       = "error"
+)
+
+// FetchAttempt records a single fetch of a feed (shown on /logs)
+type FetchAttempt struct {
+	ID                uint      `gorm:"primarykey"`
+	FeedID            uint      `gorm:"not null;index"`
+	FeedURL           string    // URL at the time of the fetch
+	Status            string    `gorm:"index"` // FetchStatusSuccess, FetchStatusNotModified or FetchStatusError
+	StartedAt         time.Time `gorm:"index"`
+	FinishedAt        time.Time
+	HTTPStatus        int    // 0 when no response was received
+	Bytes             int64  // Size of the response body
+	RedirectChain     string `gorm:"type:text"` // Redirects followed, one "<status> <url>" per line
+	PermanentRedirect string // Where permanent redirects led, "" if there were none
+	ItemsCreated      int
+	ItemsUpdated      int
+	Error             string `gorm:"type:text"`
+	Message           string `gorm:"type:text"`
+	Feed              Feed   `gorm:"foreignKey:FeedID;constraint:OnDelete:CASCADE;"`
+}
+
+// Duration returns how long the fetch took
+func (attempt FetchAttempt) Duration() time.Duration {
+	return attempt.FinishedAt.Sub(attempt.StartedAt)
 }
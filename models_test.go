@@ -15,8 +15,15 @@ func setupTestDB(t *testing.T) *gorm.DB {
 		t.Fatalf("Failed to connect to test database: %v", err)
 	}
 
+	// Every connection to ":memory:" opens a separate database, so keep a single one
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("Failed to get test database connection: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+
 	// Auto-migrate models
-	err = db.AutoMigrate(&User{}, &Feed{}, &Item{})
+	err = AutoMigrateAll(db)
 	if err != nil {
 		t.Fatalf("Failed to migrate test database: %v", err)
 	}
@@ -205,3 +212,37 @@ func TestUser_BeforeSave_UpdateWithoutPassword(t *testing.T) {
 	assert.Equal(t, initialHashedPassword, updatedUser.Password, "Password should remain unchanged")
 	assert.True(t, updatedUser.CheckPassword("password123"), "Original password should still work")
 }
+
+func TestItem_UniqueFeedGUID(t *testing.T) {
+	db := setupTestDB(t)
+
+	feed := Feed{URL: "https://example.com/feed.xml"}
+	db.Create(&feed)
+
+	assert.NoError(t, db.Create(&Item{FeedID: feed.ID, GUID: "a"}).Error)
+	assert.Error(t, db.Create(&Item{FeedID: feed.ID, GUID: "a"}).Error, "Should reject a duplicate GUID within a feed")
+
+	other := Feed{URL: "https://example.com/other.xml"}
+	db.Create(&other)
+	assert.NoError(t, db.Create(&Item{FeedID: other.ID, GUID: "a"}).Error, "Should allow the same GUID in another feed")
+}
+
+func TestAutoMigrateAll_RemovesDuplicateItems(t *testing.T) {
+	db := setupTestDB(t)
+
+	// Simulate a database created before the unique index existed
+	assert.NoError(t, db.Migrator().DropIndex(&Item{}, "idx_items_feed_guid"))
+	feed := Feed{URL: "https://example.com/feed.xml"}
+	db.Create(&feed)
+	db.Create(&Item{FeedID: feed.ID, GUID: "a", Title: "old"})
+	db.Create(&Item{FeedID: feed.ID, GUID: "a", Title: "new"})
+	db.Create(&Item{FeedID: feed.ID, GUID: "b"})
+
+	assert.NoError(t, AutoMigrateAll(db))
+	assert.True(t, db.Migrator().HasIndex(&Item{}, "idx_items_feed_guid"), "Should create the unique index")
+
+	var items []Item
+	db.Order("guid").Find(&items)
+	assert.Equal(t, 2, len(items), "Should remove duplicate items")
+	assert.Equal(t, "new", items[0].Title, "Should keep the newest duplicate")
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"html/template"
+	"sort"
+	"strings"
+	"time"
+)
+
+// previewSampleSize is how many of the newest items a feed preview shows
+const previewSampleSize = 5
+
+// FeedPreview summarizes a feed that was downloaded and parsed without saving anything
+type FeedPreview struct {
+	URL         string
+	Title       string
+	Description string
+	Link        string        // Website the feed belongs to
+	Type        string        // Feed format and version, e.g. "RSS 2.0"
+	ItemCount   int           // Items in the feed, after merging duplicate GUIDs like a fetch does
+	NewestAt    *time.Time    // Newest item date, nil if no item has one
+	OldestAt    *time.Time    // Oldest item date, nil if no item has one
+	Items       []PreviewItem // Newest previewSampleSize items
+}
+
+// PreviewItem is a sample item of a FeedPreview, sanitized the way it would be stored
+type PreviewItem struct {
+	Title       string
+	Link        string
+	Author      string
+	PublishedAt *time.Time
+	Summary     template.HTML // Sanitized description, or content if the item has no description
+}
+
+// Preview downloads and parses a feed with the same client, limits and parsing as a fetch,
+// but records no fetch attempt and saves no feed or items
+func (f *FeedFetcher) Preview(ctx context.Context, rawURL string) (*FeedPreview, error) {
+	feed := Feed{URL: rawURL}
+	var attempt FetchAttempt
+	parsedFeed, _, err := f.download(ctx, &feed, &attempt)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := buildItems(&feed, parsedFeed.Items)
+	preview := &FeedPreview{
+		URL:         rawURL,
+		Title:       parsedFeed.Title,
+		Description: parsedFeed.Description,
+		Link:        parsedFeed.Link,
+		Type:        strings.TrimSpace(strings.ToUpper(parsedFeed.FeedType) + " " + parsedFeed.FeedVersion),
+		ItemCount:   len(rows),
+	}
+	if parsedFeed.FeedType == "json" {
+		preview.Type = strings.TrimSpace("JSON Feed " + parsedFeed.FeedVersion)
+	}
+
+	// Newest first; items without a date keep their feed order after the dated ones
+	sort.SliceStable(rows, func(i, j int) bool {
+		a, b := rows[i].PublishedAt, rows[j].PublishedAt
+		if a == nil || b == nil {
+			return a != nil
+		}
+		return a.After(*b)
+	})
+	for _, row := range rows {
+		if row.PublishedAt == nil {
+			continue
+		}
+		if preview.NewestAt == nil {
+			preview.NewestAt = row.PublishedAt
+		}
+		preview.OldestAt = row.PublishedAt
+	}
+
+	for i, row := range rows {
+		if i == previewSampleSize {
+			break
+		}
+		summary := row.Description
+		if summary == "" {
+			summary = row.Content
+		}
+		preview.Items = append(preview.Items, PreviewItem{
+			Title:       row.Title,
+			Link:        row.Link,
+			Author:      row.Author,
+			PublishedAt: row.PublishedAt,
+			Summary:     template.HTML(summary), // Sanitized by buildItems
+		})
+	}
+	return preview, nil
+}
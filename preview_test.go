@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFeedFetcher_Preview(t *testing.T) {
+	fetcher, _ := newTestFetcher(t)
+
+	var items strings.Builder
+	for day := 1; day <= 7; day++ {
+		fmt.Fprintf(&items, `<item><title>Day %d</title><link>http://example.com/%d</link><guid>%d</guid>`+
+			`<pubDate>Mon, %02d Jan 2024 10:00:00 GMT</pubDate>`+
+			`<description>&lt;p&gt;Text %d&lt;/p&gt;&lt;script&gt;alert(1)&lt;/script&gt;</description></item>`, day, day, day, day, day)
+	}
+	items.WriteString(`<item><title>Undated</title><guid>undated</guid></item>`)
+	body := `<?xml version="1.0"?><rss version="2.0"><channel><title>Daily</title>` +
+		`<link>http://example.com/</link><description>One a day</description>` + items.String() + `</channel></rss>`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/rss+xml")
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	preview, err := fetcher.Preview(context.Background(), server.URL+"/feed.xml")
+	assert.NoError(t, err)
+	if !assert.NotNil(t, preview) {
+		return
+	}
+	assert.Equal(t, "Daily", preview.Title)
+	assert.Equal(t, "One a day", preview.Description)
+	assert.Equal(t, "RSS 2.0", preview.Type)
+	assert.Equal(t, 8, preview.ItemCount)
+	if assert.NotNil(t, preview.NewestAt) && assert.NotNil(t, preview.OldestAt) {
+		assert.Equal(t, 7, preview.NewestAt.Day())
+		assert.Equal(t, 1, preview.OldestAt.Day())
+	}
+
+	if assert.Len(t, preview.Items, previewSampleSize) {
+		assert.Equal(t, "Day 7", preview.Items[0].Title, "Should show the newest items first")
+		assert.Equal(t, "Day 3", preview.Items[previewSampleSize-1].Title)
+		assert.Contains(t, string(preview.Items[0].Summary), "<p>Text 7</p>")
+		assert.NotContains(t, string(preview.Items[0].Summary), "script", "Should sanitize item HTML")
+	}
+
+	var feeds, attempts, stored int64
+	fetcher.DB.Model(&Feed{}).Count(&feeds)
+	fetcher.DB.Model(&FetchAttempt{}).Count(&attempts)
+	fetcher.DB.Model(&Item{}).Count(&stored)
+	assert.Equal(t, int64(0), feeds, "Should not create a feed")
+	assert.Equal(t, int64(0), attempts, "Should not log a fetch attempt")
+	assert.Equal(t, int64(0), stored, "Should not store items")
+}
+
+func TestFeedFetcher_PreviewErrors(t *testing.T) {
+	fetcher, _ := newTestFetcher(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><head><title>Blog</title></head><body>Not a feed</body></html>`))
+	}))
+	defer server.Close()
+
+	_, err := fetcher.Preview(context.Background(), server.URL+"/missing")
+	assert.Error(t, err)
+
+	_, err = fetcher.Preview(context.Background(), server.URL+"/page")
+	assert.Error(t, err, "Should fail for web pages")
+}
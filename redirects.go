@@ -0,0 +1,142 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// maxRedirects matches the limit of http.Client's default redirect policy
+const maxRedirects = 10
+
+// redirectHop is a single redirect followed while fetching a feed
+type redirectHop struct {
+	Status int    // Status code of the redirect response
+	URL    string // Location the response redirected to
+}
+
+// recordRedirects returns a CheckRedirect policy that appends every followed redirect to hops
+// and then applies next, or the default limit of 10 redirects when next is nil
+func recordRedirects(next func(*http.Request, []*http.Request) error, hops *[]redirectHop) func(*http.Request, []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		status := 0
+		if req.Response != nil {
+			status = req.Response.StatusCode
+		}
+		*hops = append(*hops, redirectHop{Status: status, URL: req.URL.String()})
+		if next != nil {
+			return next(req, via)
+		}
+		if len(via) >= maxRedirects {
+			return fmt.Errorf("stopped after %d redirects", maxRedirects)
+		}
+		return nil
+	}
+}
+
+// formatRedirectChain renders hops one per line as "<status> <url>" for FetchAttempt.RedirectChain
+func formatRedirectChain(hops []redirectHop) string {
+	lines := make([]string, len(hops))
+	for i, hop := range hops {
+		lines[i] = fmt.Sprintf("%d %s", hop.Status, hop.URL)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// permanentRedirectTarget returns where the leading permanent redirects (301/308) of hops lead,
+// or "" if the first redirect is temporary or there was none. A later temporary redirect
+// doesn't change where the feed has permanently moved to
+func permanentRedirectTarget(hops []redirectHop) string {
+	target := ""
+	for _, hop := range hops {
+		if hop.Status != http.StatusMovedPermanently && hop.Status != http.StatusPermanentRedirect {
+			break
+		}
+		target = hop.URL
+	}
+	return target
+}
+
+// trackRedirect counts consecutive fetches that were permanently redirected to the same target
+// and moves the feed there once FETCH_REDIRECT_THRESHOLD is reached. The caller saves the feed
+// Feeds with HTTP options are only moved within their host: their credentials and headers are not
+// sent along on redirects to another host, so moving them there is left to an admin (see moveFeed)
+// Returns a note for the fetch attempt when the feed was moved or could not be moved
+func (f *FeedFetcher) trackRedirect(feed *Feed, target string) string {
+	switch {
+	case target == "" || target == feed.URL:
+		feed.RedirectURL = ""
+		feed.RedirectCount = 0
+		return ""
+	case target == feed.RedirectURL:
+		feed.RedirectCount++
+	default:
+		feed.RedirectURL = target
+		feed.RedirectCount = 1
+	}
+	if feed.RedirectCount < GetRedirectThreshold() {
+		return ""
+	}
+	if feedHost(target) != feedHost(feed.URL) {
+		options, err := f.loadHTTPOptions(feed.ID)
+		if err != nil {
+			return fmt.Sprintf("permanently redirected to %s, but the URL was not updated: %v", target, err)
+		}
+		if options != nil && !options.IsEmpty() {
+			return fmt.Sprintf("permanently redirected to %s on another host; the URL was not updated because the feed has HTTP options, move it from the feed page", target)
+		}
+	}
+
+	oldURL := feed.URL
+	if err := moveFeedURL(f.DB, feed, target, f.Now()); err != nil {
+		log.Printf("Not moving feed %s to %s: %v", oldURL, target, err)
+		return fmt.Sprintf("permanently redirected to %s, but the URL was not updated: %v", target, err)
+	}
+	log.Printf("Feed %s moved to %s after %d permanent redirects", oldURL, target, feed.RedirectCount)
+	feed.RedirectURL = ""
+	feed.RedirectCount = 0
+	return fmt.Sprintf("URL changed from %s to %s after consistent permanent redirects", oldURL, target)
+}
+
+// moveFeedURL changes feed's URL to newURL and keeps the old one in FeedURLHistory
+// Fails if another feed already uses newURL, currently or in the past
+func moveFeedURL(db *gorm.DB, feed *Feed, newURL string, now time.Time) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		existing, err := findFeedByURL(tx, newURL, feed.ID)
+		if err == nil {
+			return fmt.Errorf("feed #%d already uses %s", existing.ID, newURL)
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		history := FeedURLHistory{FeedID: feed.ID, URL: feed.URL, ReplacedAt: now, ReplacedBy: newURL}
+		if err := tx.Create(&history).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(feed).Update("url", newURL).Error; err != nil {
+			return err
+		}
+		feed.URL = newURL
+		return nil
+	})
+}
+
+// findFeedByURL returns a feed other than exceptID (0 for any feed) whose current or a previous URL is rawURL
+// Returns gorm.ErrRecordNotFound if there is none
+func findFeedByURL(db *gorm.DB, rawURL string, exceptID uint) (*Feed, error) {
+	var feed Feed
+	previous := db.Model(&FeedURLHistory{}).Select("feed_id").Where("url = ?", rawURL)
+	err := db.Where("id <> ?", exceptID).
+		Where(db.Where("url = ?", rawURL).Or("id IN (?)", previous)).
+		First(&feed).Error
+	if err != nil {
+		return nil, err
+	}
+	return &feed, nil
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPermanentRedirectTarget(t *testing.T) {
+	tests := []struct {
+		name     string
+		hops     []redirectHop
+		expected string
+	}{
+		{name: "no redirects", hops: nil, expected: ""},
+		{name: "moved permanently", hops: []redirectHop{{301, "https://b/feed"}}, expected: "https://b/feed"},
+		{name: "permanent chain", hops: []redirectHop{{301, "https://b/feed"}, {308, "https://c/feed"}}, expected: "https://c/feed"},
+		{name: "temporary first", hops: []redirectHop{{302, "https://b/feed"}, {301, "https://c/feed"}}, expected: ""},
+		{name: "temporary after permanent", hops: []redirectHop{{301, "https://b/feed"}, {307, "https://c/feed"}}, expected: "https://b/feed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, permanentRedirectTarget(tt.hops))
+		})
+	}
+}
+
+func TestFeedFetcher_FetchFollowsPermanentRedirect(t *testing.T) {
+	t.Setenv("FETCH_REDIRECT_THRESHOLD", "2")
+	fetcher, _ := newTestFetcher(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/old.xml", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/new.xml", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/new.xml", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(testRSS))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	oldURL, newURL := server.URL+"/old.xml", server.URL+"/new.xml"
+	feed := Feed{URL: oldURL}
+	fetcher.DB.Create(&feed)
+
+	// First redirected fetch only records the redirect
+	_, err := fetcher.Fetch(context.Background(), &feed)
+	assert.NoError(t, err)
+	assert.Equal(t, oldURL, feed.URL, "Should not move after a single redirect")
+	assert.Equal(t, newURL, feed.RedirectURL)
+	assert.Equal(t, 1, feed.RedirectCount)
+
+	var attempt FetchAttempt
+	fetcher.DB.Order("id DESC").First(&attempt)
+	assert.Equal(t, "301 "+newURL, attempt.RedirectChain, "Should record the redirect chain")
+	assert.Equal(t, newURL, attempt.PermanentRedirect)
+
+	// Second consistent redirect moves the feed and keeps the old URL
+	_, err = fetcher.Fetch(context.Background(), &feed)
+	assert.NoError(t, err)
+	var reloaded Feed
+	fetcher.DB.First(&reloaded, feed.ID)
+	assert.Equal(t, newURL, reloaded.URL, "Should move the feed after consistent redirects")
+	assert.Equal(t, 0, reloaded.RedirectCount)
+
+	var history []FeedURLHistory
+	fetcher.DB.Find(&history)
+	assert.Len(t, history, 1)
+	assert.Equal(t, oldURL, history[0].URL)
+	assert.Equal(t, newURL, history[0].ReplacedBy)
+
+	// The old URL still identifies the feed
+	found, err := findFeedByURL(fetcher.DB, oldURL, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, feed.ID, found.ID, "Should match historical URLs")
+	_, err = findFeedByURL(fetcher.DB, oldURL, feed.ID)
+	assert.Error(t, err, "Should exclude the given feed")
+}
+
+func TestFeedFetcher_FetchRedirectToOtherHostWithHTTPOptions(t *testing.T) {
+	t.Setenv("FETCH_REDIRECT_THRESHOLD", "1")
+	t.Setenv("FEED_SECRETS_KEY", "test-key")
+	fetcher, _ := newTestFetcher(t)
+
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(testRSS))
+	}))
+	defer other.Close()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/away.xml", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, other.URL+"/feed.xml", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/old.xml", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/new.xml", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/new.xml", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(testRSS))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	away := Feed{URL: server.URL + "/away.xml"}
+	fetcher.DB.Create(&away)
+	fetcher.DB.Create(&FeedHTTPOptions{FeedID: away.ID, Cookie: "session=secret"})
+	_, err := fetcher.Fetch(context.Background(), &away)
+	assert.NoError(t, err)
+	var reloaded Feed
+	fetcher.DB.First(&reloaded, away.ID)
+	assert.Equal(t, server.URL+"/away.xml", reloaded.URL, "Should not move a feed with HTTP options to another host")
+	assert.Equal(t, other.URL+"/feed.xml", reloaded.RedirectURL, "Should keep the target for an admin to move it")
+	var attempt FetchAttempt
+	fetcher.DB.Order("id DESC").First(&attempt)
+	assert.Contains(t, attempt.Message, "the feed has HTTP options")
+
+	// Within the same host the options go along anyway, so the feed is moved
+	moved := Feed{URL: server.URL + "/old.xml"}
+	fetcher.DB.Create(&moved)
+	fetcher.DB.Create(&FeedHTTPOptions{FeedID: moved.ID, Cookie: "session=secret"})
+	_, err = fetcher.Fetch(context.Background(), &moved)
+	assert.NoError(t, err)
+	assert.Equal(t, server.URL+"/new.xml", moved.URL)
+}
+
+func TestFeedFetcher_FetchRedirectConflict(t *testing.T) {
+	t.Setenv("FETCH_REDIRECT_THRESHOLD", "1")
+	fetcher, _ := newTestFetcher(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/old.xml", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/new.xml", http.StatusPermanentRedirect)
+	})
+	mux.HandleFunc("/new.xml", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(testRSS))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	existing := Feed{URL: server.URL + "/new.xml"}
+	fetcher.DB.Create(&existing)
+	feed := Feed{URL: server.URL + "/old.xml"}
+	fetcher.DB.Create(&feed)
+
+	_, err := fetcher.Fetch(context.Background(), &feed)
+	assert.NoError(t, err)
+	assert.Equal(t, server.URL+"/old.xml", feed.URL, "Should not move onto another feed's URL")
+
+	var attempt FetchAttempt
+	fetcher.DB.Order("id DESC").First(&attempt)
+	assert.Contains(t, attempt.Message, "was not updated")
+}
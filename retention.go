@@ -0,0 +1,173 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// FeedPruneResult contains the items of one feed removed (or, in a dry run, to be removed) by retention
+type FeedPruneResult struct {
+	FeedID    uint
+	FeedURL   string
+	Expired   int // Items older than ITEM_MAX_AGE_DAYS
+	OverLimit int // Items beyond the newest KeepItems of the feed
+}
+
+// ItemPruneReport summarizes an item retention run
+type ItemPruneReport struct {
+	Feeds []FeedPruneResult // Only feeds with items to remove
+	Total int
+}
+
+// itemDateExpr is the date retention rules are applied to: publication date, or creation date for undated items
+const itemDateExpr = "COALESCE(published_at, created_at)"
+
+// itemMaxAgeCutoff returns the publication date before which items expire, or nil if ITEM_MAX_AGE_DAYS is not set
+func itemMaxAgeCutoff(now time.Time) *time.Time {
+	days := GetItemMaxAgeDays()
+	if days == 0 {
+		return nil
+	}
+	cutoff := now.AddDate(0, 0, -days)
+	return &cutoff
+}
+
+// feedKeepItems returns how many of the newest items are kept for feed (0 means no limit)
+func feedKeepItems(feed *Feed) int {
+	if feed.KeepItems > 0 {
+		return feed.KeepItems
+	}
+	return GetItemKeepPerFeed()
+}
+
+// retentionCandidates scopes an item query to items that retention may remove:
+// starred and annotated items are kept regardless of every retention rule
+func retentionCandidates(db *gorm.DB) *gorm.DB {
+	return db.Where("starred_at IS NULL AND (note IS NULL OR note = '')")
+}
+
+// keepItemsFloor returns the date of the oldest item feed keeps under its KeepItems limit, or nil
+// while the feed keeps fewer items than that. Ingest skips new items older than this date: retention
+// would remove them again right away, and they would come back as new on every fetch
+func keepItemsFloor(db *gorm.DB, feed *Feed, cutoff *time.Time) (*time.Time, error) {
+	keep := feedKeepItems(feed)
+	if keep == 0 {
+		return nil, nil
+	}
+	query := retentionCandidates(db.Model(&Item{})).Where("feed_id = ?", feed.ID)
+	if cutoff != nil {
+		query = query.Where(itemDateExpr+" >= ?", *cutoff)
+	}
+	var kept []Item
+	err := query.Select("id", "published_at", "created_at").
+		Order(itemDateExpr + " DESC, id DESC").Offset(keep - 1).Limit(1).Find(&kept).Error
+	if err != nil || len(kept) == 0 {
+		return nil, err
+	}
+	if kept[0].PublishedAt != nil {
+		return kept[0].PublishedAt, nil
+	}
+	return &kept[0].CreatedAt, nil
+}
+
+// pruneItems applies the retention rules to every feed: items older than ITEM_MAX_AGE_DAYS
+// and items beyond the newest KeepItems (or ITEM_KEEP_PER_FEED) of their feed are deleted,
+// together with their revisions. With dryRun nothing is deleted and the report lists what would be
+func pruneItems(db *gorm.DB, now time.Time, dryRun bool) (ItemPruneReport, error) {
+	var report ItemPruneReport
+	cutoff := itemMaxAgeCutoff(now)
+
+	var feeds []Feed
+	if err := db.Order("id").Find(&feeds).Error; err != nil {
+		return report, err
+	}
+
+	for i := range feeds {
+		feed := &feeds[i]
+		result := FeedPruneResult{FeedID: feed.ID, FeedURL: feed.URL}
+		var ids []uint
+
+		// Expired items, including ones already soft-deleted from the UI
+		if cutoff != nil {
+			var expired []uint
+			err := retentionCandidates(db.Unscoped().Model(&Item{})).
+				Where("feed_id = ? AND "+itemDateExpr+" < ?", feed.ID, *cutoff).
+				Pluck("id", &expired).Error
+			if err != nil {
+				return report, err
+			}
+			result.Expired = len(expired)
+			ids = append(ids, expired...)
+		}
+
+		// Items beyond the newest N that have not expired already
+		if keep := feedKeepItems(feed); keep > 0 {
+			var newestFirst []uint
+			query := retentionCandidates(db.Model(&Item{})).Where("feed_id = ?", feed.ID)
+			if cutoff != nil {
+				query = query.Where(itemDateExpr+" >= ?", *cutoff)
+			}
+			if err := query.Order(itemDateExpr+" DESC, id DESC").Pluck("id", &newestFirst).Error; err != nil {
+				return report, err
+			}
+			if len(newestFirst) > keep {
+				result.OverLimit = len(newestFirst) - keep
+				ids = append(ids, newestFirst[keep:]...)
+			}
+		}
+
+		if len(ids) == 0 {
+			continue
+		}
+		if !dryRun {
+			if err := deleteItems(db, ids); err != nil {
+				return report, err
+			}
+		}
+		report.Feeds = append(report.Feeds, result)
+		report.Total += len(ids)
+	}
+	return report, nil
+}
+
+// deleteItems permanently deletes items and their revisions in batches and recounts their story clusters
+func deleteItems(db *gorm.DB, ids []uint) error {
+	const batchSize = 500
+	return db.Transaction(func(tx *gorm.DB) error {
+		for start := 0; start < len(ids); start += batchSize {
+			end := start + batchSize
+			if end > len(ids) {
+				end = len(ids)
+			}
+			batch := ids[start:end]
+			clusterIDs, err := clusterIDsOf(tx, batch)
+			if err != nil {
+				return err
+			}
+			if err := tx.Where("item_id IN ?", batch).Delete(&ItemRevision{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Unscoped().Where("id IN ?", batch).Delete(&Item{}).Error; err != nil {
+				return err
+			}
+			if err := refreshStoryClusters(tx, clusterIDs); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// runItemPruning applies the item retention rules and logs the outcome
+func runItemPruning() {
+	report, err := pruneItems(DB, time.Now(), false)
+	if err != nil {
+		log.Printf("Error pruning items: %v", err)
+		return
+	}
+	if report.Total > 0 {
+		log.Printf("Pruned %d items from %d feeds", report.Total, len(report.Feeds))
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPruneItems(t *testing.T) {
+	db := setupTestDB(t)
+	t.Setenv("ITEM_MAX_AGE_DAYS", "30")
+	t.Setenv("ITEM_KEEP_PER_FEED", "2")
+
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	daysAgo := func(days int) *time.Time {
+		date := now.AddDate(0, 0, -days)
+		return &date
+	}
+
+	limited := Feed{URL: "https://example.com/limited.xml"}
+	override := Feed{URL: "https://example.com/override.xml", KeepItems: 5}
+	db.Create(&limited)
+	db.Create(&override)
+
+	// limited: one expired item and four recent ones, of which only the newest two are kept
+	db.Create(&Item{FeedID: limited.ID, GUID: "old", PublishedAt: daysAgo(60)})
+	for i, guid := range []string{"r1", "r2", "r3", "r4"} {
+		db.Create(&Item{FeedID: limited.ID, GUID: guid, PublishedAt: daysAgo(i + 1)})
+	}
+	db.Create(&ItemRevision{ItemID: 1, Title: "revision of an expired item"})
+	// override: keeps up to five items, so only the expired one goes
+	db.Create(&Item{FeedID: override.ID, GUID: "old", PublishedAt: daysAgo(45)})
+	db.Create(&Item{FeedID: override.ID, GUID: "new", PublishedAt: daysAgo(1)})
+
+	// Dry run reports without deleting
+	report, err := pruneItems(db, now, true)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, report.Total)
+	assert.Equal(t, []FeedPruneResult{
+		{FeedID: limited.ID, FeedURL: limited.URL, Expired: 1, OverLimit: 2},
+		{FeedID: override.ID, FeedURL: override.URL, Expired: 1, OverLimit: 0},
+	}, report.Feeds)
+	var count int64
+	db.Model(&Item{}).Count(&count)
+	assert.Equal(t, int64(7), count, "Dry run should not delete items")
+
+	var out bytes.Buffer
+	printPruneReport(&out, report, true)
+	assert.Contains(t, out.String(), "Would delete 3 items from feed 1")
+	assert.Contains(t, out.String(), "Would delete 4 items in total")
+
+	// Real run deletes items and their revisions permanently
+	report, err = pruneItems(db, now, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, report.Total)
+
+	var guids []string
+	db.Unscoped().Model(&Item{}).Order("feed_id, guid").Pluck("guid", &guids)
+	assert.Equal(t, []string{"r1", "r2", "new"}, guids, "Should keep the newest items within the max age")
+	db.Model(&ItemRevision{}).Count(&count)
+	assert.Equal(t, int64(0), count, "Should delete revisions of pruned items")
+}
+
+func TestPruneItems_PrunedItemsStayPruned(t *testing.T) {
+	fetcher, now := newTestFetcher(t)
+	var items strings.Builder
+	for i := 1; i <= 5; i++ {
+		published := now.AddDate(0, 0, -i).Format(time.RFC1123Z)
+		fmt.Fprintf(&items, `<item><title>Item %d</title><guid>%d</guid><pubDate>%s</pubDate></item>`, i, i, published)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<?xml version="1.0"?><rss version="2.0"><channel><title>Limited</title>` + items.String() + `</channel></rss>`))
+	}))
+	defer server.Close()
+
+	feed := Feed{URL: server.URL, KeepItems: 2}
+	fetcher.DB.Create(&feed)
+	result, err := fetcher.Fetch(context.Background(), &feed)
+	assert.NoError(t, err)
+	assert.Equal(t, 5, result.Created)
+
+	report, err := pruneItems(fetcher.DB, now, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, report.Total)
+
+	result, err = fetcher.Fetch(context.Background(), &feed)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, result.Created, "Should not store pruned items again")
+	var guids []string
+	fetcher.DB.Model(&Item{}).Order("guid").Pluck("guid", &guids)
+	assert.Equal(t, []string{"1", "2"}, guids)
+}
+
+func TestPruneItems_NoRules(t *testing.T) {
+	db := setupTestDB(t)
+
+	feed := Feed{URL: "https://example.com/feed.xml"}
+	db.Create(&feed)
+	old := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	db.Create(&Item{FeedID: feed.ID, GUID: "a", PublishedAt: &old})
+
+	report, err := pruneItems(db, time.Now(), false)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, report.Total, "Should keep everything when no retention rules are set")
+}
+
+func TestPruneItems_KeepsStarredAndAnnotatedItems(t *testing.T) {
+	db := setupTestDB(t)
+	t.Setenv("ITEM_MAX_AGE_DAYS", "30")
+	t.Setenv("ITEM_KEEP_PER_FEED", "1")
+
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	old := now.AddDate(0, 0, -60)
+	recent := now.AddDate(0, 0, -1)
+	older := now.AddDate(0, 0, -2)
+
+	feed := Feed{URL: "https://example.com/feed.xml"}
+	db.Create(&feed)
+	db.Create(&Item{FeedID: feed.ID, GUID: "expired", PublishedAt: &old})
+	db.Create(&Item{FeedID: feed.ID, GUID: "expired-starred", PublishedAt: &old, StarredAt: &now})
+	db.Create(&Item{FeedID: feed.ID, GUID: "expired-annotated", PublishedAt: &old, Note: "Read later"})
+	db.Create(&Item{FeedID: feed.ID, GUID: "newest", PublishedAt: &recent})
+	db.Create(&Item{FeedID: feed.ID, GUID: "over-limit", PublishedAt: &older})
+	db.Create(&Item{FeedID: feed.ID, GUID: "over-limit-starred", PublishedAt: &older, StarredAt: &now})
+
+	report, err := pruneItems(db, now, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, report.Total)
+
+	var guids []string
+	db.Unscoped().Model(&Item{}).Order("guid").Pluck("guid", &guids)
+	assert.Equal(t, []string{"expired-annotated", "expired-starred", "newest", "over-limit-starred"}, guids,
+		"Should never prune starred or annotated items")
+}
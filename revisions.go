@@ -0,0 +1,182 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"html"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/microcosm-cc/bluemonday"
+)
+
+// Diff operation kinds
+const (
+	DiffEqual  = "equal"
+	DiffInsert = "insert"
+	DiffDelete = "delete"
+)
+
+// maxDiffCells bounds the size of the LCS table (about 1 MB), which is built on every render of the
+// item page; larger changes are shown as the old text deleted and the new text inserted
+const maxDiffCells = 250000
+
+var (
+	diffTokenPattern = regexp.MustCompile(`\s+|[^\s]+`)
+	textPolicy       = bluemonday.StrictPolicy()
+)
+
+// DiffOp is a run of text that is unchanged, inserted or deleted between two versions
+type DiffOp struct {
+	Kind string
+	Text string
+}
+
+// RevisionDiff describes what changed when an item revision was replaced by the next version
+// Fields that did not change are left empty
+type RevisionDiff struct {
+	ReplacedAt  time.Time
+	Title       []DiffOp
+	Link        []DiffOp
+	Author      []DiffOp
+	Description []DiffOp
+	Content     []DiffOp
+}
+
+// itemContentHash returns the SHA-256 hex digest of the fields tracked for revisions
+func itemContentHash(title, link, description, content, author string) string {
+	sum := sha256.Sum256([]byte(strings.Join([]string{title, link, description, content, author}, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+// computeContentHash returns the content hash of the item's current fields
+func (item *Item) computeContentHash() string {
+	return itemContentHash(item.Title, item.Link, item.Description, item.Content, item.Author)
+}
+
+// revisionOf returns an ItemRevision holding the item's current version, replaced at replacedAt
+func revisionOf(item *Item, replacedAt time.Time) ItemRevision {
+	hash := item.ContentHash
+	if hash == "" {
+		hash = item.computeContentHash()
+	}
+	return ItemRevision{
+		ItemID:      item.ID,
+		Title:       item.Title,
+		Link:        item.Link,
+		Description: item.Description,
+		Content:     item.Content,
+		Author:      item.Author,
+		ContentHash: hash,
+		ReplacedAt:  replacedAt,
+	}
+}
+
+// buildRevisionDiffs compares each revision with the version that replaced it, newest first
+// revisions must be ordered oldest first
+func buildRevisionDiffs(item *Item, revisions []ItemRevision) []RevisionDiff {
+	diffs := make([]RevisionDiff, 0, len(revisions))
+	newer := revisionOf(item, time.Time{})
+	for i := len(revisions) - 1; i >= 0; i-- {
+		older := revisions[i]
+		diffs = append(diffs, RevisionDiff{
+			ReplacedAt:  older.ReplacedAt,
+			Title:       diffIfChanged(older.Title, newer.Title),
+			Link:        diffIfChanged(older.Link, newer.Link),
+			Author:      diffIfChanged(older.Author, newer.Author),
+			Description: diffIfChanged(htmlToText(older.Description), htmlToText(newer.Description)),
+			Content:     diffIfChanged(htmlToText(older.Content), htmlToText(newer.Content)),
+		})
+		newer = older
+	}
+	return diffs
+}
+
+// diffIfChanged returns the word diff of two strings, or nil if they are equal
+func diffIfChanged(oldText, newText string) []DiffOp {
+	if oldText == newText {
+		return nil
+	}
+	return diffWords(oldText, newText)
+}
+
+// htmlToText strips tags from sanitized HTML so revisions are compared as readable text
+func htmlToText(s string) string {
+	return strings.TrimSpace(html.UnescapeString(textPolicy.Sanitize(s)))
+}
+
+// diffWords computes a word-level diff between oldText and newText using the longest common subsequence
+func diffWords(oldText, newText string) []DiffOp {
+	a := diffTokenPattern.FindAllString(oldText, -1)
+	b := diffTokenPattern.FindAllString(newText, -1)
+
+	// Trim the common prefix and suffix to keep the LCS table small
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var ops []DiffOp
+	ops = appendDiffOp(ops, DiffEqual, strings.Join(a[:prefix], ""))
+
+	midA := a[prefix : len(a)-suffix]
+	midB := b[prefix : len(b)-suffix]
+	if (len(midA)+1)*(len(midB)+1) > maxDiffCells {
+		ops = appendDiffOp(ops, DiffDelete, strings.Join(midA, ""))
+		ops = appendDiffOp(ops, DiffInsert, strings.Join(midB, ""))
+	} else {
+		// lcs[i][j] is the LCS length of midA[i:] and midB[j:]
+		lcs := make([][]int32, len(midA)+1)
+		for i := range lcs {
+			lcs[i] = make([]int32, len(midB)+1)
+		}
+		for i := len(midA) - 1; i >= 0; i-- {
+			for j := len(midB) - 1; j >= 0; j-- {
+				if midA[i] == midB[j] {
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				} else if lcs[i+1][j] >= lcs[i][j+1] {
+					lcs[i][j] = lcs[i+1][j]
+				} else {
+					lcs[i][j] = lcs[i][j+1]
+				}
+			}
+		}
+
+		i, j := 0, 0
+		for i < len(midA) && j < len(midB) {
+			switch {
+			case midA[i] == midB[j]:
+				ops = appendDiffOp(ops, DiffEqual, midA[i])
+				i++
+				j++
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				ops = appendDiffOp(ops, DiffDelete, midA[i])
+				i++
+			default:
+				ops = appendDiffOp(ops, DiffInsert, midB[j])
+				j++
+			}
+		}
+		ops = appendDiffOp(ops, DiffDelete, strings.Join(midA[i:], ""))
+		ops = appendDiffOp(ops, DiffInsert, strings.Join(midB[j:], ""))
+	}
+
+	return appendDiffOp(ops, DiffEqual, strings.Join(a[len(a)-suffix:], ""))
+}
+
+// appendDiffOp appends text to ops, merging it into the last op when the kinds match
+func appendDiffOp(ops []DiffOp, kind, text string) []DiffOp {
+	if text == "" {
+		return ops
+	}
+	if n := len(ops); n > 0 && ops[n-1].Kind == kind {
+		ops[n-1].Text += text
+		return ops
+	}
+	return append(ops, DiffOp{Kind: kind, Text: text})
+}
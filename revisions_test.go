@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffWords(t *testing.T) {
+	tests := []struct {
+		name     string
+		old      string
+		new      string
+		expected []DiffOp
+	}{
+		{
+			name: "word replaced",
+			old:  "Minister resigns over scandal",
+			new:  "Minister denies scandal",
+			expected: []DiffOp{
+				{Kind: DiffEqual, Text: "Minister "},
+				{Kind: DiffDelete, Text: "resigns over"},
+				{Kind: DiffInsert, Text: "denies"},
+				{Kind: DiffEqual, Text: " scandal"},
+			},
+		},
+		{
+			name: "words appended",
+			old:  "Breaking news",
+			new:  "Breaking news: update",
+			expected: []DiffOp{
+				{Kind: DiffEqual, Text: "Breaking "},
+				{Kind: DiffDelete, Text: "news"},
+				{Kind: DiffInsert, Text: "news: update"},
+			},
+		},
+		{
+			name:     "from empty",
+			old:      "",
+			new:      "Hello",
+			expected: []DiffOp{{Kind: DiffInsert, Text: "Hello"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, diffWords(tt.old, tt.new))
+		})
+	}
+}
+
+func TestDiffWords_OverCap(t *testing.T) {
+	var oldWords, newWords []string
+	for i := 0; i < 600; i++ {
+		oldWords = append(oldWords, fmt.Sprintf("old%d", i))
+		newWords = append(newWords, fmt.Sprintf("new%d", i))
+	}
+	oldText := "Intro " + strings.Join(oldWords, " ") + " outro"
+	newText := "Intro " + strings.Join(newWords, " ") + " outro"
+
+	assert.Equal(t, []DiffOp{
+		{Kind: DiffEqual, Text: "Intro "},
+		{Kind: DiffDelete, Text: strings.Join(oldWords, " ")},
+		{Kind: DiffInsert, Text: strings.Join(newWords, " ")},
+		{Kind: DiffEqual, Text: " outro"},
+	}, diffWords(oldText, newText), "Changes beyond maxDiffCells should be shown as a replacement")
+}
+
+func TestBuildRevisionDiffs(t *testing.T) {
+	item := Item{Title: "Third title", Content: "<p>Same body</p>"}
+	first := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	second := first.Add(time.Hour)
+	revisions := []ItemRevision{
+		{Title: "First title", Content: "<p>Same body</p>", ReplacedAt: first},
+		{Title: "Second title", Content: "<p>Same body</p>", ReplacedAt: second},
+	}
+
+	diffs := buildRevisionDiffs(&item, revisions)
+	assert.Equal(t, 2, len(diffs))
+	assert.True(t, second.Equal(diffs[0].ReplacedAt), "Should list the newest revision first")
+	assert.Equal(t, []DiffOp{
+		{Kind: DiffDelete, Text: "Second"},
+		{Kind: DiffInsert, Text: "Third"},
+		{Kind: DiffEqual, Text: " title"},
+	}, diffs[0].Title, "Should diff against the version that replaced it")
+	assert.Equal(t, "First", diffs[1].Title[0].Text)
+	assert.Nil(t, diffs[0].Content, "Should leave unchanged fields empty")
+}
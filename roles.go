@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// processRole selects which parts of the application a process runs, so fetching
+// can be scaled independently of the web UI
+type processRole string
+
+const (
+	roleWeb    processRole = "web"    // Web server only (serve command)
+	roleWorker processRole = "worker" // Background fetcher and scheduled jobs only (worker command)
+	roleAll    processRole = "all"    // Both in one process (all command, the default)
+)
+
+// runsWeb reports whether the role serves the web application
+func (r processRole) runsWeb() bool {
+	return r != roleWorker
+}
+
+// runsFetcher reports whether the role runs the background fetcher
+// Worker processes always do; the all role only while BACKGROUND_FETCH_ENABLED is on
+func (r processRole) runsFetcher() bool {
+	return r == roleWorker || (r == roleAll && GetBackgroundFetchEnabled())
+}
+
+// currentRole is the role of this process, set by runProcess
+var currentRole = roleAll
+
+// processContext is cancelled on SIGINT/SIGTERM, after which no new fetch is started, and fetchWorkContext
+// at the shutdown deadline, which aborts the fetches in flight; both are set by runProcess
+var (
+	processContext   = context.Background()
+	fetchWorkContext = context.Background()
+)
+
+// fetcherHeartbeat holds the Unix time of the background fetcher's last sign of progress
+var fetcherHeartbeat atomic.Int64
+
+// beatFetcherHeartbeat records that the background fetcher is making progress
+func beatFetcherHeartbeat() {
+	fetcherHeartbeat.Store(time.Now().Unix())
+}
+
+// fetcherStaleAfter is how long the background fetcher may go without a heartbeat before it is reported unhealthy:
+// two scheduler ticks plus a job lease, which bounds how long a batch of fetches is expected to take
+func fetcherStaleAfter() time.Duration {
+	return time.Duration(2*GetSchedulerTick()+GetFetchJobLease()) * time.Second
+}
+
+// runProcess connects to the database and runs the parts of the application selected by role
+// until SIGINT/SIGTERM, then shuts down gracefully. Processes without the web server serve
+// /healthz on WORKER_HEALTH_ADDR instead
+func runProcess(role processRole) {
+	if role.runsWeb() {
+		showStartupInfo()
+	}
+	log.Printf("Starting process with role %s", role)
+	currentRole = role
+
+	ConnectDatabase()
+
+	// ctx is cancelled on SIGINT/SIGTERM and stops the server and scheduler loop.
+	// workCtx is cancelled only when the shutdown deadline passes and aborts in-flight fetches
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	workCtx, cancelWork := context.WithCancel(context.Background())
+	defer cancelWork()
+	processContext, fetchWorkContext = ctx, workCtx
+
+	// Start background feed fetcher if the role runs it
+	fetcherDone := make(chan struct{})
+	if role.runsFetcher() {
+		go func() {
+			defer close(fetcherDone)
+			startBackgroundFeedFetcher(ctx, workCtx)
+		}()
+	} else {
+		close(fetcherDone)
+		log.Println("Background feed fetcher is disabled in this process")
+	}
+
+	srv := &http.Server{
+		Addr: ":8082",
+		// Manual fetches wait for their jobs in request handlers, so their contexts derive from workCtx as well
+		BaseContext: func(net.Listener) context.Context { return workCtx },
+	}
+	if role.runsWeb() {
+		srv.Handler = setupRouter(role)
+	} else {
+		srv.Addr = GetWorkerHealthAddr()
+		srv.Handler = setupHealthRouter(role)
+	}
+	go func() {
+		log.Printf("Listening on %s", srv.Addr)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Failed to start server: %v", err)
+		}
+	}()
+
+	<-ctx.Done()
+	stop()
+	shutdownServer(srv, fetcherDone, cancelWork)
+}
+
+// setupHealthRouter creates the router of processes without the web server: only /healthz
+func setupHealthRouter(role processRole) *gin.Engine {
+	r := gin.New()
+	r.Use(gin.Recovery())
+	r.GET("/healthz", healthCheck(role))
+	return r
+}
+
+// healthCheck responds with 200 if the process can do its work, 503 otherwise
+func healthCheck(role processRole) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		status, body := healthStatus(c.Request.Context(), role, time.Now())
+		c.JSON(status, body)
+	}
+}
+
+// healthStatus checks that the database is reachable and, in processes running the background
+// fetcher, that it made progress within fetcherStaleAfter
+func healthStatus(ctx context.Context, role processRole, now time.Time) (int, gin.H) {
+	status := http.StatusOK
+	body := gin.H{"status": "ok", "role": string(role)}
+
+	database := "ok"
+	sqlDB, err := DB.DB()
+	if err == nil {
+		pingCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+		err = sqlDB.PingContext(pingCtx)
+		cancel()
+	}
+	if err != nil {
+		database = err.Error()
+		status = http.StatusServiceUnavailable
+	}
+	body["database"] = database
+
+	if role.runsFetcher() {
+		fetcher := "ok"
+		last := fetcherHeartbeat.Load()
+		switch {
+		case last == 0:
+			fetcher = "starting"
+		case now.Sub(time.Unix(last, 0)) > fetcherStaleAfter():
+			fetcher = "stalled"
+			status = http.StatusServiceUnavailable
+		}
+		body["fetcher"] = fetcher
+		if last != 0 {
+			body["fetcher_heartbeat"] = time.Unix(last, 0).UTC().Format(time.RFC3339)
+		}
+	}
+
+	if status != http.StatusOK {
+		body["status"] = "unavailable"
+	}
+	return status, body
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProcessRole(t *testing.T) {
+	os.Setenv("BACKGROUND_FETCH_ENABLED", "false")
+	defer os.Unsetenv("BACKGROUND_FETCH_ENABLED")
+
+	assert.True(t, roleWeb.runsWeb())
+	assert.False(t, roleWeb.runsFetcher())
+	assert.False(t, roleWorker.runsWeb())
+	assert.True(t, roleWorker.runsFetcher(), "Worker processes should fetch regardless of BACKGROUND_FETCH_ENABLED")
+	assert.True(t, roleAll.runsWeb())
+	assert.False(t, roleAll.runsFetcher())
+
+	os.Setenv("BACKGROUND_FETCH_ENABLED", "true")
+	assert.True(t, roleAll.runsFetcher())
+}
+
+func TestHealthStatus(t *testing.T) {
+	DB = setupTestDB(t)
+	defer fetcherHeartbeat.Store(0)
+	now := time.Now()
+
+	status, body := healthStatus(context.Background(), roleWeb, now)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "web", body["role"])
+	assert.Equal(t, "ok", body["database"])
+	assert.NotContains(t, body, "fetcher", "Should not report a fetcher the process doesn't run")
+
+	fetcherHeartbeat.Store(0)
+	status, body = healthStatus(context.Background(), roleWorker, now)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "starting", body["fetcher"])
+
+	fetcherHeartbeat.Store(now.Add(-time.Minute).Unix())
+	status, body = healthStatus(context.Background(), roleWorker, now)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "ok", body["fetcher"])
+
+	fetcherHeartbeat.Store(now.Add(-fetcherStaleAfter() - time.Minute).Unix())
+	status, body = healthStatus(context.Background(), roleWorker, now)
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Equal(t, "stalled", body["fetcher"])
+	assert.Equal(t, "unavailable", body["status"])
+
+	sqlDB, _ := DB.DB()
+	sqlDB.Close()
+	status, body = healthStatus(context.Background(), roleWeb, now)
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.NotEqual(t, "ok", body["database"])
+}
+
+func TestSetupHealthRouter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	DB = setupTestDB(t)
+	fetcherHeartbeat.Store(time.Now().Unix())
+	defer fetcherHeartbeat.Store(0)
+
+	w := httptest.NewRecorder()
+	setupHealthRouter(roleWorker).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"role":"worker"`)
+
+	w = httptest.NewRecorder()
+	setupHealthRouter(roleWorker).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/feeds", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code, "Worker processes should not serve the web application")
+}
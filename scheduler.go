@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// effectiveFetchInterval returns the feed's fetch interval in seconds,
+// falling back to the global BACKGROUND_FETCH_INTERVAL for feeds that have none yet
+func effectiveFetchInterval(feed *Feed) int {
+	if feed.FetchInterval > 0 {
+		return feed.FetchInterval
+	}
+	return GetBackgroundFetchInterval()
+}
+
+// nextFetchInterval calculates the interval (in seconds) to use after a successful fetch
+// Fixed intervals are kept as is. Adaptive intervals are halved when the fetch produced
+// new items and widened by half when it did not, within [minInterval, maxInterval]
+func nextFetchInterval(feed *Feed, newItems int, adaptive bool, minInterval, maxInterval int) int {
+	interval := effectiveFetchInterval(feed)
+	if feed.FetchIntervalFixed || !adaptive {
+		return interval
+	}
+
+	if newItems > 0 {
+		interval /= 2
+	} else {
+		interval += interval / 2
+	}
+
+	if interval < minInterval {
+		interval = minInterval
+	}
+	if interval > maxInterval {
+		interval = maxInterval
+	}
+	return interval
+}
+
+// scheduleNextFetch updates FetchInterval and NextFetchAt after a successful fetch at now
+// The caller is responsible for saving the feed
+func scheduleNextFetch(feed *Feed, newItems int, now time.Time) {
+	minInterval, maxInterval := GetFetchIntervalBounds()
+	feed.FetchInterval = nextFetchInterval(feed, newItems, GetAdaptiveFetchEnabled(), minInterval, maxInterval)
+	next := now.Add(time.Duration(feed.FetchInterval) * time.Second)
+	feed.NextFetchAt = &next
+}
+
+// retryDelay calculates the exponential backoff (in seconds) after consecutive failures:
+// the fetch interval doubled for every failure after the first, capped at maxBackoff
+func retryDelay(interval, failures, maxBackoff int) int {
+	delay := interval
+	for i := 1; i < failures && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxBackoff {
+		delay = maxBackoff
+	}
+	return delay
+}
+
+// scheduleRetry sets NextFetchAt after a failed fetch at now using exponential backoff
+// The caller is responsible for incrementing ConsecutiveFailures and saving the feed
+func scheduleRetry(feed *Feed, now time.Time) {
+	delay := retryDelay(effectiveFetchInterval(feed), feed.ConsecutiveFailures, GetMaxBackoff())
+	next := now.Add(time.Duration(delay) * time.Second)
+	feed.NextFetchAt = &next
+}
+
+// getDueFeeds returns active feeds that have never been scheduled or whose NextFetchAt has passed
+// Feeds with a valid WebSub lease are skipped: their hub pushes updates until the lease lapses
+// Test feeds (with /test_feeds/ in their URL) are only fetched manually
+func getDueFeeds(now time.Time) []Feed {
+	var feeds []Feed
+	pushed := DB.Model(&WebSubSubscription{}).Select("feed_id").Where("expires_at > ?", now)
+	DB.Where("paused_at IS NULL").
+		Where("url NOT LIKE ?", "%/test_feeds/%").
+		Where("next_fetch_at IS NULL OR next_fetch_at <= ?", now).
+		Where("id NOT IN (?)", pushed).
+		Order("next_fetch_at").
+		Find(&feeds)
+	return feeds
+}
+
+// processDueFeeds enqueues fetch jobs for the feeds that are due and runs queued jobs with worker
+// until none are available, returns statistics of the jobs this worker ran
+// With several replicas each one enqueues and drains; the queue hands every job to a single worker
+func processDueFeeds(ctx, workCtx context.Context, worker *FetchWorker) (itemsCreated, itemsUpdated, errors int) {
+	now := time.Now()
+	for _, feed := range getDueFeeds(now) {
+		if _, err := EnqueueFetchJob(DB, feed.ID, FetchJobPriorityScheduled, now); err != nil {
+			log.Printf("Error enqueuing fetch of feed %s: %v", feed.URL, err)
+		}
+	}
+
+	itemsCreated, itemsUpdated, errors = worker.Drain(ctx, workCtx)
+	if itemsCreated > 0 || itemsUpdated > 0 || errors > 0 {
+		log.Printf("Background feed fetch completed: %d created, %d updated, %d errors", itemsCreated, itemsUpdated, errors)
+	}
+	return itemsCreated, itemsUpdated, errors
+}
+
+// pruneFetchAttempts deletes fetch attempts that started more than FETCH_ATTEMPT_RETENTION_DAYS before now
+func pruneFetchAttempts(db *gorm.DB, now time.Time) (int64, error) {
+	cutoff := now.AddDate(0, 0, -GetFetchAttemptRetentionDays())
+	result := db.Where("started_at < ?", cutoff).Delete(&FetchAttempt{})
+	return result.RowsAffected, result.Error
+}
+
+// runFetchAttemptPruning prunes old fetch attempts and logs the outcome
+func runFetchAttemptPruning() {
+	deleted, err := pruneFetchAttempts(DB, time.Now())
+	if err != nil {
+		log.Printf("Error pruning fetch attempts: %v", err)
+		return
+	}
+	if deleted > 0 {
+		log.Printf("Pruned %d fetch attempts older than %d days", deleted, GetFetchAttemptRetentionDays())
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNextFetchInterval(t *testing.T) {
+	tests := []struct {
+		name        string
+		feed        Feed
+		newItems    int
+		adaptive    bool
+		expected    int
+		description string
+	}{
+		{
+			name:        "new items narrow interval",
+			feed:        Feed{FetchInterval: 3600},
+			newItems:    3,
+			adaptive:    true,
+			expected:    1800,
+			description: "Should halve the interval when new items appeared",
+		},
+		{
+			name:        "no new items widen interval",
+			feed:        Feed{FetchInterval: 3600},
+			newItems:    0,
+			adaptive:    true,
+			expected:    5400,
+			description: "Should widen the interval by half when nothing new appeared",
+		},
+		{
+			name:        "clamped to minimum",
+			feed:        Feed{FetchInterval: 400},
+			newItems:    1,
+			adaptive:    true,
+			expected:    300,
+			description: "Should not go below the minimum interval",
+		},
+		{
+			name:        "clamped to maximum",
+			feed:        Feed{FetchInterval: 80000},
+			newItems:    0,
+			adaptive:    true,
+			expected:    86400,
+			description: "Should not go above the maximum interval",
+		},
+		{
+			name:        "fixed interval unchanged",
+			feed:        Feed{FetchInterval: 600, FetchIntervalFixed: true},
+			newItems:    5,
+			adaptive:    true,
+			expected:    600,
+			description: "Should keep an admin override as is",
+		},
+		{
+			name:        "adaptive disabled",
+			feed:        Feed{FetchInterval: 3600},
+			newItems:    5,
+			adaptive:    false,
+			expected:    3600,
+			description: "Should keep the interval when adaptive scheduling is disabled",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := nextFetchInterval(&tt.feed, tt.newItems, tt.adaptive, 300, 86400)
+			assert.Equal(t, tt.expected, result, tt.description)
+		})
+	}
+}
+
+func TestGetDueFeeds(t *testing.T) {
+	db := setupTestDB(t)
+	DB = db
+
+	now := time.Now()
+	past := now.Add(-time.Minute)
+	future := now.Add(time.Hour)
+
+	db.Create(&Feed{URL: "https://example.com/never.xml"})
+	db.Create(&Feed{URL: "https://example.com/due.xml", NextFetchAt: &past})
+	db.Create(&Feed{URL: "https://example.com/later.xml", NextFetchAt: &future})
+	db.Create(&Feed{URL: "http://localhost:8082/test_feeds/feed.xml", NextFetchAt: &past})
+
+	feeds := getDueFeeds(now)
+
+	var urls []string
+	for _, feed := range feeds {
+		urls = append(urls, feed.URL)
+	}
+	assert.ElementsMatch(t, []string{"https://example.com/never.xml", "https://example.com/due.xml"}, urls,
+		"Should return unscheduled and overdue feeds only, without test feeds")
+}
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		name     string
+		failures int
+		expected int
+	}{
+		{name: "first failure", failures: 1, expected: 600},
+		{name: "second failure", failures: 2, expected: 1200},
+		{name: "fourth failure", failures: 4, expected: 4800},
+		{name: "capped", failures: 20, expected: 86400},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, retryDelay(600, tt.failures, 86400))
+		})
+	}
+}
+
+func TestFeedFetcher_MarkFailedPausesAfterThreshold(t *testing.T) {
+	db := setupTestDB(t)
+	DB = db
+	t.Setenv("FETCH_FAILURE_PAUSE_THRESHOLD", "3")
+
+	feed := Feed{URL: "https://example.com/broken.xml"}
+	db.Create(&feed)
+
+	fetcher := NewFeedFetcher(db)
+	fetchErr := errors.New("http error: 404 Not Found")
+	fetcher.markFailed(&feed, fetchErr)
+	fetcher.markFailed(&feed, fetchErr)
+	assert.Nil(t, feed.PausedAt, "Should not pause before the threshold")
+	assert.Equal(t, "failing", feed.Status())
+
+	fetcher.markFailed(&feed, fetchErr)
+
+	var reloaded Feed
+	db.First(&reloaded, feed.ID)
+	assert.Equal(t, 3, reloaded.ConsecutiveFailures, "Should count consecutive failures")
+	assert.NotNil(t, reloaded.PausedAt, "Should pause once the threshold is reached")
+	assert.Equal(t, "paused", reloaded.Status())
+	assert.Empty(t, getDueFeeds(time.Now().Add(365*24*time.Hour)), "Paused feeds should never be due")
+}
+
+func TestPruneFetchAttempts(t *testing.T) {
+	db := setupTestDB(t)
+	t.Setenv("FETCH_ATTEMPT_RETENTION_DAYS", "7")
+
+	feed := Feed{URL: "https://example.com/feed.xml"}
+	db.Create(&feed)
+
+	now := time.Date(2024, 1, 31, 12, 0, 0, 0, time.UTC)
+	db.Create(&FetchAttempt{FeedID: feed.ID, Status: FetchStatusSuccess, StartedAt: now.AddDate(0, 0, -10)})
+	db.Create(&FetchAttempt{FeedID: feed.ID, Status: FetchStatusSuccess, StartedAt: now.AddDate(0, 0, -1)})
+
+	deleted, err := pruneFetchAttempts(db, now)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), deleted, "Should delete attempts older than the retention period")
+
+	var remaining int64
+	db.Model(&FetchAttempt{}).Count(&remaining)
+	assert.Equal(t, int64(1), remaining, "Should keep recent attempts")
+}
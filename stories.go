@@ -0,0 +1,215 @@
+package main
+
+import (
+	"hash/fnv"
+	"math/bits"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/PuerkitoBio/goquery"
+	"gorm.io/gorm"
+)
+
+// storyClusterWindow is how far back items are compared when looking for other copies of a story
+const storyClusterWindow = 72 * time.Hour
+
+// maxClusterCandidates caps how many recent items of other feeds new items are compared with;
+// the newest are compared first
+const maxClusterCandidates = 5000
+
+// minFingerprintWords is the least distinct words an item needs to get a fingerprint;
+// shorter texts are too alike to tell stories apart
+const minFingerprintWords = 8
+
+// fingerprintStopWords are left out of fingerprints, since they appear in every story
+var fingerprintStopWords = map[string]bool{
+	"the": true, "and": true, "for": true, "are": true, "but": true, "not": true, "you": true,
+	"all": true, "any": true, "can": true, "had": true, "her": true, "was": true, "one": true,
+	"our": true, "out": true, "has": true, "have": true, "his": true, "how": true, "its": true,
+	"who": true, "did": true, "get": true, "may": true, "new": true, "now": true, "say": true,
+	"says": true, "said": true, "she": true, "they": true, "them": true, "their": true,
+	"this": true, "that": true, "these": true, "those": true, "with": true, "from": true,
+	"will": true, "would": true, "could": true, "should": true, "been": true, "were": true,
+	"what": true, "when": true, "where": true, "which": true, "while": true, "into": true,
+	"about": true, "after": true, "before": true, "over": true, "than": true, "then": true,
+	"there": true, "also": true, "more": true, "most": true, "some": true, "such": true,
+	"only": true, "other": true, "very": true, "just": true, "your": true, "read": true,
+}
+
+// storyFingerprint returns a 64-bit SimHash of an item's title and text: every distinct word
+// (title words count double) votes on each bit through its FNV-1a hash, so items sharing most
+// of their words get fingerprints that differ in few bits. Returns 0 for items with too little text
+func storyFingerprint(title, content string) int64 {
+	weights := map[string]int{}
+	for _, word := range fingerprintWords(content) {
+		weights[word] = 1
+	}
+	for _, word := range fingerprintWords(title) {
+		weights[word] = 2
+	}
+	if len(weights) < minFingerprintWords {
+		return 0
+	}
+
+	var votes [64]int
+	for word, weight := range weights {
+		h := fnv.New64a()
+		h.Write([]byte(word))
+		sum := h.Sum64()
+		for bit := 0; bit < 64; bit++ {
+			if sum&(1<<bit) != 0 {
+				votes[bit] += weight
+			} else {
+				votes[bit] -= weight
+			}
+		}
+	}
+	var fingerprint uint64
+	for bit, vote := range votes {
+		if vote > 0 {
+			fingerprint |= 1 << bit
+		}
+	}
+	return int64(fingerprint)
+}
+
+// fingerprintWords returns the lower-cased words of a text (HTML is reduced to its text),
+// without short words and stop words
+func fingerprintWords(text string) []string {
+	if strings.Contains(text, "<") {
+		if doc, err := goquery.NewDocumentFromReader(strings.NewReader(text)); err == nil {
+			text = doc.Text()
+		}
+	}
+	var words []string
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if len([]rune(word)) >= 3 && !fingerprintStopWords[word] {
+			words = append(words, word)
+		}
+	}
+	return words
+}
+
+// fingerprintDistance returns the number of bits two fingerprints differ in
+func fingerprintDistance(a, b int64) int {
+	return bits.OnesCount64(uint64(a ^ b))
+}
+
+// clusterItems puts the given items of a feed, if they are not in a story cluster yet, into the
+// cluster of the closest item from another feed seen within storyClusterWindow, starting a new
+// cluster when that item has none. Items match when their fingerprints differ in at most
+// STORY_CLUSTER_DISTANCE bits; 0 disables clustering
+func clusterItems(tx *gorm.DB, feedID uint, rows []Item, now time.Time) error {
+	maxDistance := GetStoryClusterDistance()
+	if maxDistance == 0 || len(rows) == 0 {
+		return nil
+	}
+	_, ids, err := storedItemIDs(tx, feedID, rows)
+	if err != nil || len(ids) == 0 {
+		return err
+	}
+	var unclustered []Item
+	if err := tx.Select("id", "title", "fingerprint").
+		Where("id IN ? AND cluster_id IS NULL AND fingerprint <> 0", ids).Find(&unclustered).Error; err != nil {
+		return err
+	}
+	if len(unclustered) == 0 {
+		return nil
+	}
+
+	// Served by idx_items_fingerprinted_created_at, see createStoryClusterIndex
+	var candidates []Item
+	err = tx.Select("id", "feed_id", "fingerprint", "cluster_id").
+		Where("fingerprint <> 0 AND created_at >= ? AND feed_id <> ?", now.Add(-storyClusterWindow), feedID).
+		Order("created_at DESC").Limit(maxClusterCandidates).
+		Find(&candidates).Error
+	if err != nil || len(candidates) == 0 {
+		return err
+	}
+
+	touched := map[uint]bool{}
+	for _, item := range unclustered {
+		closest, closestDistance := -1, maxDistance+1
+		for i, candidate := range candidates {
+			if distance := fingerprintDistance(item.Fingerprint, candidate.Fingerprint); distance < closestDistance {
+				closest, closestDistance = i, distance
+			}
+		}
+		if closest < 0 {
+			continue
+		}
+
+		match := &candidates[closest]
+		if match.ClusterID == nil {
+			cluster := StoryCluster{Title: item.Title, LastSeenAt: now}
+			if err := tx.Create(&cluster).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&Item{}).Where("id = ?", match.ID).UpdateColumn("cluster_id", cluster.ID).Error; err != nil {
+				return err
+			}
+			match.ClusterID = &cluster.ID
+		}
+		if err := tx.Model(&Item{}).Where("id = ?", item.ID).UpdateColumn("cluster_id", *match.ClusterID).Error; err != nil {
+			return err
+		}
+		touched[*match.ClusterID] = true
+	}
+
+	clusterIDs := make([]uint, 0, len(touched))
+	for id := range touched {
+		clusterIDs = append(clusterIDs, id)
+	}
+	if len(clusterIDs) == 0 {
+		return nil
+	}
+	if err := tx.Model(&StoryCluster{}).Where("id IN ?", clusterIDs).Update("last_seen_at", now).Error; err != nil {
+		return err
+	}
+	return refreshStoryClusters(tx, clusterIDs)
+}
+
+// refreshStoryClusters recounts the items and distinct feeds of story clusters
+func refreshStoryClusters(tx *gorm.DB, clusterIDs []uint) error {
+	if len(clusterIDs) == 0 {
+		return nil
+	}
+	return tx.Model(&StoryCluster{}).Where("id IN ?", clusterIDs).Updates(map[string]interface{}{
+		"item_count":   gorm.Expr("(SELECT COUNT(*) FROM items WHERE items.cluster_id = story_clusters.id AND items.deleted_at IS NULL)"),
+		"source_count": gorm.Expr("(SELECT COUNT(DISTINCT items.feed_id) FROM items WHERE items.cluster_id = story_clusters.id AND items.deleted_at IS NULL)"),
+	}).Error
+}
+
+// createStoryClusterIndex creates the partial index clusterItems looks up recent fingerprinted items with
+// gorm.Model's CreatedAt can't carry an index tag, so it is created here
+func createStoryClusterIndex(db *gorm.DB) error {
+	return db.Exec("CREATE INDEX IF NOT EXISTS idx_items_fingerprinted_created_at ON items (created_at) WHERE fingerprint <> 0").Error
+}
+
+// deleteFeeds permanently deletes feeds, their items through the foreign key cascade, and
+// recounts the story clusters those items belonged to
+func deleteFeeds(db *gorm.DB, feedIDs []uint) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var clusterIDs []uint
+		err := tx.Unscoped().Model(&Item{}).Where("feed_id IN ? AND cluster_id IS NOT NULL", feedIDs).
+			Distinct("cluster_id").Pluck("cluster_id", &clusterIDs).Error
+		if err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("id IN ?", feedIDs).Delete(&Feed{}).Error; err != nil {
+			return err
+		}
+		return refreshStoryClusters(tx, clusterIDs)
+	})
+}
+
+// clusterIDsOf returns the distinct story clusters the given items belong to
+func clusterIDsOf(tx *gorm.DB, itemIDs []uint) ([]uint, error) {
+	var clusterIDs []uint
+	err := tx.Unscoped().Model(&Item{}).Where("id IN ? AND cluster_id IS NOT NULL", itemIDs).
+		Distinct("cluster_id").Pluck("cluster_id", &clusterIDs).Error
+	return clusterIDs, err
+}
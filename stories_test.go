@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testWireStory    = `<p>Central bank raises interest rates by half a point to curb inflation, surprising markets. The governor warned that further increases remain possible if prices keep rising through the winter months, while unions criticised the decision.</p>`
+	testRewriteStory = `<p>Central bank raises interest rates by half a point to curb inflation, surprising markets. The governor warned that further increases remain possible if prices keep rising through the winter months.</p>`
+	testOtherStory   = `<p>Local football club wins championship final after dramatic penalty shootout, fans celebrate late into the night across the city centre and the mayor announces a parade.</p>`
+)
+
+func TestStoryFingerprint(t *testing.T) {
+	wire := storyFingerprint("Central bank raises rates", testWireStory)
+	rewrite := storyFingerprint("Central bank raises interest rates", testRewriteStory)
+	other := storyFingerprint("Club wins championship", testOtherStory)
+
+	assert.NotZero(t, wire)
+	assert.LessOrEqual(t, fingerprintDistance(wire, rewrite), 6, "Rewrites of a story should have close fingerprints")
+	assert.Greater(t, fingerprintDistance(wire, other), 6, "Different stories should have distant fingerprints")
+	assert.Equal(t, wire, storyFingerprint("Central bank raises rates", testWireStory), "Fingerprints should be deterministic")
+	assert.Zero(t, storyFingerprint("Short", "<p>Too little text here.</p>"))
+}
+
+func TestFeedFetcher_ClustersStoriesAcrossFeeds(t *testing.T) {
+	fetcher, _ := newTestFetcher(t)
+	db := fetcher.DB
+	stories := map[string]string{
+		"/wire": `<item><title>Central bank raises rates</title><guid>rates</guid><description><![CDATA[` + testWireStory + `]]></description></item>
+<item><title>Club wins championship</title><guid>club</guid><description><![CDATA[` + testOtherStory + `]]></description></item>`,
+		"/paper": `<item><title>Central bank raises interest rates</title><guid>rates</guid><description><![CDATA[` + testRewriteStory + `]]></description></item>`,
+		"/blog": `<item><title>Central bank raises rates</title><guid>rates-copy</guid><description><![CDATA[` + testWireStory + `]]></description></item>
+<item><title>Rates again</title><guid>rates-again</guid><description><![CDATA[` + testWireStory + `]]></description></item>`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/rss+xml")
+		w.Write([]byte(`<?xml version="1.0"?><rss version="2.0"><channel><title>` + r.URL.Path + `</title>` + stories[r.URL.Path] + `</channel></rss>`))
+	}))
+	defer server.Close()
+
+	for _, path := range []string{"/wire", "/paper", "/blog"} {
+		feed := Feed{URL: server.URL + path}
+		db.Create(&feed)
+		_, err := fetcher.Fetch(context.Background(), &feed)
+		assert.NoError(t, err)
+	}
+
+	var clusters []StoryCluster
+	db.Preload("Items").Find(&clusters)
+	if !assert.Len(t, clusters, 1, "Copies of the story should share one cluster") {
+		return
+	}
+	cluster := clusters[0]
+	assert.Equal(t, 4, cluster.ItemCount)
+	assert.Equal(t, 3, cluster.SourceCount)
+	assert.Equal(t, "Central bank raises interest rates", cluster.Title)
+
+	var club Item
+	db.Where("guid = ?", "club").First(&club)
+	assert.Nil(t, club.ClusterID, "Unrelated stories should stay out of the cluster")
+
+	// Deleting items recounts their clusters
+	var blogItems []Item
+	db.Where("guid IN ?", []string{"rates-copy", "rates-again"}).Find(&blogItems)
+	assert.NoError(t, deleteItems(db, []uint{blogItems[0].ID, blogItems[1].ID}))
+	db.First(&cluster, cluster.ID)
+	assert.Equal(t, 2, cluster.ItemCount)
+	assert.Equal(t, 2, cluster.SourceCount)
+}
+
+func TestDeleteFeeds_RecountsStoryClusters(t *testing.T) {
+	db := setupTestDB(t)
+	// SQLite only cascades deletes with foreign keys on
+	db.Exec("PRAGMA foreign_keys = ON")
+
+	feeds := []Feed{{URL: "https://example.com/a.xml"}, {URL: "https://example.com/b.xml"}, {URL: "https://example.com/c.xml"}}
+	db.Create(&feeds)
+	cluster := StoryCluster{Title: "Story"}
+	db.Create(&cluster)
+	for _, feed := range feeds {
+		db.Create(&Item{FeedID: feed.ID, GUID: "story", ClusterID: &cluster.ID})
+	}
+	assert.NoError(t, refreshStoryClusters(db, []uint{cluster.ID}))
+
+	assert.NoError(t, deleteFeeds(db, []uint{feeds[0].ID}))
+	db.First(&cluster, cluster.ID)
+	assert.Equal(t, 2, cluster.ItemCount)
+	assert.Equal(t, 2, cluster.SourceCount)
+	var count int64
+	db.Model(&Item{}).Count(&count)
+	assert.Equal(t, int64(2), count, "Should delete the feed's items")
+}
+
+func TestClusterItems_Disabled(t *testing.T) {
+	t.Setenv("STORY_CLUSTER_DISTANCE", "0")
+	fetcher, _ := newTestFetcher(t)
+	db := fetcher.DB
+	body := `<item><title>Central bank raises rates</title><guid>rates</guid><description><![CDATA[` + testWireStory + `]]></description></item>`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<?xml version="1.0"?><rss version="2.0"><channel><title>News</title>` + body + `</channel></rss>`))
+	}))
+	defer server.Close()
+
+	for _, path := range []string{"/a", "/b"} {
+		feed := Feed{URL: server.URL + path}
+		db.Create(&feed)
+		_, err := fetcher.Fetch(context.Background(), &feed)
+		assert.NoError(t, err)
+	}
+	var count int64
+	db.Model(&StoryCluster{}).Count(&count)
+	assert.Zero(t, count)
+}
@@ -1,8 +1,10 @@
 package main
 
 import (
+	"crypto/x509"
 	"fmt"
 	"net/url"
+	"reflect"
 	"regexp"
 	"strings"
 	"unicode"
@@ -23,6 +25,9 @@ func init() {
 	validate.RegisterValidation("username", validateUsername)
 	// validate.RegisterValidation("password_strength", validatePasswordStrength)
 	validate.RegisterValidation("http_url", validateHTTPURL)
+	validate.RegisterValidation("proxy_url", validateProxyURL)
+	validate.RegisterValidation("header_lines", validateHeaderLines)
+	validate.RegisterValidation("pem_certs", validatePEMCerts)
 
 	// Initialize HTML sanitizer with UGC (User Generated Content) policy
 	// This policy allows safe HTML tags while removing dangerous ones
@@ -48,6 +53,34 @@ type FeedInput struct {
 	URL string `validate:"required,http_url" json:"url"`
 }
 
+// FeedScheduleInput represents a fixed fetch interval override for a feed
+type FeedScheduleInput struct {
+	FetchInterval int `validate:"min=60,max=604800" json:"fetch_interval"`
+}
+
+// FeedRetentionInput represents a per-feed override of how many items retention keeps
+type FeedRetentionInput struct {
+	KeepItems int `validate:"min=1,max=1000000" json:"keep_items"`
+}
+
+// FeedHTTPOptionsInput represents the per-feed HTTP options form
+// Empty secret fields keep the stored value; the Clear flags remove it
+type FeedHTTPOptionsInput struct {
+	Username         string `validate:"max=255" json:"username"`
+	Password         string `validate:"max=1024" json:"password"`
+	BearerToken      string `validate:"max=4096" json:"bearer_token"`
+	Cookie           string `validate:"max=8192" json:"cookie"`
+	Headers          string `validate:"omitempty,max=8192,header_lines" json:"headers"`
+	UserAgent        string `validate:"max=512" json:"user_agent"`
+	ProxyURL         string `validate:"omitempty,max=2048,proxy_url" json:"proxy_url"`
+	CACert           string `validate:"omitempty,max=65536,pem_certs" json:"ca_cert"`
+	ClearPassword    bool   `json:"clear_password"`
+	ClearBearerToken bool   `json:"clear_bearer_token"`
+	ClearCookie      bool   `json:"clear_cookie"`
+	ClearHeaders     bool   `json:"clear_headers"`
+	ClearProxyURL    bool   `json:"clear_proxy_url"`
+}
+
 // validateUsername is a custom validator for username
 // Rules: alphanumeric, underscore, hyphen; must start with letter or number
 func validateUsername(fl validator.FieldLevel) bool {
@@ -116,6 +149,26 @@ func validateHTTPURL(fl validator.FieldLevel) bool {
 	return true
 }
 
+// validateProxyURL is a custom validator for proxy URLs
+// Rules: http, https or socks5 protocol with a host
+func validateProxyURL(fl validator.FieldLevel) bool {
+	_, err := parseProxyURL(fl.Field().String())
+	return err == nil
+}
+
+// validateHeaderLines is a custom validator for extra request headers
+// Rules: one "Name: value" header per line
+func validateHeaderLines(fl validator.FieldLevel) bool {
+	_, err := parseHeaderLines(fl.Field().String())
+	return err == nil
+}
+
+// validatePEMCerts is a custom validator for CA certificates
+// Rules: at least one PEM encoded certificate
+func validatePEMCerts(fl validator.FieldLevel) bool {
+	return x509.NewCertPool().AppendCertsFromPEM([]byte(fl.Field().String()))
+}
+
 // ValidateStruct validates a struct using validator/v10
 func ValidateStruct(s interface{}) error {
 	return validate.Struct(s)
@@ -142,15 +195,29 @@ func FormatValidationErrors(err error) string {
 		case "required":
 			message = fmt.Sprintf("%s is required", field)
 		case "min":
-			message = fmt.Sprintf("%s must be at least %s characters long", field, fieldError.Param())
+			if fieldError.Kind() == reflect.Int {
+				message = fmt.Sprintf("%s must be at least %s", field, fieldError.Param())
+			} else {
+				message = fmt.Sprintf("%s must be at least %s characters long", field, fieldError.Param())
+			}
 		case "max":
-			message = fmt.Sprintf("%s must be at most %s characters long", field, fieldError.Param())
+			if fieldError.Kind() == reflect.Int {
+				message = fmt.Sprintf("%s must be at most %s", field, fieldError.Param())
+			} else {
+				message = fmt.Sprintf("%s must be at most %s characters long", field, fieldError.Param())
+			}
 		case "username":
 			message = fmt.Sprintf("%s can only contain letters, numbers, underscores, and hyphens, and must start with a letter or number", field)
 		// case "password_strength":
 		// 	message = fmt.Sprintf("%s must contain at least one letter and one number", field)
 		case "http_url":
 			message = fmt.Sprintf("%s must be a valid URL with http or https protocol", field)
+		case "proxy_url":
+			message = fmt.Sprintf("%s must be a valid URL with http, https or socks5 protocol", field)
+		case "header_lines":
+			message = fmt.Sprintf("%s must contain one \"Name: value\" header per line", field)
+		case "pem_certs":
+			message = fmt.Sprintf("%s must contain at least one PEM encoded certificate", field)
 		case "omitempty":
 			// Skip if field is empty (for optional fields)
 			continue
@@ -0,0 +1,387 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// webSubRetryInterval is how long to wait before re-requesting a subscription that is pending or failed
+const webSubRetryInterval = time.Hour
+
+// maxWebSubPushBytes limits the size of a pushed feed document
+const maxWebSubPushBytes = 10 << 20
+
+// WebSubClient subscribes feeds at their WebSub hubs and keeps the leases renewed
+type WebSubClient struct {
+	Client          *http.Client
+	DB              *gorm.DB
+	Now             func() time.Time
+	CallbackBaseURL string // Public base URL of this app, e.g. https://rss.example.com
+	LeaseSeconds    int    // Lease requested from hubs
+}
+
+// NewWebSubClient creates a WebSubClient from WEBSUB_CALLBACK_BASE_URL and WEBSUB_LEASE_SECONDS
+// Returns nil when WEBSUB_CALLBACK_BASE_URL is not set, since hubs could not reach the callback,
+// or when FEED_SECRETS_KEY is not set, since subscription secrets are stored encrypted
+func NewWebSubClient(db *gorm.DB) *WebSubClient {
+	baseURL := GetWebSubCallbackBaseURL()
+	if baseURL == "" || GetSecretsKey() == "" {
+		return nil
+	}
+	return &WebSubClient{
+		Client:          &http.Client{Timeout: time.Duration(GetFetchTimeout()) * time.Second},
+		DB:              db,
+		Now:             time.Now,
+		CallbackBaseURL: baseURL,
+		LeaseSeconds:    GetWebSubLeaseSeconds(),
+	}
+}
+
+// callbackURL returns the URL the hub verifies intent on and pushes updates to for sub
+func (w *WebSubClient) callbackURL(sub *WebSubSubscription) string {
+	return fmt.Sprintf("%s/websub/callback/%d", w.CallbackBaseURL, sub.ID)
+}
+
+// renewBefore returns how long before the lease ends a subscription is renewed: half the lease, at most a day
+func (w *WebSubClient) renewBefore() time.Duration {
+	before := time.Duration(w.LeaseSeconds) * time.Second / 2
+	if before > 24*time.Hour {
+		before = 24 * time.Hour
+	}
+	return before
+}
+
+// needsSubscribe reports whether sub should be (re)requested at now
+func (w *WebSubClient) needsSubscribe(sub *WebSubSubscription, now time.Time) bool {
+	if sub.State == WebSubStateDenied {
+		return false
+	}
+	if sub.State == WebSubStateActive && sub.ExpiresAt != nil && now.Before(sub.ExpiresAt.Add(-w.renewBefore())) {
+		return false
+	}
+	// Don't hammer the hub while a request is pending or shortly after one failed
+	return sub.RequestedAt == nil || now.Sub(*sub.RequestedAt) >= webSubRetryInterval
+}
+
+// EnsureSubscription subscribes feed at the hub it advertises, unless an equivalent subscription
+// is already active or pending. A changed hub or topic always results in a new request
+func (w *WebSubClient) EnsureSubscription(ctx context.Context, feed *Feed) error {
+	if feed.HubURL == "" {
+		return nil
+	}
+	topic := feed.SelfURL
+	if topic == "" {
+		topic = feed.URL
+	}
+
+	var sub WebSubSubscription
+	if err := w.DB.Where("feed_id = ?", feed.ID).First(&sub).Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	if sub.ID != 0 && sub.HubURL == feed.HubURL && sub.Topic == topic && !w.needsSubscribe(&sub, w.Now()) {
+		return nil
+	}
+	if sub.HubURL != feed.HubURL || sub.Topic != topic {
+		sub.State = ""
+		sub.ExpiresAt = nil
+	}
+
+	sub.FeedID = feed.ID
+	sub.HubURL = feed.HubURL
+	sub.Topic = topic
+	return w.Subscribe(ctx, &sub)
+}
+
+// Subscribe sends a subscription request for sub to its hub. The hub then verifies intent
+// on the callback (see verifyWebSubIntent). Active subscriptions stay active while renewing
+func (w *WebSubClient) Subscribe(ctx context.Context, sub *WebSubSubscription) error {
+	now := w.Now()
+	if sub.Secret == "" {
+		secret, err := newWebSubSecret()
+		if err != nil {
+			return err
+		}
+		sub.Secret = EncryptedString(secret)
+	}
+	if sub.State != WebSubStateActive {
+		sub.State = WebSubStatePending
+	}
+	sub.RequestedAt = &now
+	sub.LastError = ""
+	// Save first: the subscription needs an ID for its callback, and the hub may verify before responding
+	if err := w.DB.Save(sub).Error; err != nil {
+		return err
+	}
+
+	form := url.Values{
+		"hub.mode":          {"subscribe"},
+		"hub.topic":         {sub.Topic},
+		"hub.callback":      {w.callbackURL(sub)},
+		"hub.secret":        {string(sub.Secret)},
+		"hub.lease_seconds": {fmt.Sprintf("%d", w.LeaseSeconds)},
+	}
+	err := w.postToHub(ctx, sub.HubURL, form)
+	if err != nil {
+		log.Printf("WebSub subscription to %s at %s failed: %v", sub.Topic, sub.HubURL, err)
+		if sub.State != WebSubStateActive {
+			sub.State = WebSubStateError
+		}
+		sub.LastError = err.Error()
+		w.DB.Model(sub).Updates(map[string]interface{}{"state": sub.State, "last_error": sub.LastError})
+		return err
+	}
+	log.Printf("Requested WebSub subscription to %s at %s", sub.Topic, sub.HubURL)
+	return nil
+}
+
+// postToHub sends a form to a hub and expects a 2xx (normally 202 Accepted) response
+func (w *WebSubClient) postToHub(ctx context.Context, hubURL string, form url.Values) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hubURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := w.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("hub responded %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// RenewExpiring re-requests active subscriptions whose lease ends soon
+// If renewal fails the lease lapses and the scheduler falls back to polling the feed
+func (w *WebSubClient) RenewExpiring(ctx context.Context) {
+	now := w.Now()
+	var subs []WebSubSubscription
+	w.DB.Where("state = ? AND expires_at <= ?", WebSubStateActive, now.Add(w.renewBefore())).Find(&subs)
+	for i := range subs {
+		if ctx.Err() != nil {
+			return
+		}
+		if w.needsSubscribe(&subs[i], now) {
+			w.Subscribe(ctx, &subs[i])
+		}
+	}
+}
+
+// runWebSubRenewal renews expiring WebSub leases if WebSub is enabled
+func runWebSubRenewal(ctx context.Context) {
+	if client := NewWebSubClient(DB); client != nil {
+		client.RenewExpiring(ctx)
+	}
+}
+
+// verifyWebSubIntent handles an intent verification request from the hub for sub
+// Returns the challenge to echo back, or an error if the request does not match a subscription we asked for
+func verifyWebSubIntent(db *gorm.DB, sub *WebSubSubscription, query url.Values, now time.Time) (string, error) {
+	if query.Get("hub.topic") != sub.Topic {
+		return "", errors.New("topic does not match the subscription")
+	}
+
+	switch query.Get("hub.mode") {
+	case "subscribe":
+		if sub.RequestedAt == nil {
+			return "", errors.New("no subscription request is pending")
+		}
+		lease := GetWebSubLeaseSeconds()
+		if seconds, err := strconv.Atoi(query.Get("hub.lease_seconds")); err == nil && seconds > 0 {
+			lease = seconds
+		}
+		expiresAt := now.Add(time.Duration(lease) * time.Second)
+		sub.State = WebSubStateActive
+		sub.VerifiedAt = &now
+		sub.ExpiresAt = &expiresAt
+		sub.RequestedAt = nil
+		sub.LastError = ""
+		if err := db.Save(sub).Error; err != nil {
+			return "", err
+		}
+		log.Printf("WebSub subscription to %s verified, lease ends %s", sub.Topic, expiresAt.Format(time.RFC3339))
+		return query.Get("hub.challenge"), nil
+	case "denied":
+		sub.State = WebSubStateDenied
+		sub.ExpiresAt = nil
+		sub.RequestedAt = nil
+		sub.LastError = "Denied by hub"
+		if reason := query.Get("hub.reason"); reason != "" {
+			sub.LastError += ": " + reason
+		}
+		if err := db.Save(sub).Error; err != nil {
+			return "", err
+		}
+		log.Printf("WebSub subscription to %s denied by %s", sub.Topic, sub.HubURL)
+		return "", nil
+	default:
+		return "", fmt.Errorf("unsupported mode %q", query.Get("hub.mode"))
+	}
+}
+
+// validWebSubSignature checks an X-Hub-Signature header ("sha256=<hex>") against body signed with secret
+func validWebSubSignature(secret, header string, body []byte) bool {
+	method, signature, ok := strings.Cut(header, "=")
+	if !ok {
+		return false
+	}
+	var newHash func() hash.Hash
+	switch strings.ToLower(method) {
+	case "sha1":
+		newHash = sha1.New
+	case "sha256":
+		newHash = sha256.New
+	case "sha384":
+		newHash = sha512.New384
+	case "sha512":
+		newHash = sha512.New
+	default:
+		return false
+	}
+	expected, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(newHash, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(mac.Sum(nil), expected)
+}
+
+// encryptWebSubSecrets encrypts subscription secrets stored in plaintext before they were encrypted
+// at rest. Without FEED_SECRETS_KEY they can't be encrypted, so they are dropped together with the
+// lease: the feed is polled again, and subscribed anew with a fresh secret once the key is set
+func encryptWebSubSecrets(db *gorm.DB) error {
+	if !db.Migrator().HasTable(&WebSubSubscription{}) {
+		return nil
+	}
+	var rows []struct {
+		ID     uint
+		Secret string
+	}
+	err := db.Model(&WebSubSubscription{}).Select("id", "secret").
+		Where("secret <> '' AND secret NOT LIKE ?", encryptedPrefix+"%").Scan(&rows).Error
+	if err != nil || len(rows) == 0 {
+		return err
+	}
+
+	if GetSecretsKey() == "" {
+		err := db.Model(&WebSubSubscription{}).Where("secret <> '' AND secret NOT LIKE ?", encryptedPrefix+"%").
+			UpdateColumns(map[string]interface{}{"secret": "", "state": "", "expires_at": nil}).Error
+		if err == nil {
+			log.Printf("Dropped %d plaintext WebSub secrets: FEED_SECRETS_KEY is not set, so their feeds are polled", len(rows))
+		}
+		return err
+	}
+	for _, row := range rows {
+		encrypted, err := encryptSecret(row.Secret)
+		if err != nil {
+			return err
+		}
+		if err := db.Model(&WebSubSubscription{}).Where("id = ?", row.ID).UpdateColumn("secret", encrypted).Error; err != nil {
+			return err
+		}
+	}
+	log.Printf("Encrypted %d plaintext WebSub secrets", len(rows))
+	return nil
+}
+
+// newWebSubSecret returns a random secret for signing pushed payloads
+func newWebSubSecret() (string, error) {
+	secret := make([]byte, 20)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(secret), nil
+}
+
+// discoverWebSubLinks returns the hub and self URLs a feed advertises, from HTTP Link headers
+// first and then from rel="hub"/rel="self" link elements of the document (Atom or atom:link in RSS)
+func discoverWebSubLinks(header http.Header, body []byte) (hubURL, selfURL string) {
+	for _, value := range header.Values("Link") {
+		for _, link := range strings.Split(value, ",") {
+			target, params, ok := strings.Cut(link, ";")
+			if !ok {
+				continue
+			}
+			target = strings.Trim(strings.TrimSpace(target), "<>")
+			for _, param := range strings.Split(params, ";") {
+				key, rel, _ := strings.Cut(strings.TrimSpace(param), "=")
+				if strings.ToLower(key) != "rel" {
+					continue
+				}
+				hubURL, selfURL = pickWebSubLink(strings.Trim(rel, `"`), target, hubURL, selfURL)
+			}
+		}
+	}
+	if hubURL != "" && selfURL != "" {
+		return hubURL, selfURL
+	}
+
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	decoder.Strict = false
+	decoder.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) { return input, nil }
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			break
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		// Hub links belong to the feed, not its entries
+		if start.Name.Local == "item" || start.Name.Local == "entry" {
+			break
+		}
+		if start.Name.Local != "link" {
+			continue
+		}
+		var rel, href string
+		for _, attr := range start.Attr {
+			switch attr.Name.Local {
+			case "rel":
+				rel = attr.Value
+			case "href":
+				href = attr.Value
+			}
+		}
+		if href != "" {
+			hubURL, selfURL = pickWebSubLink(rel, href, hubURL, selfURL)
+		}
+	}
+	return hubURL, selfURL
+}
+
+// pickWebSubLink records target as the hub or self URL if rel lists it and none was found yet
+func pickWebSubLink(rel, target, hubURL, selfURL string) (string, string) {
+	for _, value := range strings.Fields(strings.ToLower(rel)) {
+		if value == "hub" && hubURL == "" {
+			hubURL = target
+		}
+		if value == "self" && selfURL == "" {
+			selfURL = target
+		}
+	}
+	return hubURL, selfURL
+}
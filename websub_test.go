@@ -0,0 +1,363 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+const testHubRSS = `<?xml version="1.0"?><rss version="2.0" xmlns:atom="http://www.w3.org/2005/Atom"><channel>` +
+	`<title>Hub Feed</title><atom:link rel="hub" href="HUB"/><atom:link rel="self" href="http://example.com/topic.xml"/>` +
+	`<item><title>Item A</title><link>http://example.com/a</link><guid>a</guid></item>` +
+	`</channel></rss>`
+
+const testPushedRSS = `<?xml version="1.0"?><rss version="2.0"><channel><title>Hub Feed</title>` +
+	`<item><title>Item A</title><link>http://example.com/a</link><guid>a</guid></item>` +
+	`<item><title>Item B</title><link>http://example.com/b</link><guid>b</guid></item>` +
+	`</channel></rss>`
+
+// testHub is a minimal stand-in WebSub hub: it verifies intent on every subscription request
+// before accepting it and remembers the callback and secret so tests can push content
+type testHub struct {
+	server    *httptest.Server
+	callback  string
+	secret    string
+	lease     string
+	requests  int
+	challenge string
+	echoed    string
+}
+
+func newTestHub(t *testing.T) *testHub {
+	hub := &testHub{lease: "3600", challenge: "challenge-123"}
+	hub.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		hub.requests++
+		hub.callback = r.Form.Get("hub.callback")
+		hub.secret = r.Form.Get("hub.secret")
+
+		query := url.Values{
+			"hub.mode":          {"subscribe"},
+			"hub.topic":         {r.Form.Get("hub.topic")},
+			"hub.challenge":     {hub.challenge},
+			"hub.lease_seconds": {hub.lease},
+		}
+		resp, err := http.Get(hub.callback + "?" + query.Encode())
+		if err != nil {
+			t.Errorf("Hub failed to verify intent: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		hub.echoed = string(body)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	t.Cleanup(hub.server.Close)
+	return hub
+}
+
+// push delivers body to the subscriber signed with the subscription secret
+func (h *testHub) push(body string, secret string) (*http.Response, error) {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	req, _ := http.NewRequest(http.MethodPost, h.callback, bytes.NewReader([]byte(body)))
+	req.Header.Set("Content-Type", "application/rss+xml")
+	req.Header.Set("X-Hub-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	return http.DefaultClient.Do(req)
+}
+
+// newTestCallbackServer serves the WebSub callback routes the way main() registers them
+func newTestCallbackServer(t *testing.T) *httptest.Server {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/websub/callback/:id", webSubVerify)
+	r.POST("/websub/callback/:id", webSubReceive)
+	server := httptest.NewServer(r)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestWebSub_SubscribeVerifyAndPush(t *testing.T) {
+	t.Setenv("FEED_SECRETS_KEY", "test-key")
+	fetcher, _ := newTestFetcher(t)
+	hub := newTestHub(t)
+	app := newTestCallbackServer(t)
+
+	feedServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(bytes.ReplaceAll([]byte(testHubRSS), []byte("HUB"), []byte(hub.server.URL)))
+	}))
+	defer feedServer.Close()
+
+	fetcher.WebSub = &WebSubClient{
+		Client:          http.DefaultClient,
+		DB:              fetcher.DB,
+		Now:             time.Now,
+		CallbackBaseURL: app.URL,
+		LeaseSeconds:    3600,
+	}
+
+	feed := Feed{URL: feedServer.URL}
+	fetcher.DB.Create(&feed)
+
+	// Fetching discovers the hub and subscribes; the hub verifies intent before accepting
+	_, err := fetcher.Fetch(context.Background(), &feed)
+	assert.NoError(t, err)
+	assert.Equal(t, hub.server.URL, feed.HubURL, "Should discover the hub link")
+	assert.Equal(t, "http://example.com/topic.xml", feed.SelfURL, "Should discover the self link")
+	assert.Equal(t, 1, hub.requests)
+	assert.Equal(t, hub.challenge, hub.echoed, "Should echo the hub challenge")
+
+	var sub WebSubSubscription
+	fetcher.DB.Where("feed_id = ?", feed.ID).First(&sub)
+	assert.Equal(t, WebSubStateActive, sub.State, "Should activate the verified subscription")
+	assert.Equal(t, "http://example.com/topic.xml", sub.Topic, "Should subscribe to the self URL")
+	assert.NotNil(t, sub.ExpiresAt)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), *sub.ExpiresAt, time.Minute, "Should use the lease granted by the hub")
+
+	// A second fetch does not re-subscribe while the lease is fresh
+	_, err = fetcher.Fetch(context.Background(), &feed)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, hub.requests, "Should not re-subscribe with a valid lease")
+
+	// A pushed payload with a bad signature is acknowledged but ignored
+	resp, err := hub.push(testPushedRSS, "wrong-secret")
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	var count int64
+	fetcher.DB.Model(&Item{}).Where("feed_id = ?", feed.ID).Count(&count)
+	assert.Equal(t, int64(1), count, "Should ignore unsigned pushes")
+
+	// A correctly signed push goes through the upsert path
+	resp, err = hub.push(testPushedRSS, hub.secret)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	fetcher.DB.Model(&Item{}).Where("feed_id = ?", feed.ID).Count(&count)
+	assert.Equal(t, int64(2), count, "Should ingest pushed items")
+
+	var attempt FetchAttempt
+	fetcher.DB.Order("id DESC").First(&attempt)
+	assert.Equal(t, 1, attempt.ItemsCreated, "Should record the push as a fetch attempt")
+	assert.Contains(t, attempt.Message, "WebSub push")
+
+	// The scheduler skips the feed while pushed and polls it again once the lease lapses
+	past := time.Now().Add(-time.Minute)
+	fetcher.DB.Model(&feed).Update("next_fetch_at", past)
+	assert.Empty(t, getDueFeeds(time.Now()), "Should not poll a feed with a valid lease")
+	assert.Len(t, getDueFeeds(sub.ExpiresAt.Add(time.Second)), 1, "Should poll again after the lease lapses")
+}
+
+func TestWebSubReceive_RejectsInactiveSubscriptions(t *testing.T) {
+	t.Setenv("FEED_SECRETS_KEY", "test-key")
+	fetcher, _ := newTestFetcher(t)
+	app := newTestCallbackServer(t)
+
+	feed := Feed{URL: "http://example.com/topic.xml"}
+	fetcher.DB.Create(&feed)
+	noSecret := WebSubSubscription{FeedID: feed.ID, HubURL: "http://hub", Topic: feed.URL, State: WebSubStateActive}
+	fetcher.DB.Create(&noSecret)
+	pending := WebSubSubscription{FeedID: feed.ID, HubURL: "http://hub", Topic: feed.URL, Secret: "secret", State: WebSubStatePending}
+	fetcher.DB.Create(&pending)
+
+	tests := []struct {
+		name   string
+		sub    WebSubSubscription
+		secret string
+	}{
+		{"empty secret", noSecret, ""},
+		{"not active", pending, "secret"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hub := &testHub{callback: app.URL + "/websub/callback/" + strconv.Itoa(int(tt.sub.ID))}
+			resp, err := hub.push(testPushedRSS, tt.secret)
+			if !assert.NoError(t, err) {
+				return
+			}
+			resp.Body.Close()
+			assert.Equal(t, http.StatusGone, resp.StatusCode)
+
+			var count int64
+			fetcher.DB.Model(&Item{}).Count(&count)
+			assert.Zero(t, count, "Should not ingest the push")
+		})
+	}
+}
+
+func TestWebSubClient_RenewExpiring(t *testing.T) {
+	t.Setenv("FEED_SECRETS_KEY", "test-key")
+	db := setupTestDB(t)
+	DB = db
+	hub := newTestHub(t)
+	app := newTestCallbackServer(t)
+
+	now := time.Now()
+	client := &WebSubClient{
+		Client:          http.DefaultClient,
+		DB:              db,
+		Now:             func() time.Time { return now },
+		CallbackBaseURL: app.URL,
+		LeaseSeconds:    3600,
+	}
+
+	soon := now.Add(10 * time.Minute)
+	later := now.Add(10 * time.Hour)
+	expiring := WebSubSubscription{FeedID: 1, HubURL: hub.server.URL, Topic: "http://example.com/a.xml",
+		State: WebSubStateActive, ExpiresAt: &soon}
+	fresh := WebSubSubscription{FeedID: 2, HubURL: hub.server.URL, Topic: "http://example.com/b.xml",
+		State: WebSubStateActive, ExpiresAt: &later}
+	db.Create(&Feed{URL: "http://example.com/a.xml"})
+	db.Create(&Feed{URL: "http://example.com/b.xml"})
+	db.Create(&expiring)
+	db.Create(&fresh)
+
+	client.RenewExpiring(context.Background())
+	assert.Equal(t, 1, hub.requests, "Should renew only the lease that ends soon")
+
+	db.First(&expiring, expiring.ID)
+	assert.Equal(t, WebSubStateActive, expiring.State)
+	assert.True(t, expiring.ExpiresAt.After(soon), "Should extend the lease")
+}
+
+func TestVerifyWebSubIntent(t *testing.T) {
+	db := setupTestDB(t)
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	requested := now.Add(-time.Minute)
+
+	db.Create(&Feed{URL: "http://example.com/feed.xml"})
+	sub := WebSubSubscription{FeedID: 1, HubURL: "http://hub.example.com", Topic: "http://example.com/feed.xml",
+		State: WebSubStatePending}
+	db.Create(&sub)
+
+	query := url.Values{"hub.mode": {"subscribe"}, "hub.topic": {sub.Topic}, "hub.challenge": {"c"}}
+	_, err := verifyWebSubIntent(db, &sub, query, now)
+	assert.Error(t, err, "Should reject verification without a pending request")
+
+	sub.RequestedAt = &requested
+	query.Set("hub.topic", "http://example.com/other.xml")
+	_, err = verifyWebSubIntent(db, &sub, query, now)
+	assert.Error(t, err, "Should reject a mismatched topic")
+
+	query.Set("hub.topic", sub.Topic)
+	challenge, err := verifyWebSubIntent(db, &sub, query, now)
+	assert.NoError(t, err)
+	assert.Equal(t, "c", challenge)
+	assert.Equal(t, WebSubStateActive, sub.State)
+
+	denied := url.Values{"hub.mode": {"denied"}, "hub.topic": {sub.Topic}, "hub.reason": {"not allowed"}}
+	_, err = verifyWebSubIntent(db, &sub, denied, now)
+	assert.NoError(t, err)
+	assert.Equal(t, WebSubStateDenied, sub.State)
+	assert.Nil(t, sub.ExpiresAt, "Should drop the lease when denied")
+	assert.Contains(t, sub.LastError, "not allowed")
+}
+
+func TestDiscoverWebSubLinks(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  http.Header
+		body    string
+		hubURL  string
+		selfURL string
+	}{
+		{
+			name:    "link header",
+			header:  http.Header{"Link": {`<https://hub.example.com/>; rel="hub", <https://example.com/feed>; rel="self"`}},
+			body:    `<rss><channel></channel></rss>`,
+			hubURL:  "https://hub.example.com/",
+			selfURL: "https://example.com/feed",
+		},
+		{
+			name:    "atom links",
+			body:    `<feed xmlns="http://www.w3.org/2005/Atom"><link rel="hub" href="https://hub.example.com/"/><link rel="self" href="https://example.com/atom"/></feed>`,
+			hubURL:  "https://hub.example.com/",
+			selfURL: "https://example.com/atom",
+		},
+		{
+			name:    "entry links are ignored",
+			body:    `<feed xmlns="http://www.w3.org/2005/Atom"><entry><link rel="hub" href="https://hub.example.com/"/></entry></feed>`,
+			hubURL:  "",
+			selfURL: "",
+		},
+		{
+			name:    "no hub",
+			body:    testRSS,
+			hubURL:  "",
+			selfURL: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := tt.header
+			if header == nil {
+				header = http.Header{}
+			}
+			hubURL, selfURL := discoverWebSubLinks(header, []byte(tt.body))
+			assert.Equal(t, tt.hubURL, hubURL)
+			assert.Equal(t, tt.selfURL, selfURL)
+		})
+	}
+}
+
+func TestValidWebSubSignature(t *testing.T) {
+	body := []byte("payload")
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write(body)
+	signature := hex.EncodeToString(mac.Sum(nil))
+
+	assert.True(t, validWebSubSignature("secret", "sha256="+signature, body))
+	assert.False(t, validWebSubSignature("other", "sha256="+signature, body), "Should reject a different secret")
+	assert.False(t, validWebSubSignature("secret", "sha256="+signature, []byte("tampered")), "Should reject a changed body")
+	assert.False(t, validWebSubSignature("secret", "md5="+signature, body), "Should reject unknown methods")
+	assert.False(t, validWebSubSignature("secret", "", body), "Should reject a missing signature")
+}
+
+func TestEncryptWebSubSecrets(t *testing.T) {
+	t.Setenv("FEED_SECRETS_KEY", "test-key")
+	db := setupTestDB(t)
+	expires := time.Now().Add(time.Hour)
+	db.Create(&Feed{URL: "http://example.com/a.xml"})
+	db.Create(&Feed{URL: "http://example.com/b.xml"})
+	encrypted := WebSubSubscription{FeedID: 1, HubURL: "http://hub", Topic: "a", Secret: "kept", State: WebSubStateActive, ExpiresAt: &expires}
+	plain := WebSubSubscription{FeedID: 2, HubURL: "http://hub", Topic: "b", State: WebSubStateActive, ExpiresAt: &expires}
+	db.Create(&encrypted)
+	db.Create(&plain)
+
+	var raw string
+	db.Model(&WebSubSubscription{}).Select("secret").Where("id = ?", encrypted.ID).Scan(&raw)
+	assert.True(t, strings.HasPrefix(raw, encryptedPrefix), "Should store secrets encrypted")
+
+	// Secrets stored before they were encrypted are encrypted on migration
+	db.Exec("UPDATE web_sub_subscriptions SET secret = 'legacy' WHERE id = ?", plain.ID)
+	assert.NoError(t, encryptWebSubSecrets(db))
+	var migrated, untouched WebSubSubscription
+	db.First(&migrated, plain.ID)
+	assert.Equal(t, EncryptedString("legacy"), migrated.Secret)
+	db.First(&untouched, encrypted.ID)
+	assert.Equal(t, EncryptedString("kept"), untouched.Secret)
+
+	// Without a key they are dropped along with the lease, so the feed is polled again
+	db.Exec("UPDATE web_sub_subscriptions SET secret = 'legacy' WHERE id = ?", plain.ID)
+	t.Setenv("FEED_SECRETS_KEY", "")
+	assert.NoError(t, encryptWebSubSecrets(db))
+	var dropped WebSubSubscription
+	db.First(&dropped, plain.ID)
+	assert.Empty(t, dropped.Secret)
+	assert.Nil(t, dropped.ExpiresAt)
+}